@@ -2,23 +2,92 @@ package oauth2
 
 import (
 	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+//JWTVerificationKeys are the public keys of the keys itsyou.online signs jwt's with, indexed by key id
+// Besides the active signing key, it contains the previous and upcoming signing keys so jwt's stay valid during a key rotation
+type JWTVerificationKeys struct {
+	Keys map[string]*ecdsa.PublicKey
+	//LegacyKeyID is the key jwt's without a kid header are verified with, the single signing key used before key rotation was supported
+	// If it is empty, jwt's without a kid are rejected
+	LegacyKeyID string
+}
+
+//NewJWTVerificationKeys creates a set of verification keys, jwt's without a kid header are verified with the first key
+func NewJWTVerificationKeys(legacyKey *ecdsa.PublicKey, otherKeys ...*ecdsa.PublicKey) *JWTVerificationKeys {
+	keys := &JWTVerificationKeys{
+		Keys:        map[string]*ecdsa.PublicKey{},
+		LegacyKeyID: JWTKeyID(legacyKey),
+	}
+	keys.Keys[keys.LegacyKeyID] = legacyKey
+	for _, key := range otherKeys {
+		keys.Keys[JWTKeyID(key)] = key
+	}
+	return keys
+}
+
+//keyFor selects the key a jwt needs to be verified with by the kid in its header
+// jwt's issued before key rotation was supported do not have a kid, they are verified with the legacy key
+func (keys *JWTVerificationKeys) keyFor(token *jwt.Token) (publicKey *ecdsa.PublicKey, err error) {
+	kid := keys.LegacyKeyID
+	if rawKid, present := token.Header["kid"]; present {
+		kid, _ = rawKid.(string)
+	}
+	publicKey, found := keys.Keys[kid]
+	if !found {
+		err = fmt.Errorf("Unknown signing key: %v", token.Header["kid"])
+	}
+	return
+}
+
+//JWTKeyID calculates a stable key id for a public key
+// The JWK thumbprint as defined in RFC 7638 is used so the kid only changes when the key itself changes
+func JWTKeyID(publicKey *ecdsa.PublicKey) string {
+	params := publicKey.Curve.Params()
+	size := (params.BitSize + 7) / 8
+	x := base64.RawURLEncoding.EncodeToString(PaddedBytes(publicKey.X, size))
+	y := base64.RawURLEncoding.EncodeToString(PaddedBytes(publicKey.Y, size))
+	thumbprintInput := fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, params.Name, x, y)
+	hash := sha256.Sum256([]byte(thumbprintInput))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+//PaddedBytes returns the big-endian representation of i, left padded with zeros to size bytes
+// This is the fixed size encoding of the coordinates of an EC public key used in JWKs and thumbprints
+func PaddedBytes(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
 //GetValidJWT returns a validated ES384 signed jwt from the authorization header that needs to start with "bearer "
 // If no jwt is found in the authorization header, nil is returned
-// Validation against the supplied publickey is performed
-func GetValidJWT(r *http.Request, publicKey *ecdsa.PublicKey) (token *jwt.Token, err error) {
+// The jwt is validated against the verification key with the kid from its header
+func GetValidJWT(r *http.Request, keys *JWTVerificationKeys) (token *jwt.Token, err error) {
 	authorizationHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authorizationHeader, "bearer ") {
 		return
 	}
 	jwtstring := strings.TrimSpace(strings.TrimPrefix(authorizationHeader, "bearer"))
+	token, err = ParseJWT(jwtstring, keys)
+	return
+}
+
+//ParseJWT parses and validates an ES384 signed jwt against the verification key with the kid from its header
+func ParseJWT(jwtstring string, keys *JWTVerificationKeys) (token *jwt.Token, err error) {
 	token, err = jwt.Parse(jwtstring, func(token *jwt.Token) (interface{}, error) {
 		m, ok := token.Method.(*jwt.SigningMethodECDSA)
 		if !ok {
@@ -27,7 +96,7 @@ func GetValidJWT(r *http.Request, publicKey *ecdsa.PublicKey) (token *jwt.Token,
 		if token.Header["alg"] != m.Alg() {
 			return nil, fmt.Errorf("Unexpected signing algorithm: %v", token.Header["alg"])
 		}
-		return publicKey, nil
+		return keys.keyFor(token)
 	})
 	if err == nil && !token.Valid {
 		err = errors.New("Invalid jwt supplied:" + jwtstring)
@@ -35,6 +104,15 @@ func GetValidJWT(r *http.Request, publicKey *ecdsa.PublicKey) (token *jwt.Token,
 	return
 }
 
+//ParsePublicKey parses a PEM encoded ECDSA or RSA public key that can be used to verify jwt signatures
+func ParsePublicKey(pemKey string) (publicKey interface{}, err error) {
+	if publicKey, err = jwt.ParseECPublicKeyFromPEM([]byte(pemKey)); err == nil {
+		return
+	}
+	publicKey, err = jwt.ParseRSAPublicKeyFromPEM([]byte(pemKey))
+	return
+}
+
 func GetScopesFromJWT(token *jwt.Token) (scopes []string) {
 	if token == nil {
 		return
@@ -1,6 +1,10 @@
 package oauth2
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -33,11 +37,40 @@ func TestGetValidJWT(t *testing.T) {
 
 	r.Header.Set("Authorization", "bearer "+tokenString)
 
-	j, err := GetValidJWT(r, &ecdsaKey.PublicKey)
+	j, err := GetValidJWT(r, NewJWTVerificationKeys(&ecdsaKey.PublicKey))
 	assert.NoError(t, err, "")
 	assert.True(t, j.Valid, "Invalid jwt")
 }
 
+//TestParseJWTKeyID tests the selection of the verification key by the kid of the jwt
+func TestParseJWTKeyID(t *testing.T) {
+	ecdsaKey, _ := jwt.ParseECPrivateKeyFromPEM([]byte(testkey))
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	kid := JWTKeyID(&ecdsaKey.PublicKey)
+	assert.NotEmpty(t, kid)
+	assert.Equal(t, kid, JWTKeyID(&ecdsaKey.PublicKey))
+	assert.NotEqual(t, kid, JWTKeyID(&otherKey.PublicKey))
+
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Header["kid"] = kid
+	tokenString, _ := token.SignedString(ecdsaKey)
+
+	// The key with the kid of the jwt is used, also if it is not the default key
+	_, err := ParseJWT(tokenString, NewJWTVerificationKeys(&otherKey.PublicKey, &ecdsaKey.PublicKey))
+	assert.NoError(t, err)
+	_, err = ParseJWT(tokenString, NewJWTVerificationKeys(&otherKey.PublicKey))
+	assert.Error(t, err)
+
+	// A jwt without kid is verified with the default key
+	delete(token.Header, "kid")
+	tokenString, _ = token.SignedString(ecdsaKey)
+	_, err = ParseJWT(tokenString, NewJWTVerificationKeys(&ecdsaKey.PublicKey, &otherKey.PublicKey))
+	assert.NoError(t, err)
+	_, err = ParseJWT(tokenString, NewJWTVerificationKeys(&otherKey.PublicKey, &ecdsaKey.PublicKey))
+	assert.Error(t, err)
+}
+
 func TestGetScopesFromJWT(t *testing.T) {
 	originaltoken := jwt.New(jwt.SigningMethodHS256)
 	originaltoken.Claims["username"] = "rob"
@@ -69,3 +102,9 @@ func TestGetScopestringFromJWT(t *testing.T) {
 	assert.NoError(t, err, "")
 	assert.Equal(t, "1,2", scopestring, "")
 }
+
+func TestPaddedBytes(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 1, 2}, PaddedBytes(big.NewInt(0x0102), 4))
+	assert.Equal(t, []byte{1, 2}, PaddedBytes(big.NewInt(0x0102), 2))
+	assert.Equal(t, []byte{0, 0}, PaddedBytes(big.NewInt(0), 2))
+}
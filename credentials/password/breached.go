@@ -0,0 +1,81 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	breachedpasswords "github.com/itsyouonline/identityserver/credentials/password/packaged"
+)
+
+const (
+	defaultBreachedPasswordsFile = "breachedpasswords.txt"
+
+	//rangePrefixLength is the number of hex characters of the SHA-1 hash used to look up a range of hashes
+	rangePrefixLength = 5
+)
+
+//BreachedList contains the SHA-1 hashes of passwords that appeared in data breaches.
+// Like the k-anonymity range api of Pwned Passwords, the hashes are grouped by the first 5 hex characters,
+// a password is looked up by fetching the range of its prefix and searching the suffix in there.
+// The list is loaded from a local file, passwords or their hashes are never sent over the network.
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+	count  int
+}
+
+//LoadBreachedList reads a list of SHA-1 hashes in hex, one per line.
+// A hash can be followed by ':' and the number of times it was seen, as in the Pwned Passwords downloads.
+// Empty lines and lines starting with '#' are ignored.
+func LoadBreachedList(r io.Reader) (list *BreachedList, err error) {
+	list = &BreachedList{ranges: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash := strings.ToUpper(strings.SplitN(line, ":", 2)[0])
+		if _, decodeErr := hex.DecodeString(hash); decodeErr != nil || len(hash) != sha1.Size*2 {
+			err = fmt.Errorf("invalid SHA-1 hash on line %d", lineNumber)
+			return
+		}
+		prefix, suffix := hash[:rangePrefixLength], hash[rangePrefixLength:]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = make(map[string]struct{})
+		}
+		if _, exists := list.ranges[prefix][suffix]; !exists {
+			list.ranges[prefix][suffix] = struct{}{}
+			list.count++
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+//LoadDefaultBreachedList loads the list of common breached passwords that is shipped with the identityserver
+func LoadDefaultBreachedList() (list *BreachedList, err error) {
+	data, err := breachedpasswords.Asset(defaultBreachedPasswordsFile)
+	if err != nil {
+		return
+	}
+	return LoadBreachedList(strings.NewReader(string(data)))
+}
+
+//Len returns the number of hashes in the list
+func (l *BreachedList) Len() int {
+	return l.count
+}
+
+//Contains checks if the password appears in the list
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, found := l.ranges[hash[:rangePrefixLength]][hash[rangePrefixLength:]]
+	return found
+}
@@ -0,0 +1,30 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBreachedList(t *testing.T) {
+	data := `# sha1 of "password" and "123456"
+5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8
+
+7C4A8D09CA3762AF61E59520943DC26494F8941B:24230577
+7C4A8D09CA3762AF61E59520943DC26494F8941B:24230577
+`
+	list, err := LoadBreachedList(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, list.Len())
+	assert.True(t, list.Contains("password"))
+	assert.True(t, list.Contains("123456"))
+	assert.False(t, list.Contains("1234567"))
+}
+
+func TestLoadBreachedListInvalid(t *testing.T) {
+	_, err := LoadBreachedList(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\nnot a hash\n"))
+	assert.EqualError(t, err, "invalid SHA-1 hash on line 2")
+	_, err = LoadBreachedList(strings.NewReader("5BAA61E4C9B93F3F\n"))
+	assert.Error(t, err)
+}
@@ -19,9 +19,15 @@ const (
 	mongoCollectionNameResetToken = "passwordresetoken"
 )
 
+//dummyKey is an argon2id key with the current parameters that no password is known for
+// Checking a password of an unknown user against it takes as long as checking the password of an existing user
+const dummyKey = "$argon2id$v=19$m=65536,t=1,p=4$YCk0KlfJkiNB/s9Arfch5A$O3smqpftJHA6i8jgpznapEQACI3gcNZcgN2n5uXH6oc"
+
 type userPass struct {
 	Username string
 	Password string
+	//History contains the previous password hashes, most recent first
+	History []string
 }
 
 type ResetToken struct {
@@ -79,34 +85,82 @@ func NewManager(r *http.Request) *Manager {
 	}
 }
 
+//SimulateValidation does the same work as validating a password, without a user to validate it for
+// It is used for unknown users so the response time does not reveal whether a user exists
+func SimulateValidation(password string) {
+	keyderivation.Check(password, dummyKey)
+}
+
 //Validate checks the password for a specific username
 func (pwm *Manager) Validate(username, password string) (bool, error) {
 	var storedPassword userPass
 	if err := pwm.collection.Find(bson.M{"username": username}).One(&storedPassword); err != nil {
 		if err == mgo.ErrNotFound {
 			log.Debug("No password found for this user")
+			SimulateValidation(password)
 			return false, nil
 		}
 		log.Debug(err)
 		return false, err
 	}
 	match := keyderivation.Check(password, storedPassword.Password)
+	if match && keyderivation.NeedsRehash(storedPassword.Password) {
+		pwm.rehash(username, password)
+	}
 	return match, nil
 }
 
+//rehash replaces a stored key created with an older algorithm or parameters by one using the current algorithm.
+// Failing to do so does not affect the validation, the upgrade will be retried on the next login.
+func (pwm *Manager) rehash(username, password string) {
+	passwordHash, err := keyderivation.Hash(password)
+	if err != nil {
+		log.Error("ERROR hashing password: ", err)
+		return
+	}
+	if err = pwm.collection.Update(bson.M{"username": username}, bson.M{"$set": bson.M{"password": passwordHash}}); err != nil {
+		log.Error("ERROR upgrading the password hash of ", username, ": ", err)
+	}
+}
+
 // Save stores a password for a specific username.
-func (pwm *Manager) Save(username, password string) error {
-	//TODO: username and password validation
+// The password is checked against the DefaultPolicy first, emails are the email addresses of the user.
+// If it does not meet the policy, a *PolicyError listing the violations is returned.
+func (pwm *Manager) Save(username, password string, emails []string) error {
+	var storedPassword userPass
+	if err := pwm.collection.Find(bson.M{"username": username}).One(&storedPassword); err != nil && err != mgo.ErrNotFound {
+		log.Error("ERROR loading the stored password: ", err)
+		return errors.New("internal_error")
+	}
+	violations := DefaultPolicy.Check(username, password, emails)
+	history := storedPassword.History
+	if storedPassword.Password != "" {
+		history = append([]string{storedPassword.Password}, history...)
+	}
+	if len(history) > DefaultPolicy.HistorySize {
+		history = history[:DefaultPolicy.HistorySize]
+	}
+	for _, previousPassword := range history {
+		if keyderivation.Check(password, previousPassword) {
+			violations = append(violations, PolicyViolation{Code: ViolationReused, Value: DefaultPolicy.HistorySize})
+			break
+		}
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
 	passwordHash, err := keyderivation.Hash(password)
 	if err != nil {
 		log.Error("ERROR hashing password")
 		log.Debug("ERROR hashing password: ", err)
 		return errors.New("internal_error")
 	}
-	if len(password) < 6 {
-		return errors.New("invalid_password")
+	//Together with the new password, the last HistorySize passwords are kept
+	if len(history) == DefaultPolicy.HistorySize && len(history) > 0 {
+		history = history[:len(history)-1]
 	}
-	storedPassword := userPass{Username: username, Password: passwordHash}
+	storedPassword = userPass{Username: username, Password: passwordHash, History: history}
 
 	_, err = pwm.collection.Upsert(bson.M{"username": username}, storedPassword)
 
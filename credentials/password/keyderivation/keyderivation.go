@@ -1,21 +1,108 @@
 package keyderivation
 
-import "github.com/itsyouonline/identityserver/credentials/password/keyderivation/crypt/sha512crypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
-//Hash creates a random 16 character salt and creates a key using this salt
-//Key generation function: SHA512 with 5000 iterations
-// If you want to generate the same key on the commandline:
-// `echo "user:password" | chpasswd -c SHA512 -S | cut -d: -f 2`
-func Hash(password string) (key string, err error) {
-	c := sha512crypt.New()
-	key, err = c.Generate([]byte(password), []byte(""))
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation/crypt/argon2"
+	"github.com/itsyouonline/identityserver/credentials/password/keyderivation/crypt/sha512crypt"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	sha512Prefix   = "$6$"
+
+	//Argon2id parameters used for new keys, memory is expressed in KiB
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
 
+//argon2Params holds the argon2id parameters and salt as encoded in a key
+type argon2Params struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+//Hash creates a random 16 byte salt and creates a key using this salt
+//Key generation function: argon2id with 64MB memory, 1 iteration and 4 threads
+//The key is encoded in the PHC string format so it describes its own algorithm and parameters:
+// `$argon2id$v=19$m=65536,t=1,p=4$<base64 salt>$<base64 key>`
+func Hash(password string) (key string, err error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+	hash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	key = fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
 	return
 }
 
 //Check takes the password and the encoded key
 // and checks if the combination matches
+//Both argon2id keys and the SHA512 crypt keys created before argon2id became the default are supported
 func Check(password, key string) bool {
+	if strings.HasPrefix(key, argon2idPrefix) {
+		params, err := decodeArgon2id(key)
+		if err != nil {
+			return false
+		}
+		hash := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(hash, params.key) == 1
+	}
 	err := sha512crypt.New().Verify(key, []byte(password))
 	return err == nil
 }
+
+//NeedsRehash returns true if the key was not created with the current algorithm and parameters.
+// After a successful Check, the password should be hashed again to upgrade the stored key.
+func NeedsRehash(key string) bool {
+	if !strings.HasPrefix(key, argon2idPrefix) {
+		return true
+	}
+	params, err := decodeArgon2id(key)
+	if err != nil {
+		return true
+	}
+	return params.version != argon2.Version || params.memory != argon2Memory || params.time != argon2Time ||
+		params.threads != argon2Threads || len(params.salt) != argon2SaltLen || len(params.key) != argon2KeyLen
+}
+
+func decodeArgon2id(key string) (params argon2Params, err error) {
+	parts := strings.Split(key, "$")
+	if len(parts) != 6 {
+		err = fmt.Errorf("invalid argon2id key: expected 6 parts, got %d", len(parts))
+		return
+	}
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return
+	}
+	if params.time < 1 || params.threads < 1 {
+		err = fmt.Errorf("invalid argon2id parameters: %s", parts[3])
+		return
+	}
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return
+	}
+	if len(params.key) == 0 {
+		err = errors.New("invalid argon2id key: empty hash")
+	}
+	return
+}
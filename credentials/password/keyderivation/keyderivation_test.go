@@ -2,6 +2,7 @@ package keyderivation
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +23,57 @@ func TestCheck(t *testing.T) {
 		t.Error("Password and salt should match the given key")
 	}
 }
+
+func TestHashIsArgon2id(t *testing.T) {
+	key, err := Hash("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Error("Unexpected key format: ", key)
+	}
+	if !Check("demo", key) {
+		t.Error("Password should match the generated key")
+	}
+	if Check("demo2", key) {
+		t.Error("Wrong password should not match the generated key")
+	}
+	if NeedsRehash(key) {
+		t.Error("A freshly generated key should not need a rehash")
+	}
+}
+
+func TestCheckArgon2id(t *testing.T) {
+	//Generated with the reference implementation: `echo -n password | argon2 somesalt -id -t 2 -k 64 -p 2 -l 24 -e`
+	key := "$argon2id$v=19$m=64,t=2,p=2$c29tZXNhbHQ$NQrDciL0Nsy1wJcvHr079rlYvyBxhBNi"
+	if !Check("password", key) {
+		t.Error("Password and salt should match the given key")
+	}
+	if Check("password2", key) {
+		t.Error("Wrong password should not match the given key")
+	}
+	if !NeedsRehash(key) {
+		t.Error("A key with different parameters should need a rehash")
+	}
+}
+
+func TestCheckInvalidKey(t *testing.T) {
+	for _, key := range []string{
+		"",
+		"$argon2id$",
+		"$argon2id$v=19$m=64,t=0,p=2$c29tZXNhbHQ$NQrDciL0Nsy1wJcvHr079rlYvyBxhBNi",
+		"$argon2id$v=19$m=64,t=2,p=2$c29tZXNhbHQ$",
+		"$argon2id$v=19$m=64,t=2,p=2$c29tZXNhbHQ$!!!",
+	} {
+		if Check("password", key) {
+			t.Error("Invalid key should not match: ", key)
+		}
+	}
+}
+
+func TestNeedsRehashSHA512(t *testing.T) {
+	key := "$6$Iu14DOBmK4/JqCTd$E67.yXll739DjVacyQjulJ6bjN1GIwkHfd/Er4HpABMvpq4x0fpH8aOdOmUjVZSmr8tUhkVxDoX685KJSXfgg1"
+	if !NeedsRehash(key) {
+		t.Error("A SHA512 crypt key should need a rehash")
+	}
+}
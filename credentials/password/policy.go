@@ -0,0 +1,135 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Codes of the password policy violations
+const (
+	ViolationTooShort         = "password_too_short"
+	ViolationCharacterClasses = "password_character_classes"
+	ViolationContainsUserInfo = "password_contains_user_info"
+	ViolationReused           = "password_reused"
+	ViolationBreached         = "password_breached"
+)
+
+//userInfoMinLength is the minimum length of a username or email address part to be rejected in a password,
+// shorter values match too many passwords by accident
+const userInfoMinLength = 3
+
+//Limits of the configurable policy values
+const (
+	maxMinLength        = 64
+	maxCharacterClasses = 4
+	maxHistorySize      = 24
+)
+
+//Policy defines the requirements a new password has to meet
+type Policy struct {
+	//MinLength is the minimum number of characters
+	MinLength int
+	//MinCharacterClasses is the minimum number of character classes (lowercase, uppercase, digits and symbols) used
+	MinCharacterClasses int
+	//DisallowUserInfo rejects passwords containing the username or the part before the @ of an email address
+	DisallowUserInfo bool
+	//HistorySize is the number of last passwords, including the current one, that can not be reused
+	HistorySize int
+	//Breached is the list of passwords that appeared in data breaches, nil disables this check
+	Breached *BreachedList
+}
+
+//DefaultPolicy is the policy enforced when a password is saved, the breached passwords list is set at startup
+var DefaultPolicy = Policy{
+	MinLength:           8,
+	MinCharacterClasses: 1,
+	DisallowUserInfo:    true,
+	HistorySize:         5,
+}
+
+//Validate checks if the policy can be enforced, it is meant to be called at startup
+func (p Policy) Validate() error {
+	if p.MinLength < 1 || p.MinLength > maxMinLength {
+		return fmt.Errorf("the minimum password length should be between 1 and %d, got %d", maxMinLength, p.MinLength)
+	}
+	if p.MinCharacterClasses < 0 || p.MinCharacterClasses > maxCharacterClasses {
+		return fmt.Errorf("the minimum number of character classes should be between 0 and %d, got %d", maxCharacterClasses, p.MinCharacterClasses)
+	}
+	if p.HistorySize < 0 || p.HistorySize > maxHistorySize {
+		return fmt.Errorf("the password history size should be between 0 and %d, got %d", maxHistorySize, p.HistorySize)
+	}
+	return nil
+}
+
+//PolicyViolation is a requirement of the password policy a password does not meet
+type PolicyViolation struct {
+	Code string `json:"code"`
+	//Value is the number the requirement is about: the minimum length, number of character classes or history size
+	Value int `json:"value,omitempty"`
+}
+
+//PolicyError is returned when saving a password that does not meet the password policy
+type PolicyError struct {
+	Violations []PolicyViolation
+}
+
+//Error returns the same error code as for other invalid passwords, the violations give the details
+func (err *PolicyError) Error() string {
+	return "invalid_password"
+}
+
+//IsPolicyError checks if the error is a password policy violation
+func IsPolicyError(err error) bool {
+	_, ok := err.(*PolicyError)
+	return ok
+}
+
+//Check validates the password against the rules of the policy that do not depend on previous passwords
+func (p Policy) Check(username, password string, emails []string) (violations []PolicyViolation) {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PolicyViolation{Code: ViolationTooShort, Value: p.MinLength})
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, PolicyViolation{Code: ViolationCharacterClasses, Value: p.MinCharacterClasses})
+	}
+	if p.DisallowUserInfo && containsUserInfo(password, username, emails) {
+		violations = append(violations, PolicyViolation{Code: ViolationContainsUserInfo})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, PolicyViolation{Code: ViolationBreached})
+	}
+	return
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+func containsUserInfo(password, username string, emails []string) bool {
+	values := []string{username}
+	for _, email := range emails {
+		values = append(values, strings.SplitN(email, "@", 2)[0])
+	}
+	password = strings.ToLower(password)
+	for _, value := range values {
+		if utf8.RuneCountInString(value) >= userInfoMinLength && strings.Contains(password, strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func codes(violations []PolicyViolation) (c []string) {
+	for _, violation := range violations {
+		c = append(c, violation.Code)
+	}
+	return
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{MinLength: 8, MinCharacterClasses: 3, DisallowUserInfo: true}
+
+	assert.Empty(t, policy.Check("john", "Correct-horse-battery", nil))
+	assert.Equal(t, []PolicyViolation{{Code: ViolationTooShort, Value: 8}}, policy.Check("john", "Sh0rt!", nil))
+	assert.Equal(t, []PolicyViolation{{Code: ViolationCharacterClasses, Value: 3}}, policy.Check("john", "onlylowercase", nil))
+	assert.Equal(t, []string{ViolationTooShort, ViolationCharacterClasses}, codes(policy.Check("john", "short", nil)))
+	//Length is counted in characters, not bytes
+	assert.Equal(t, []string{ViolationTooShort}, codes(policy.Check("john", "Ünïcöd1", nil)))
+}
+
+func TestPolicyCheckUserInfo(t *testing.T) {
+	policy := Policy{DisallowUserInfo: true}
+
+	assert.Equal(t, []string{ViolationContainsUserInfo}, codes(policy.Check("johnsmith", "my-JohnSmith-password", nil)))
+	assert.Equal(t, []string{ViolationContainsUserInfo}, codes(policy.Check("johnsmith", "jsmith1980!", []string{"jsmith@example.com"})))
+	assert.Empty(t, policy.Check("johnsmith", "example.com rocks", []string{"jsmith@example.com"}))
+	//Values that are too short are not checked
+	assert.Empty(t, policy.Check("jo", "jojojojo", []string{"j@example.com"}))
+
+	policy.DisallowUserInfo = false
+	assert.Empty(t, policy.Check("johnsmith", "my-JohnSmith-password", nil))
+}
+
+func TestPolicyCheckBreached(t *testing.T) {
+	list, err := LoadBreachedList(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3730471\n"))
+	assert.NoError(t, err)
+	policy := Policy{Breached: list}
+
+	assert.Equal(t, []string{ViolationBreached}, codes(policy.Check("john", "password", nil)))
+	assert.Empty(t, policy.Check("john", "Password", nil))
+}
+
+func TestPolicyValidate(t *testing.T) {
+	assert.NoError(t, DefaultPolicy.Validate())
+	assert.NoError(t, Policy{MinLength: 1}.Validate())
+	assert.NoError(t, Policy{MinLength: 64, MinCharacterClasses: 4, HistorySize: 24}.Validate())
+	for _, policy := range []Policy{
+		{MinLength: 0},
+		{MinLength: -1},
+		{MinLength: 65},
+		{MinLength: 8, MinCharacterClasses: -1},
+		{MinLength: 8, MinCharacterClasses: 5},
+		{MinLength: 8, HistorySize: -1},
+		{MinLength: 8, HistorySize: 25},
+	} {
+		assert.Error(t, policy.Validate(), "%+v", policy)
+	}
+}
+
+func TestIsPolicyError(t *testing.T) {
+	var err error = &PolicyError{Violations: []PolicyViolation{{Code: ViolationReused, Value: 5}}}
+	assert.True(t, IsPolicyError(err))
+	assert.Equal(t, "invalid_password", err.Error())
+	assert.False(t, IsPolicyError(nil))
+}
@@ -0,0 +1,119 @@
+package recoverycodes
+
+import (
+	"net/http"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+const (
+	mongoCollectionName = "recoverycodes"
+)
+
+//userCodes holds the hashes of the unused recovery codes of a user
+type userCodes struct {
+	Username string
+	//Salt is random for every batch of codes
+	Salt      string
+	Codes     []string
+	CreatedAt time.Time
+}
+
+// InitModels initializes models in mongo, if required.
+func InitModels() {
+	index := mgo.Index{
+		Key:      []string{"username"},
+		Unique:   true,
+		DropDups: true,
+	}
+
+	db.EnsureIndex(mongoCollectionName, index)
+}
+
+//Manager stores and validates recovery codes
+type Manager struct {
+	session    *mgo.Session
+	collection *mgo.Collection
+}
+
+//NewManager creates a new Manager
+func NewManager(r *http.Request) *Manager {
+	session := db.GetDBSession(r)
+	return &Manager{
+		session:    session,
+		collection: db.GetCollection(session, mongoCollectionName),
+	}
+}
+
+//Regenerate creates a new batch of recovery codes for a user, the previous codes can no longer be used
+// Only the hashes are stored, the plain codes are returned to be shown to the user once
+func (m *Manager) Regenerate(username string) (codes []string, err error) {
+	codes, err = Generate()
+	if err != nil {
+		return
+	}
+	salt, err := newSalt()
+	if err != nil {
+		return
+	}
+	stored := userCodes{Username: username, Salt: salt, Codes: make([]string, len(codes)), CreatedAt: time.Now()}
+	for i, code := range codes {
+		stored.Codes[i] = hashCode(salt, code)
+	}
+	_, err = m.collection.Upsert(bson.M{"username": username}, stored)
+	return
+}
+
+//Remaining returns the number of unused recovery codes of a user
+func (m *Manager) Remaining(username string) (remaining int, err error) {
+	var stored userCodes
+	err = m.collection.Find(bson.M{"username": username}).One(&stored)
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	remaining = len(stored.Codes)
+	return
+}
+
+//Use checks a recovery code of a user and removes it if it is valid, so every code can only be used once
+func (m *Manager) Use(username, code string) (valid bool, err error) {
+	code = Normalize(code)
+	if code == "" {
+		return
+	}
+	var stored userCodes
+	if err = m.collection.Find(bson.M{"username": username}).One(&stored); err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	for _, hash := range stored.Codes {
+		if !matchesHash(stored.Salt, code, hash) {
+			continue
+		}
+		//Only the request that actually removes the hash can use the code
+		err = m.collection.Update(bson.M{"username": username, "codes": hash}, bson.M{"$pull": bson.M{"codes": hash}})
+		if err == mgo.ErrNotFound {
+			err = nil
+			return
+		}
+		valid = err == nil
+		return
+	}
+	return
+}
+
+//Remove deletes the recovery codes of a user
+func (m *Manager) Remove(username string) error {
+	return m.collection.Remove(bson.M{"username": username})
+}
+
+// IsErrNotFound checks if an error is a mgo.ErrNotFound
+func (m *Manager) IsErrNotFound(err error) bool {
+	return err == mgo.ErrNotFound
+}
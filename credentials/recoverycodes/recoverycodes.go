@@ -0,0 +1,86 @@
+package recoverycodes
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	//NumberOfCodes is the size of a generated batch of recovery codes
+	NumberOfCodes = 10
+	//codeLength is the number of characters of a code, not counting the separator
+	codeLength = 10
+	//alphabet leaves out the characters that are easily confused when written down (0, 1, l and o)
+	alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	//saltLength is the number of random bytes of the salt the codes of a user are hashed with
+	saltLength = 16
+)
+
+//Generate creates a batch of random recovery codes formatted as xxxxx-xxxxx
+func Generate() (codes []string, err error) {
+	codes = make([]string, NumberOfCodes)
+	randomBytes := make([]byte, NumberOfCodes*codeLength)
+	if _, err = rand.Read(randomBytes); err != nil {
+		return
+	}
+	for i := range codes {
+		code := make([]byte, 0, codeLength+1)
+		for j, b := range randomBytes[i*codeLength : (i+1)*codeLength] {
+			if j == codeLength/2 {
+				code = append(code, '-')
+			}
+			//len(alphabet) divides 256 so every character is equally likely
+			code = append(code, alphabet[int(b)%len(alphabet)])
+		}
+		codes[i] = string(code)
+	}
+	return
+}
+
+//Normalize brings a code the user typed in to the generated format
+// Case, whitespace and separators are ignored
+func Normalize(code string) string {
+	normalized := make([]byte, 0, codeLength+1)
+	for _, c := range strings.ToLower(code) {
+		if !strings.ContainsRune(alphabet, c) {
+			if c == '-' || c == ' ' || c == '\t' {
+				continue
+			}
+			return ""
+		}
+		if len(normalized) == codeLength/2 {
+			normalized = append(normalized, '-')
+		}
+		normalized = append(normalized, byte(c))
+	}
+	if len(normalized) != codeLength+1 {
+		return ""
+	}
+	return string(normalized)
+}
+
+//newSalt creates a random salt for a batch of recovery codes
+func newSalt() (salt string, err error) {
+	randomBytes := make([]byte, saltLength)
+	if _, err = rand.Read(randomBytes); err != nil {
+		return
+	}
+	salt = base64.RawStdEncoding.EncodeToString(randomBytes)
+	return
+}
+
+//hashCode returns the hex encoded SHA-256 digest of the salt and a normalized code
+// The codes are random with 50 bits of entropy, unlike passwords they do not need a slow key derivation function
+func hashCode(salt, code string) string {
+	digest := sha256.Sum256([]byte(salt + code))
+	return hex.EncodeToString(digest[:])
+}
+
+//matchesHash checks a normalized code against a stored hash in constant time
+func matchesHash(salt, code, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashCode(salt, code)), []byte(hash)) == 1
+}
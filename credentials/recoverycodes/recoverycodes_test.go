@@ -0,0 +1,49 @@
+package recoverycodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	codes, err := Generate()
+	assert.NoError(t, err)
+	assert.Len(t, codes, NumberOfCodes)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Len(t, code, codeLength+1)
+		assert.Equal(t, code, Normalize(code))
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "abcde-fghij", Normalize("abcde-fghij"))
+	assert.Equal(t, "abcde-fghij", Normalize(" ABCDE fghij "))
+	assert.Equal(t, "abcde-fghij", Normalize("abcdefghij"))
+	assert.Equal(t, "abcde-fghij", Normalize("ab-cdefg-hij"))
+	//Too short or too long
+	assert.Equal(t, "", Normalize("abcde-fghi"))
+	assert.Equal(t, "", Normalize("abcde-fghijk"))
+	//Characters that are never generated
+	assert.Equal(t, "", Normalize("abcde-fghi0"))
+	assert.Equal(t, "", Normalize(""))
+}
+
+func TestHashCode(t *testing.T) {
+	salt, err := newSalt()
+	assert.NoError(t, err)
+	otherSalt, err := newSalt()
+	assert.NoError(t, err)
+	assert.NotEqual(t, salt, otherSalt)
+
+	hash := hashCode(salt, "abcde-fghij")
+	assert.Len(t, hash, 64)
+	assert.True(t, matchesHash(salt, "abcde-fghij", hash))
+	assert.False(t, matchesHash(salt, "abcde-fghik", hash))
+	//The same code of another user has a different hash
+	assert.NotEqual(t, hash, hashCode(otherSalt, "abcde-fghij"))
+	assert.False(t, matchesHash(otherSalt, "abcde-fghij", hash))
+}
@@ -0,0 +1,172 @@
+package throttle
+
+import (
+	"net/http"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+const (
+	mongoCollectionName        = "loginattempts"
+	mongoLockoutCollectionName = "lockouts"
+
+	//failureMemory is how long failed attempts are remembered after the last failure
+	failureMemory = 24 * time.Hour
+	//lockoutMemory is how long the owner of an account can see a lockout
+	lockoutMemory = 30 * 24 * time.Hour
+
+	userKeyPrefix = "user:"
+	ipKeyPrefix   = "ip:"
+)
+
+//attempts counts the consecutive failed attempts for a user or client
+type attempts struct {
+	Key          string
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+}
+
+//Lockout is registered when an account is locked because of too many failed attempts, it is shown to the owner of the account
+type Lockout struct {
+	Username string `json:"-"`
+	//IP is the address of the client that made the last failed attempt
+	IP        string      `json:"ip"`
+	CreatedAt db.DateTime `json:"createdat"`
+	Until     db.DateTime `json:"until"`
+}
+
+// InitModels initializes models in mongo, if required.
+func InitModels() {
+	index := mgo.Index{
+		Key:      []string{"key"},
+		Unique:   true,
+		DropDups: true,
+	}
+	db.EnsureIndex(mongoCollectionName, index)
+
+	automaticExpiration := mgo.Index{
+		Key:         []string{"lastfailure"},
+		ExpireAfter: failureMemory,
+		Background:  true,
+	}
+	db.EnsureIndex(mongoCollectionName, automaticExpiration)
+
+	index = mgo.Index{
+		Key: []string{"username"},
+	}
+	db.EnsureIndex(mongoLockoutCollectionName, index)
+
+	automaticExpiration = mgo.Index{
+		Key:         []string{"createdat"},
+		ExpireAfter: lockoutMemory,
+		Background:  true,
+	}
+	db.EnsureIndex(mongoLockoutCollectionName, automaticExpiration)
+}
+
+//Manager keeps track of failed attempts to guess passwords and codes
+type Manager struct {
+	session           *mgo.Session
+	collection        *mgo.Collection
+	lockoutCollection *mgo.Collection
+}
+
+//NewManager creates a new Manager
+func NewManager(r *http.Request) *Manager {
+	session := db.GetDBSession(r)
+	return &Manager{
+		session:           session,
+		collection:        db.GetCollection(session, mongoCollectionName),
+		lockoutCollection: db.GetCollection(session, mongoLockoutCollectionName),
+	}
+}
+
+//RetryAfter returns how long the user and client need to wait before they can make another attempt
+// Zero is returned if an attempt is allowed. If the username is empty, only the client is checked.
+func (m *Manager) RetryAfter(username, ip string) (wait time.Duration, err error) {
+	keys := []string{ipKeyPrefix + ip}
+	if username != "" {
+		keys = append(keys, userKeyPrefix+username)
+	}
+	var blocked []attempts
+	err = m.collection.Find(bson.M{
+		"key":          bson.M{"$in": keys},
+		"blockeduntil": bson.M{"$gt": time.Now()},
+	}).All(&blocked)
+	for _, a := range blocked {
+		if remaining := a.BlockedUntil.Sub(time.Now()); remaining > wait {
+			wait = remaining
+		}
+	}
+	return
+}
+
+//Failed registers a failed attempt of a client for a user
+// lockout is true if this attempt locked the user, the lockout is stored if the user exists so the owner can see it.
+// If the username is empty, only the client is counted.
+func (m *Manager) Failed(username, ip string, existingUser bool) (lockout bool, err error) {
+	if username != "" {
+		if lockout, err = m.fail(userKeyPrefix+username, UserPolicy); err != nil {
+			return
+		}
+	}
+	if _, err = m.fail(ipKeyPrefix+ip, IPPolicy); err != nil {
+		return
+	}
+	if lockout && existingUser {
+		err = m.saveLockout(username, ip)
+	}
+	return
+}
+
+func (m *Manager) fail(key string, policy Policy) (lockout bool, err error) {
+	now := time.Now()
+	var updated attempts
+	change := mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"failures": 1}, "$set": bson.M{"lastfailure": now}},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+	if _, err = m.collection.Find(bson.M{"key": key}).Apply(change, &updated); err != nil {
+		return
+	}
+	delay, lockout := policy.Delay(updated.Failures)
+	if delay == 0 {
+		return
+	}
+	err = m.collection.Update(bson.M{"key": key}, bson.M{"$set": bson.M{"blockeduntil": now.Add(delay)}})
+	return
+}
+
+//Succeeded forgets the failed attempts for a user after a successful attempt
+// The failures of the client are kept so a valid account can not be used to reset them
+func (m *Manager) Succeeded(username string) error {
+	err := m.collection.Remove(bson.M{"key": userKeyPrefix + username})
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+	return err
+}
+
+//saveLockout registers that a user was locked
+func (m *Manager) saveLockout(username, ip string) error {
+	now := time.Now()
+	return m.lockoutCollection.Insert(&Lockout{
+		Username:  username,
+		IP:        ip,
+		CreatedAt: db.DateTime(now),
+		Until:     db.DateTime(now.Add(UserPolicy.LockoutDuration)),
+	})
+}
+
+//GetLockouts returns the recent lockouts of a user, the most recent one first
+func (m *Manager) GetLockouts(username string) (lockouts []Lockout, err error) {
+	lockouts = []Lockout{}
+	err = m.lockoutCollection.Find(bson.M{"username": username}).Sort("-createdat").All(&lockouts)
+	return
+}
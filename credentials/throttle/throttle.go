@@ -0,0 +1,52 @@
+package throttle
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+//Policy determines how long further attempts are refused after a number of consecutive failures
+// The first FreeAttempts failures are not throttled, after that the delay doubles with every failure,
+// starting at one second. From MaxFailures failures on, every failure locks the key for LockoutDuration.
+type Policy struct {
+	FreeAttempts    int
+	MaxFailures     int
+	LockoutDuration time.Duration
+}
+
+var (
+	//UserPolicy applies to the failed attempts for a single user, from any client
+	UserPolicy = Policy{FreeAttempts: 3, MaxFailures: 10, LockoutDuration: 15 * time.Minute}
+	//IPPolicy applies to the failed attempts from a single client, for any user
+	// It is more lenient since users behind a NAT share an address
+	IPPolicy = Policy{FreeAttempts: 20, MaxFailures: 100, LockoutDuration: 15 * time.Minute}
+)
+
+//Delay returns how long further attempts are refused after the given number of consecutive failures
+// lockout is true if the failures lock the key
+func (p Policy) Delay(failures int) (delay time.Duration, lockout bool) {
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration, true
+	}
+	if failures <= p.FreeAttempts {
+		return 0, false
+	}
+	delay = time.Second
+	for i := p.FreeAttempts + 1; i < failures && delay < p.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > p.LockoutDuration {
+		delay = p.LockoutDuration
+	}
+	return
+}
+
+//ClientIP returns the address of the client that made the request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
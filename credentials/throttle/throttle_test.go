@@ -0,0 +1,44 @@
+package throttle
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	policy := Policy{FreeAttempts: 3, MaxFailures: 10, LockoutDuration: 15 * time.Minute}
+	for failures := 0; failures <= 3; failures++ {
+		delay, lockout := policy.Delay(failures)
+		assert.Equal(t, time.Duration(0), delay)
+		assert.False(t, lockout)
+	}
+	delay, lockout := policy.Delay(4)
+	assert.Equal(t, time.Second, delay)
+	assert.False(t, lockout)
+	delay, _ = policy.Delay(5)
+	assert.Equal(t, 2*time.Second, delay)
+	delay, _ = policy.Delay(9)
+	assert.Equal(t, 32*time.Second, delay)
+
+	delay, lockout = policy.Delay(10)
+	assert.Equal(t, 15*time.Minute, delay)
+	assert.True(t, lockout)
+	//Every failure after the lockout locks again
+	_, lockout = policy.Delay(11)
+	assert.True(t, lockout)
+
+	//The back-off never exceeds the lockout
+	policy = Policy{FreeAttempts: 0, MaxFailures: 100, LockoutDuration: time.Minute}
+	delay, lockout = policy.Delay(50)
+	assert.Equal(t, time.Minute, delay)
+	assert.False(t, lockout)
+}
+
+func TestClientIP(t *testing.T) {
+	assert.Equal(t, "192.0.2.1", ClientIP(&http.Request{RemoteAddr: "192.0.2.1:1234"}))
+	assert.Equal(t, "2001:db8::1", ClientIP(&http.Request{RemoteAddr: "[2001:db8::1]:1234"}))
+	assert.Equal(t, "192.0.2.1", ClientIP(&http.Request{RemoteAddr: "192.0.2.1"}))
+}
@@ -0,0 +1,166 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+//Minimal CBOR (RFC 7049) decoder for the attestation objects and public keys authenticators produce
+// Authenticators use the canonical CBOR encoding, indefinite length items are not supported
+
+//maximumCBORNesting limits the depth of nested arrays and maps
+const maximumCBORNesting = 16
+
+//ErrInvalidCBOR is returned when data is not valid or not supported CBOR
+var ErrInvalidCBOR = errors.New("Invalid or unsupported CBOR data")
+
+//decodeCBOR decodes the first CBOR item in data and returns the remaining bytes
+// Integers are returned as int64, byte strings as []byte, text strings as string,
+// arrays as []interface{} and maps as map[interface{}]interface{}
+func decodeCBOR(data []byte) (value interface{}, rest []byte, err error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (value interface{}, rest []byte, err error) {
+	if len(data) == 0 || depth > maximumCBORNesting {
+		err = ErrInvalidCBOR
+		return
+	}
+	majorType := data[0] >> 5
+	if majorType == 7 {
+		return decodeCBORSimpleValue(data)
+	}
+	argument, rest, err := decodeCBORArgument(data)
+	if err != nil {
+		return
+	}
+	switch majorType {
+	case 0:
+		if argument > math.MaxInt64 {
+			err = ErrInvalidCBOR
+			return
+		}
+		value = int64(argument)
+	case 1:
+		if argument > math.MaxInt64 {
+			err = ErrInvalidCBOR
+			return
+		}
+		value = -1 - int64(argument)
+	case 2, 3:
+		if argument > uint64(len(rest)) {
+			err = ErrInvalidCBOR
+			return
+		}
+		content := rest[:argument]
+		rest = rest[argument:]
+		if majorType == 2 {
+			value = append([]byte(nil), content...)
+		} else {
+			value = string(content)
+		}
+	case 4:
+		//Every item takes at least one byte
+		if argument > uint64(len(rest)) {
+			err = ErrInvalidCBOR
+			return
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			var item interface{}
+			if item, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return
+			}
+			items = append(items, item)
+		}
+		value = items
+	case 5:
+		if argument > uint64(len(rest)) {
+			err = ErrInvalidCBOR
+			return
+		}
+		items := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			var key, item interface{}
+			if key, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				err = ErrInvalidCBOR
+				return
+			}
+			if item, rest, err = decodeCBORItem(rest, depth+1); err != nil {
+				return
+			}
+			items[key] = item
+		}
+		value = items
+	case 6:
+		//Tags only add semantics, the tagged item itself is returned
+		value, rest, err = decodeCBORItem(rest, depth+1)
+	}
+	return
+}
+
+//decodeCBORArgument decodes the length or value that follows the initial byte of an item, indefinite lengths are rejected
+func decodeCBORArgument(data []byte) (argument uint64, rest []byte, err error) {
+	additionalInfo := data[0] & 0x1f
+	rest = data[1:]
+	switch {
+	case additionalInfo < 24:
+		argument = uint64(additionalInfo)
+	case additionalInfo <= 27:
+		size := 1 << (additionalInfo - 24)
+		if len(rest) < size {
+			err = ErrInvalidCBOR
+			return
+		}
+		switch size {
+		case 1:
+			argument = uint64(rest[0])
+		case 2:
+			argument = uint64(binary.BigEndian.Uint16(rest))
+		case 4:
+			argument = uint64(binary.BigEndian.Uint32(rest))
+		case 8:
+			argument = binary.BigEndian.Uint64(rest)
+		}
+		rest = rest[size:]
+	default:
+		err = ErrInvalidCBOR
+	}
+	return
+}
+
+//decodeCBORSimpleValue decodes the booleans, null, undefined and floating point numbers of major type 7
+func decodeCBORSimpleValue(data []byte) (value interface{}, rest []byte, err error) {
+	rest = data[1:]
+	switch data[0] & 0x1f {
+	case 20:
+		value = false
+	case 21:
+		value = true
+	case 22, 23:
+		value = nil
+	case 26:
+		if len(rest) < 4 {
+			err = ErrInvalidCBOR
+			return
+		}
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(rest)))
+		rest = rest[4:]
+	case 27:
+		if len(rest) < 8 {
+			err = ErrInvalidCBOR
+			return
+		}
+		value = math.Float64frombits(binary.BigEndian.Uint64(rest))
+		rest = rest[8:]
+	default:
+		err = ErrInvalidCBOR
+	}
+	return
+}
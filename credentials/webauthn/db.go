@@ -0,0 +1,166 @@
+package webauthn
+
+import (
+	"net/http"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+const (
+	mongoCollectionName          = "webauthn"
+	mongoChallengeCollectionName = "webauthnchallenges"
+
+	//challengeValidity is how long a challenge can be answered, it covers the timeout of the browser
+	challengeValidity = time.Minute * 5
+)
+
+//Ceremonies a challenge can be used for
+const (
+	CeremonyRegistration      = "registration"
+	CeremonyLogin             = "login"
+	CeremonyPasswordlessLogin = "passwordless"
+)
+
+//Credential is a webauthn public key credential registered by a user
+type Credential struct {
+	Username string `json:"-"`
+	//ID is the base64url encoded credential id
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	//PublicKey is the DER encoded PKIX public key
+	PublicKey []byte `json:"-"`
+	SignCount uint32 `json:"-"`
+	//Passwordless credentials verify the user themselves and can replace the password and second factor
+	Passwordless bool         `json:"passwordless"`
+	CreatedAt    db.DateTime  `json:"createdat"`
+	LastUsed     *db.DateTime `json:"lastused,omitempty" bson:"lastused,omitempty"`
+}
+
+//Challenge is an outstanding challenge of a registration or login ceremony
+type Challenge struct {
+	Username  string
+	Challenge string
+	Ceremony  string
+	//Passwordless is set if a passwordless credential is being registered
+	Passwordless bool
+	CreatedAt    time.Time
+}
+
+// InitModels initializes models in mongo, if required.
+func InitModels() {
+	index := mgo.Index{
+		Key:      []string{"id"},
+		Unique:   true,
+		DropDups: false,
+	}
+	db.EnsureIndex(mongoCollectionName, index)
+
+	index = mgo.Index{
+		Key: []string{"username"},
+	}
+	db.EnsureIndex(mongoCollectionName, index)
+
+	automaticExpiration := mgo.Index{
+		Key:         []string{"createdat"},
+		ExpireAfter: challengeValidity,
+		Background:  true,
+	}
+	db.EnsureIndex(mongoChallengeCollectionName, automaticExpiration)
+}
+
+//Manager stores the webauthn credentials and challenges
+type Manager struct {
+	session             *mgo.Session
+	collection          *mgo.Collection
+	challengeCollection *mgo.Collection
+}
+
+//NewManager creates a new Manager
+func NewManager(r *http.Request) *Manager {
+	session := db.GetDBSession(r)
+	return &Manager{
+		session:             session,
+		collection:          db.GetCollection(session, mongoCollectionName),
+		challengeCollection: db.GetCollection(session, mongoChallengeCollectionName),
+	}
+}
+
+//GetCredentials returns the credentials of a user
+func (m *Manager) GetCredentials(username string) (credentials []Credential, err error) {
+	credentials = []Credential{}
+	err = m.collection.Find(bson.M{"username": username}).Sort("createdat").All(&credentials)
+	return
+}
+
+//GetPasswordlessCredentials returns the credentials a user can log in with without a password
+func (m *Manager) GetPasswordlessCredentials(username string) (credentials []Credential, err error) {
+	credentials = []Credential{}
+	err = m.collection.Find(bson.M{"username": username, "passwordless": true}).Sort("createdat").All(&credentials)
+	return
+}
+
+//GetCredential returns a credential of a user, nil is returned if it does not exist
+func (m *Manager) GetCredential(username, id string) (credential *Credential, err error) {
+	err = m.collection.Find(bson.M{"username": username, "id": id}).One(&credential)
+	if err == mgo.ErrNotFound {
+		err = nil
+		credential = nil
+	}
+	return
+}
+
+//HasCredentials checks if a user registered at least one credential
+func (m *Manager) HasCredentials(username string) (hascredentials bool, err error) {
+	count, err := m.collection.Find(bson.M{"username": username}).Count()
+	hascredentials = count != 0
+	return
+}
+
+//Save stores a new credential
+func (m *Manager) Save(credential *Credential) error {
+	return m.collection.Insert(credential)
+}
+
+//UpdateSignCount stores the signature counter and last use of a credential after a successful assertion
+func (m *Manager) UpdateSignCount(username, id string, signCount uint32) error {
+	return m.collection.Update(bson.M{"username": username, "id": id}, bson.M{"$set": bson.M{"signcount": signCount, "lastused": db.DateTime(time.Now())}})
+}
+
+//Remove deletes a credential of a user
+func (m *Manager) Remove(username, id string) error {
+	return m.collection.Remove(bson.M{"username": username, "id": id})
+}
+
+//SaveChallenge stores a challenge until it is answered or expires
+func (m *Manager) SaveChallenge(challenge *Challenge) error {
+	return m.challengeCollection.Insert(challenge)
+}
+
+//ConsumeChallenge removes and returns an outstanding challenge so it can only be answered once
+// nil is returned if the challenge does not exist, is expired or was issued for another user or ceremony
+func (m *Manager) ConsumeChallenge(username, challenge, ceremony string) (outstanding *Challenge, err error) {
+	outstanding = &Challenge{}
+	_, err = m.challengeCollection.Find(bson.M{"username": username, "challenge": challenge, "ceremony": ceremony}).Apply(mgo.Change{Remove: true}, outstanding)
+	if err == mgo.ErrNotFound || (err == nil && time.Since(outstanding.CreatedAt) > challengeValidity) {
+		err = nil
+		outstanding = nil
+	}
+	if err != nil {
+		outstanding = nil
+	}
+	return
+}
+
+// IsErrNotFound checks if an error is a mgo.ErrNotFound
+func (m *Manager) IsErrNotFound(err error) bool {
+	return err == mgo.ErrNotFound
+}
+
+//IsDuplicate checks if an error is caused by registering the same credential twice
+func (m *Manager) IsDuplicate(err error) bool {
+	return mgo.IsDup(err)
+}
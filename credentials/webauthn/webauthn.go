@@ -0,0 +1,432 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+)
+
+//WebAuthn (FIDO2) registration and authentication ceremonies
+// See https://www.w3.org/TR/webauthn/
+// The attestation statement of the authenticator is not verified, attestation "none" is requested
+
+const (
+	//relyingPartyName is shown by the browser when registering a credential
+	relyingPartyName = "ItsYou.Online"
+	//Timeout is the number of milliseconds the browser waits for the user to use the authenticator
+	Timeout = 120000
+
+	//UserVerificationRequired makes the authenticator verify the user with a pin or biometrics
+	UserVerificationRequired = "required"
+	//UserVerificationDiscouraged only requires the user to touch the authenticator
+	UserVerificationDiscouraged = "discouraged"
+
+	clientDataTypeCreate = "webauthn.create"
+	clientDataTypeGet    = "webauthn.get"
+
+	//COSE algorithm identifiers of the supported public keys
+	algorithmES256 = -7
+	algorithmRS256 = -257
+)
+
+//Flags of the authenticator data
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+var (
+	//ErrInvalidClientData is returned when the client data is malformed or does not match the ceremony, challenge or origin
+	ErrInvalidClientData = errors.New("Invalid webauthn client data")
+	//ErrInvalidAuthenticatorData is returned when the authenticator data or attestation object is malformed or is meant for another relying party
+	ErrInvalidAuthenticatorData = errors.New("Invalid webauthn authenticator data")
+	//ErrUserNotPresent is returned when the authenticator did not check the user is present
+	ErrUserNotPresent = errors.New("The user was not present")
+	//ErrUserNotVerified is returned when user verification is required but the authenticator did not verify the user
+	ErrUserNotVerified = errors.New("The user was not verified")
+	//ErrUnsupportedKey is returned when the credential public key is not an ES256 or RS256 key
+	ErrUnsupportedKey = errors.New("Unsupported webauthn credential public key")
+	//ErrInvalidSignature is returned when the assertion signature does not verify
+	ErrInvalidSignature = errors.New("Invalid webauthn assertion signature")
+	//ErrSignCount is returned when the signature counter did not increase, this indicates a cloned authenticator
+	ErrSignCount = errors.New("The webauthn signature counter did not increase")
+)
+
+//RelyingParty identifies the site the credentials are scoped to
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+//DefaultOrigin is the origin of the development environment
+const DefaultOrigin = "https://dev.itsyou.online:8443"
+
+//relyingParty is configured once at startup, the Host header of a request can not be trusted to identify the site
+var relyingParty = RelyingParty{ID: "dev.itsyou.online", Name: relyingPartyName, Origin: DefaultOrigin}
+
+//NewRelyingParty creates the relying party for the origin the website is served on
+// If id is empty, the hostname of the origin is used. Otherwise it needs to be the hostname or a parent domain of it.
+func NewRelyingParty(id, origin string) (rp RelyingParty, err error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return
+	}
+	if u.Scheme != "https" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		err = fmt.Errorf("invalid webauthn origin %q, expected https://host[:port]", origin)
+		return
+	}
+	hostname := u.Host
+	if h, _, splitErr := net.SplitHostPort(hostname); splitErr == nil {
+		hostname = h
+	}
+	if id == "" {
+		id = hostname
+	}
+	if id != hostname && !strings.HasSuffix(hostname, "."+id) {
+		err = fmt.Errorf("the webauthn relying party id %q is not the hostname of the origin %q or a parent domain of it", id, origin)
+		return
+	}
+	rp = RelyingParty{ID: id, Name: relyingPartyName, Origin: u.Scheme + "://" + u.Host}
+	return
+}
+
+//SetRelyingParty sets the relying party all credentials are registered and verified for
+func SetRelyingParty(rp RelyingParty) {
+	relyingParty = rp
+}
+
+//GetRelyingParty returns the configured relying party
+func GetRelyingParty() RelyingParty {
+	return relyingParty
+}
+
+//NewChallenge creates a random challenge, base64url encoded without padding like browsers put it in the client data
+func NewChallenge() (challenge string, err error) {
+	randombytes := make([]byte, 32)
+	if _, err = rand.Read(randombytes); err != nil {
+		return
+	}
+	challenge = base64.RawURLEncoding.EncodeToString(randombytes)
+	return
+}
+
+//DecodeBase64URL decodes the base64url encoded binary values the browser sends, padding is optional
+func DecodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+//CredentialDescriptor identifies a credential in the creation and request options
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+//CreationOptions are the options for navigator.credentials.create, binary values are base64url encoded
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		AuthenticatorAttachment string `json:"authenticatorAttachment,omitempty"`
+		RequireResidentKey      bool   `json:"requireResidentKey"`
+		UserVerification        string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type credentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int    `json:"alg"`
+}
+
+//RequestOptions are the options for navigator.credentials.get, binary values are base64url encoded
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+//NewCreationOptions creates the options to register a new credential
+// A passwordless credential needs to be a platform authenticator that verifies the user
+func NewCreationOptions(rp RelyingParty, username, challenge string, existingCredentials []Credential, passwordless bool) *CreationOptions {
+	options := &CreationOptions{
+		Challenge:          challenge,
+		PubKeyCredParams:   []credentialParameter{{Type: "public-key", Algorithm: algorithmES256}, {Type: "public-key", Algorithm: algorithmRS256}},
+		Timeout:            Timeout,
+		ExcludeCredentials: descriptors(existingCredentials),
+		Attestation:        "none",
+	}
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	//The user handle should not contain personal information
+	userHandle := sha256.Sum256([]byte(username))
+	options.User.ID = base64.RawURLEncoding.EncodeToString(userHandle[:])
+	options.User.Name = username
+	options.User.DisplayName = username
+	options.AuthenticatorSelection.UserVerification = UserVerificationDiscouraged
+	if passwordless {
+		options.AuthenticatorSelection.AuthenticatorAttachment = "platform"
+		options.AuthenticatorSelection.UserVerification = UserVerificationRequired
+	}
+	return options
+}
+
+//NewRequestOptions creates the options to authenticate with one of the credentials
+func NewRequestOptions(rp RelyingParty, challenge string, credentials []Credential, userVerification string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(credentials),
+		UserVerification: userVerification,
+	}
+}
+
+func descriptors(credentials []Credential) []CredentialDescriptor {
+	descriptors := make([]CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, CredentialDescriptor{Type: "public-key", ID: credential.ID})
+	}
+	return descriptors
+}
+
+//clientData is the part of the CollectedClientData the relying party checks
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+//ChallengeFromClientData returns the challenge the browser signed, it still needs to be verified
+func ChallengeFromClientData(clientDataJSON []byte) (challenge string, err error) {
+	var data clientData
+	if err = json.Unmarshal(clientDataJSON, &data); err != nil || data.Challenge == "" {
+		err = ErrInvalidClientData
+		return
+	}
+	challenge = data.Challenge
+	return
+}
+
+func verifyClientData(clientDataJSON []byte, ceremonyType string, rp RelyingParty, challenge string) (err error) {
+	var data clientData
+	if err = json.Unmarshal(clientDataJSON, &data); err != nil {
+		return ErrInvalidClientData
+	}
+	if data.Type != ceremonyType || data.Challenge != challenge || data.Origin != rp.Origin {
+		return ErrInvalidClientData
+	}
+	return
+}
+
+//authenticatorData is the parsed binary authenticator data
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (parsed *authenticatorData, err error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	parsed = &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if parsed.Flags&flagAttestedCredentialData == 0 {
+		return
+	}
+	//16 bytes aaguid, 2 bytes credential id length, credential id, cose public key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || len(rest) < idLength {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	parsed.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidAuthenticatorData
+	}
+	parsed.PublicKey = rest[:len(rest)-len(extensions)]
+	return
+}
+
+func (data *authenticatorData) verify(rp RelyingParty, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.RPIDHash, rpIDHash[:]) {
+		return ErrInvalidAuthenticatorData
+	}
+	if data.Flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUserVerification && data.Flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+//VerifyRegistration checks the response of navigator.credentials.create and returns the new credential
+// The username and label of the returned credential are not set
+func VerifyRegistration(rp RelyingParty, challenge string, clientDataJSON, attestationObject []byte, requireUserVerification bool) (credential *Credential, err error) {
+	if err = verifyClientData(clientDataJSON, clientDataTypeCreate, rp, challenge); err != nil {
+		return
+	}
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		err = ErrInvalidAuthenticatorData
+		return
+	}
+	attestation, _ := decoded.(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return
+	}
+	if err = authData.verify(rp, requireUserVerification); err != nil {
+		return
+	}
+	if authData.CredentialID == nil {
+		err = ErrInvalidAuthenticatorData
+		return
+	}
+	publicKey, err := parseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return
+	}
+	credential = &Credential{
+		ID:           base64.RawURLEncoding.EncodeToString(authData.CredentialID),
+		PublicKey:    der,
+		SignCount:    authData.SignCount,
+		Passwordless: requireUserVerification,
+	}
+	return
+}
+
+//VerifyAssertion checks the response of navigator.credentials.get for a stored credential and returns the new signature counter
+func VerifyAssertion(rp RelyingParty, challenge string, credential *Credential, clientDataJSON, rawAuthData, signature []byte, requireUserVerification bool) (signCount uint32, err error) {
+	if err = verifyClientData(clientDataJSON, clientDataTypeGet, rp, challenge); err != nil {
+		return
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return
+	}
+	if err = authData.verify(rp, requireUserVerification); err != nil {
+		return
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(credential.PublicKey)
+	if err != nil {
+		return
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...))
+	if err = verifySignature(publicKey, digest[:], signature); err != nil {
+		return
+	}
+	//Authenticators that do not support a counter always return 0
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		err = ErrSignCount
+		return
+	}
+	signCount = authData.SignCount
+	return
+}
+
+func verifySignature(publicKey interface{}, digest, signature []byte) error {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(signature, &ecdsaSignature); err != nil || len(rest) != 0 {
+			return ErrInvalidSignature
+		}
+		if !ecdsa.Verify(key, digest, ecdsaSignature.R, ecdsaSignature.S) {
+			return ErrInvalidSignature
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) != nil {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedKey
+	}
+	return nil
+}
+
+//parseCOSEKey converts an ES256 or RS256 COSE key (RFC 8152) to a public key
+func parseCOSEKey(data []byte) (publicKey interface{}, err error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, ErrUnsupportedKey
+	}
+	coseKey, _ := decoded.(map[interface{}]interface{})
+	keyType, _ := coseKey[int64(1)].(int64)
+	algorithm, _ := coseKey[int64(3)].(int64)
+	switch {
+	case keyType == 2 && algorithm == algorithmES256:
+		curve, _ := coseKey[int64(-1)].(int64)
+		x, _ := coseKey[int64(-2)].([]byte)
+		y, _ := coseKey[int64(-3)].([]byte)
+		if curve != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		publicKey = key
+	case keyType == 3 && algorithm == algorithmRS256:
+		n, _ := coseKey[int64(-1)].([]byte)
+		e, _ := coseKey[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return
+}
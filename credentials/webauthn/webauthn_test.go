@@ -0,0 +1,218 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testRelyingParty = RelyingParty{ID: "dev.itsyou.online", Name: relyingPartyName, Origin: "https://dev.itsyou.online:8443"}
+
+//cborHeader encodes the initial bytes of a CBOR item with a length or value that fits in 2 bytes
+func cborHeader(majorType byte, argument int) []byte {
+	switch {
+	case argument < 24:
+		return []byte{majorType<<5 | byte(argument)}
+	case argument < 256:
+		return []byte{majorType<<5 | 24, byte(argument)}
+	default:
+		return []byte{majorType<<5 | 25, byte(argument >> 8), byte(argument)}
+	}
+}
+
+func cborInt(i int) []byte {
+	if i < 0 {
+		return cborHeader(1, -1-i)
+	}
+	return cborHeader(0, i)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHeader(2, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHeader(3, len(s)), s...)
+}
+
+func cborMap(items ...[]byte) []byte {
+	encoded := cborHeader(5, len(items)/2)
+	for _, item := range items {
+		encoded = append(encoded, item...)
+	}
+	return encoded
+}
+
+func coseKey(publicKey *ecdsa.PublicKey) []byte {
+	size := (publicKey.Curve.Params().BitSize + 7) / 8
+	x := make([]byte, size)
+	y := make([]byte, size)
+	publicKey.X.FillBytes(x)
+	publicKey.Y.FillBytes(y)
+	return cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(algorithmES256), cborInt(-1), cborInt(1), cborInt(-2), cborBytes(x), cborInt(-3), cborBytes(y))
+}
+
+func authenticatorDataBytes(rpID string, flags byte, signCount uint32, credentialID []byte, publicKey *ecdsa.PublicKey) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, signCount)
+	data = append(data, counter...)
+	if credentialID != nil {
+		data = append(data, make([]byte, 16)...)
+		data = append(data, byte(len(credentialID)>>8), byte(len(credentialID)))
+		data = append(data, credentialID...)
+		data = append(data, coseKey(publicKey)...)
+	}
+	return data
+}
+
+func clientDataJSON(ceremonyType, challenge, origin string) []byte {
+	data, _ := json.Marshal(clientData{Type: ceremonyType, Challenge: challenge, Origin: origin})
+	return data
+}
+
+func sign(key *ecdsa.PrivateKey, authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, _ := key.Sign(rand.Reader, digest[:], nil)
+	return signature
+}
+
+func register(t *testing.T, key *ecdsa.PrivateKey, flags byte) (*Credential, error) {
+	challenge, err := NewChallenge()
+	assert.NoError(t, err)
+	authData := authenticatorDataBytes(testRelyingParty.ID, flags|flagAttestedCredentialData, 1, []byte("credential1"), &key.PublicKey)
+	attestationObject := cborMap(cborText("fmt"), cborText("none"), cborText("attStmt"), cborMap(), cborText("authData"), cborBytes(authData))
+	return VerifyRegistration(testRelyingParty, challenge, clientDataJSON(clientDataTypeCreate, challenge, testRelyingParty.Origin), attestationObject, flags&flagUserVerified != 0)
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	value, rest, err := decodeCBOR(append(cborMap(cborInt(-7), cborText("alg"), cborText("x"), cborBytes([]byte{1, 2})), 0xff))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xff}, rest)
+	assert.Equal(t, map[interface{}]interface{}{int64(-7): "alg", "x": []byte{1, 2}}, value)
+
+	value, _, err = decodeCBOR(cborInt(1000))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), value)
+
+	//Truncated byte string
+	_, _, err = decodeCBOR([]byte{0x45, 0x01})
+	assert.Equal(t, ErrInvalidCBOR, err)
+	//Indefinite length array
+	_, _, err = decodeCBOR([]byte{0x9f, 0x01, 0xff})
+	assert.Equal(t, ErrInvalidCBOR, err)
+	//Nesting too deep
+	nested := make([]byte, maximumCBORNesting+2)
+	for i := range nested {
+		nested[i] = 0x81
+	}
+	_, _, err = decodeCBOR(nested)
+	assert.Equal(t, ErrInvalidCBOR, err)
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credential, err := register(t, key, flagUserPresent)
+	assert.NoError(t, err)
+	if !assert.NotNil(t, credential) {
+		return
+	}
+	assert.Equal(t, "Y3JlZGVudGlhbDE", credential.ID)
+	assert.Equal(t, uint32(1), credential.SignCount)
+	assert.False(t, credential.Passwordless)
+
+	challenge, _ := NewChallenge()
+	clientData := clientDataJSON(clientDataTypeGet, challenge, testRelyingParty.Origin)
+	authData := authenticatorDataBytes(testRelyingParty.ID, flagUserPresent, 2, nil, nil)
+	signature := sign(key, authData, clientData)
+
+	extracted, err := ChallengeFromClientData(clientData)
+	assert.NoError(t, err)
+	assert.Equal(t, challenge, extracted)
+
+	signCount, err := VerifyAssertion(testRelyingParty, challenge, credential, clientData, authData, signature, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), signCount)
+
+	//User verification is required for a passwordless login
+	_, err = VerifyAssertion(testRelyingParty, challenge, credential, clientData, authData, signature, true)
+	assert.Equal(t, ErrUserNotVerified, err)
+
+	//Another challenge
+	otherChallenge, _ := NewChallenge()
+	_, err = VerifyAssertion(testRelyingParty, otherChallenge, credential, clientData, authData, signature, false)
+	assert.Equal(t, ErrInvalidClientData, err)
+
+	//Another origin
+	phishingData := clientDataJSON(clientDataTypeGet, challenge, "https://itsyou.online.example.com")
+	_, err = VerifyAssertion(testRelyingParty, challenge, credential, phishingData, authData, sign(key, authData, phishingData), false)
+	assert.Equal(t, ErrInvalidClientData, err)
+
+	//Another relying party
+	otherRPData := authenticatorDataBytes("example.com", flagUserPresent, 2, nil, nil)
+	_, err = VerifyAssertion(testRelyingParty, challenge, credential, clientData, otherRPData, sign(key, otherRPData, clientData), false)
+	assert.Equal(t, ErrInvalidAuthenticatorData, err)
+
+	//Signed by another key
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, err = VerifyAssertion(testRelyingParty, challenge, credential, clientData, authData, sign(otherKey, authData, clientData), false)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	//The signature counter needs to increase
+	credential.SignCount = 2
+	_, err = VerifyAssertion(testRelyingParty, challenge, credential, clientData, authData, signature, false)
+	assert.Equal(t, ErrSignCount, err)
+}
+
+func TestPasswordlessRegistration(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credential, err := register(t, key, flagUserPresent|flagUserVerified)
+	assert.NoError(t, err)
+	if assert.NotNil(t, credential) {
+		assert.True(t, credential.Passwordless)
+	}
+
+	_, err = register(t, key, 0)
+	assert.Equal(t, ErrUserNotPresent, err)
+}
+
+func TestRegistrationWithUnsupportedKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, err := register(t, key, flagUserPresent)
+	assert.Equal(t, ErrUnsupportedKey, err)
+}
+
+func TestNewRelyingParty(t *testing.T) {
+	rp, err := NewRelyingParty("", "https://itsyou.online")
+	assert.NoError(t, err)
+	assert.Equal(t, RelyingParty{ID: "itsyou.online", Name: relyingPartyName, Origin: "https://itsyou.online"}, rp)
+
+	rp, err = NewRelyingParty("", "https://dev.itsyou.online:8443/")
+	assert.NoError(t, err)
+	assert.Equal(t, "dev.itsyou.online", rp.ID)
+	assert.Equal(t, "https://dev.itsyou.online:8443", rp.Origin)
+
+	rp, err = NewRelyingParty("itsyou.online", "https://dev.itsyou.online:8443")
+	assert.NoError(t, err)
+	assert.Equal(t, "itsyou.online", rp.ID)
+
+	for _, invalid := range [][2]string{
+		{"", "http://itsyou.online"},
+		{"", "itsyou.online"},
+		{"", "https://itsyou.online/login"},
+		{"other.com", "https://itsyou.online"},
+		{"you.online", "https://itsyou.online"},
+	} {
+		_, err = NewRelyingParty(invalid[0], invalid[1])
+		assert.Error(t, err, invalid[1])
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -23,6 +24,20 @@ func EnsureIndex(collectionName string, index mgo.Index) {
 	}
 }
 
+//DropIndex removes an index that is no longer needed, it is not an error if the index does not exist
+func DropIndex(collectionName string, key ...string) {
+	session := GetSession()
+	defer session.Close()
+
+	c := GetCollection(session, collectionName)
+
+	if err := c.DropIndex(key...); err == nil {
+		log.Infof("Dropped index %v of collection \"%s\"", key, collectionName)
+	} else if !strings.Contains(err.Error(), "index not found") {
+		log.Errorf("Failed to drop index %v of collection \"%s\": %s", key, collectionName, err.Error())
+	}
+}
+
 //GetCollection return collection.
 func GetCollection(session *mgo.Session, collectionName string) *mgo.Collection {
 	return session.DB(DB_NAME).C(collectionName)
@@ -0,0 +1,80 @@
+package organization
+
+import (
+	"regexp"
+)
+
+const (
+	//ClaimSourceUserRegistry takes the value of a claim from the registry of the user the jwt is issued for
+	ClaimSourceUserRegistry = "userregistry"
+	//ClaimSourceOrganizationRegistry takes the value of a claim from the registry of the organization
+	ClaimSourceOrganizationRegistry = "organizationregistry"
+)
+
+//maximumNumberOfTemplateClaims is the maximum number of custom claims an organization can add to its jwt's
+const maximumNumberOfTemplateClaims = 20
+
+var claimNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z\d_\-\.]{0,63}$`)
+
+//reservedClaims are set by itsyou.online itself and can not be overwritten by a claims template
+var reservedClaims = map[string]bool{
+	"iss":           true,
+	"sub":           true,
+	"aud":           true,
+	"azp":           true,
+	"exp":           true,
+	"nbf":           true,
+	"iat":           true,
+	"jti":           true,
+	"scope":         true,
+	"username":      true,
+	"globalid":      true,
+	"refresh_token": true,
+	"act":           true,
+	"may_act":       true,
+	"nonce":         true,
+	"auth_time":     true,
+	"acr":           true,
+	"amr":           true,
+	"cnf":           true,
+}
+
+//IsReservedClaim checks if a claim is set by itsyou.online itself
+func IsReservedClaim(name string) bool {
+	return reservedClaims[name]
+}
+
+//JWTClaimsTemplate describes the custom claims and the audience of the jwt's handed out to an organization
+type JWTClaimsTemplate struct {
+	//RequiredAudience is always added to the aud claim of the jwt's of the organization
+	RequiredAudience string          `json:"requiredaudience,omitempty" bson:"requiredaudience,omitempty"`
+	Claims           []TemplateClaim `json:"claims"`
+}
+
+//TemplateClaim is a custom claim of which the value is taken from a registry entry
+type TemplateClaim struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Key    string `json:"key"`
+}
+
+//IsValid checks the claims template, the claim names need to be unique and can not be one of the claims itsyou.online sets
+func (template *JWTClaimsTemplate) IsValid() bool {
+	if len(template.RequiredAudience) > 256 || len(template.Claims) > maximumNumberOfTemplateClaims {
+		return false
+	}
+	names := map[string]bool{}
+	for _, claim := range template.Claims {
+		if !claimNameRegex.MatchString(claim.Name) || reservedClaims[claim.Name] || names[claim.Name] {
+			return false
+		}
+		if claim.Source != ClaimSourceUserRegistry && claim.Source != ClaimSourceOrganizationRegistry {
+			return false
+		}
+		if claim.Key == "" || len(claim.Key) > 256 {
+			return false
+		}
+		names[claim.Name] = true
+	}
+	return true
+}
@@ -11,16 +11,19 @@ import (
 )
 
 type Organization struct {
-	DNS              []string        `json:"dns"`
-	Globalid         string          `json:"globalid"`
-	Members          []string        `json:"members"`
-	Owners           []string        `json:"owners"`
-	PublicKeys       []string        `json:"publicKeys"`
-	SecondsValidity  int             `json:"secondsvalidity"`
-	OrgOwners        []string        `json:"orgowners"`  //OrgOwners are other organizations that are owner of this organization
-	OrgMembers       []string        `json:"orgmembers"` //OrgMembers are other organizations that are member of this organization
-	RequiredScopes   []RequiredScope `json:"requiredscopes"`
-	IncludeSubOrgsOf []string        `json:"includesuborgsof"`
+	DNS                 []string        `json:"dns"`
+	Globalid            string          `json:"globalid"`
+	Members             []string        `json:"members"`
+	Owners              []string        `json:"owners"`
+	PublicKeys          []string        `json:"publicKeys"`
+	SecondsValidity     int             `json:"secondsvalidity"`
+	AccessTokenValidity int             `json:"accesstokenvalidity"` //AccessTokenValidity is the lifetime in seconds of the access tokens handed out to this organization, 0 means the default lifetime
+	OrgOwners           []string        `json:"orgowners"`           //OrgOwners are other organizations that are owner of this organization
+	OrgMembers          []string        `json:"orgmembers"`          //OrgMembers are other organizations that are member of this organization
+	RequiredScopes      []RequiredScope `json:"requiredscopes"`
+	IncludeSubOrgsOf    []string        `json:"includesuborgsof"`
+	//JWTClaimsTemplate holds the custom claims and required audience of the jwt's handed out to this organization
+	JWTClaimsTemplate *JWTClaimsTemplate `json:"-" bson:"jwtclaimstemplate,omitempty"`
 }
 
 // IsValid performs basic validation on the content of an organizations fields
@@ -40,6 +43,7 @@ func (org *Organization) ConvertToView(usrMgr *user.Manager, valMgr *validation.
 	view.Globalid = org.Globalid
 	view.PublicKeys = org.PublicKeys
 	view.SecondsValidity = org.SecondsValidity
+	view.AccessTokenValidity = org.AccessTokenValidity
 	view.OrgOwners = org.OrgOwners
 	view.OrgMembers = org.OrgMembers
 	view.RequiredScopes = org.RequiredScopes
@@ -155,14 +159,15 @@ func ConvertIdentifierToUsername(identifier string, valMgr *validation.Manager)
 }
 
 type OrganizationView struct {
-	DNS              []string        `json:"dns"`
-	Globalid         string          `json:"globalid"`
-	Members          []string        `json:"members"`
-	Owners           []string        `json:"owners"`
-	PublicKeys       []string        `json:"publicKeys"`
-	SecondsValidity  int             `json:"secondsvalidity"`
-	OrgOwners        []string        `json:"orgowners"`  //OrgOwners are other organizations that are owner of this organization
-	OrgMembers       []string        `json:"orgmembers"` //OrgMembers are other organizations that are member of this organization
-	RequiredScopes   []RequiredScope `json:"requiredscopes"`
-	IncludeSubOrgsOf []string        `json:"includesuborgsof"`
+	DNS                 []string        `json:"dns"`
+	Globalid            string          `json:"globalid"`
+	Members             []string        `json:"members"`
+	Owners              []string        `json:"owners"`
+	PublicKeys          []string        `json:"publicKeys"`
+	SecondsValidity     int             `json:"secondsvalidity"`
+	AccessTokenValidity int             `json:"accesstokenvalidity"` //AccessTokenValidity is the lifetime in seconds of the access tokens handed out to this organization, 0 means the default lifetime
+	OrgOwners           []string        `json:"orgowners"`           //OrgOwners are other organizations that are owner of this organization
+	OrgMembers          []string        `json:"orgmembers"`          //OrgMembers are other organizations that are member of this organization
+	RequiredScopes      []RequiredScope `json:"requiredscopes"`
+	IncludeSubOrgsOf    []string        `json:"includesuborgsof"`
 }
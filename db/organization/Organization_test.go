@@ -26,3 +26,36 @@ func TestOrganizationValidation(t *testing.T) {
 		assert.Equal(t, test.valid, test.org.IsValid(), test.org.Globalid)
 	}
 }
+
+func TestJWTClaimsTemplateValidation(t *testing.T) {
+	type testcase struct {
+		template *JWTClaimsTemplate
+		valid    bool
+	}
+	claim := func(name, source, key string) TemplateClaim {
+		return TemplateClaim{Name: name, Source: source, Key: key}
+	}
+	testcases := []testcase{
+		{template: &JWTClaimsTemplate{}, valid: true},
+		{template: &JWTClaimsTemplate{RequiredAudience: "api.example.com"}, valid: true},
+		{template: &JWTClaimsTemplate{RequiredAudience: strings.Repeat("a", 257)}, valid: false},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("employeeid", ClaimSourceUserRegistry, "employee")}}, valid: true},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("tenant", ClaimSourceOrganizationRegistry, "tenant")}}, valid: true},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("username", ClaimSourceUserRegistry, "name")}}, valid: false},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("a b", ClaimSourceUserRegistry, "name")}}, valid: false},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("name", "other", "name")}}, valid: false},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("name", ClaimSourceUserRegistry, "")}}, valid: false},
+		{template: &JWTClaimsTemplate{Claims: []TemplateClaim{claim("name", ClaimSourceUserRegistry, "a"), claim("name", ClaimSourceUserRegistry, "b")}}, valid: false},
+	}
+	for i, test := range testcases {
+		assert.Equal(t, test.valid, test.template.IsValid(), "testcase %d", i)
+	}
+}
+
+func TestJWTClaimsTemplateReservedClaims(t *testing.T) {
+	//Claims about the authentication, the actor and the key the token is bound to can not be forged by an organization
+	for _, name := range []string{"iss", "sub", "aud", "exp", "scope", "username", "act", "may_act", "nonce", "auth_time", "acr", "amr", "cnf"} {
+		template := &JWTClaimsTemplate{Claims: []TemplateClaim{{Name: name, Source: ClaimSourceUserRegistry, Key: "key"}}}
+		assert.False(t, template.IsValid(), name)
+	}
+}
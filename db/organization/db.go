@@ -872,6 +872,48 @@ func (m *Manager) SetValidity(globalID string, secondsDuration int) error {
 		bson.M{"$set": bson.M{"secondsvalidity": secondsDuration}})
 }
 
+// GetAccessTokenValidity gets the lifetime of the access tokens of an organization in seconds, 0 means the default lifetime
+func (m *Manager) GetAccessTokenValidity(globalID string) (int, error) {
+	var org Organization
+	err := m.collection.Find(bson.M{"globalid": globalID}).Select(bson.M{"accesstokenvalidity": 1}).One(&org)
+	return org.AccessTokenValidity, err
+}
+
+// SetAccessTokenValidity sets the lifetime of the access tokens of an organization in seconds, 0 restores the default lifetime
+func (m *Manager) SetAccessTokenValidity(globalID string, secondsDuration int) error {
+	return m.collection.Update(
+		bson.M{"globalid": globalID},
+		bson.M{"$set": bson.M{"accesstokenvalidity": secondsDuration}})
+}
+
+// GetPublicKeys gets the PEM encoded public keys of an organization
+func (m *Manager) GetPublicKeys(globalID string) ([]string, error) {
+	var org Organization
+	err := m.collection.Find(bson.M{"globalid": globalID}).Select(bson.M{"publickeys": 1}).One(&org)
+	return org.PublicKeys, err
+}
+
+// SetPublicKeys replaces the public keys of an organization
+func (m *Manager) SetPublicKeys(globalID string, publicKeys []string) error {
+	return m.collection.Update(
+		bson.M{"globalid": globalID},
+		bson.M{"$set": bson.M{"publickeys": publicKeys}})
+}
+
+// GetJWTClaimsTemplate gets the claims template of the jwt's of an organization, nil is returned if there is none
+func (m *Manager) GetJWTClaimsTemplate(globalID string) (*JWTClaimsTemplate, error) {
+	var org Organization
+	err := m.collection.Find(bson.M{"globalid": globalID}).Select(bson.M{"jwtclaimstemplate": 1}).One(&org)
+	return org.JWTClaimsTemplate, err
+}
+
+// SetJWTClaimsTemplate replaces the claims template of the jwt's of an organization
+func (m *Manager) SetJWTClaimsTemplate(globalID string, template *JWTClaimsTemplate) error {
+	return m.collection.Update(
+		bson.M{"globalid": globalID},
+		bson.M{"$set": bson.M{"jwtclaimstemplate": template}})
+}
+
 // SaveLogo save or update logo
 func (m *LogoManager) SaveLogo(globalID string, logo string) (*mgo.ChangeInfo, error) {
 	return m.collection.Upsert(
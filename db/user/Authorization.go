@@ -96,6 +96,11 @@ func (authorization Authorization) FilterAuthorizedScopes(requestedscopes []stri
 		if scope == "user:see" && authorization.See {
 			authorizedScopes = append(authorizedScopes, scope)
 		}
+		// The openid and offline_access scopes only mark an OpenID Connect request or a request for a refresh token,
+		// they do not give access to any information by themselves
+		if scope == "openid" || scope == "offline_access" {
+			authorizedScopes = append(authorizedScopes, scope)
+		}
 	}
 
 	return
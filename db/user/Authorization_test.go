@@ -23,6 +23,9 @@ func TestScopesAreAuthorized(t *testing.T) {
 		testcase{a: Authorization{Github: true}, s: "user:github", authorized: true},
 		testcase{a: Authorization{}, s: "user:facebook", authorized: false},
 		testcase{a: Authorization{Facebook: true}, s: "user:facebook", authorized: true},
+		testcase{a: Authorization{}, s: "openid", authorized: true},
+		testcase{a: Authorization{Name: true}, s: "openid, user:name", authorized: true},
+		testcase{a: Authorization{Name: true}, s: "offline_access, user:name", authorized: true},
 
 		testcase{a: Authorization{Addresses: []AuthorizationMap{AuthorizationMap{RealLabel: "home", RequestedLabel: "billing"}}}, s: "user:address:billing", authorized: true},
 		testcase{a: Authorization{Addresses: []AuthorizationMap{AuthorizationMap{RealLabel: "home", RequestedLabel: "billing"}}}, s: "user:address:home", authorized: false},
@@ -0,0 +1,81 @@
+package user
+
+import (
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+)
+
+//MaxConsentValidity is the longest a consent with an expiry can be valid, a consent without an expiry stays valid until the authorization is removed
+const MaxConsentValidity = 365 * 24 * time.Hour
+
+// Consent records the decision of a user on the authorize page of a client
+// Every time a user gives consent, a new record is added so the history is kept
+type Consent struct {
+	Username  string         `json:"username"`
+	ClientID  string         `json:"clientid"`
+	GrantedAt db.DateTime    `json:"grantedat"`
+	ExpiresAt *db.DateTime   `json:"expiresat,omitempty" bson:"expiresat,omitempty"`
+	Scopes    []ScopeConsent `json:"scopes"`
+}
+
+// ScopeConsent is the approval or refusal of a single requested scope
+type ScopeConsent struct {
+	Scope    string `json:"scope"`
+	Approved bool   `json:"approved"`
+	//DecidedAt is the time the user approved or declined the scope, this is before the consent was granted
+	// if the decision is taken over from an earlier consent
+	DecidedAt db.DateTime `json:"decidedat"`
+}
+
+//IsExpired checks if the consent has lapsed, a consent without an expiry never lapses
+func (consent *Consent) IsExpired(now time.Time) bool {
+	return consent.ExpiresAt != nil && !time.Time(*consent.ExpiresAt).After(now)
+}
+
+//IsDeclined checks if the user explicitly declined a scope in this consent
+func (consent *Consent) IsDeclined(scope string) bool {
+	for _, scopeConsent := range consent.Scopes {
+		if scopeConsent.Scope == scope {
+			return !scopeConsent.Approved
+		}
+	}
+	return false
+}
+
+//FilterDeclinedScopes removes the scopes the user declined from the requested scopes
+func (consent *Consent) FilterDeclinedScopes(requestedScopes []string) (scopes []string) {
+	scopes = make([]string, 0, len(requestedScopes))
+	for _, scope := range requestedScopes {
+		if !consent.IsDeclined(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return
+}
+
+//MergePrevious takes over the decisions of an earlier consent for the scopes that were not asked again
+// When a client requests additional scopes, the user only decides on the new ones
+func (consent *Consent) MergePrevious(previous *Consent) {
+PREVIOUSSCOPES:
+	for _, previousScope := range previous.Scopes {
+		for _, scopeConsent := range consent.Scopes {
+			if scopeConsent.Scope == previousScope.Scope {
+				continue PREVIOUSSCOPES
+			}
+		}
+		consent.Scopes = append(consent.Scopes, previousScope)
+	}
+}
+
+//NewlyApprovedScopes returns the scopes the user approved when granting this consent,
+// leaving out the decisions taken over from earlier consents
+func (consent *Consent) NewlyApprovedScopes() (scopes []string) {
+	scopes = []string{}
+	for _, scopeConsent := range consent.Scopes {
+		if scopeConsent.Approved && !time.Time(scopeConsent.DecidedAt).Before(time.Time(consent.GrantedAt)) {
+			scopes = append(scopes, scopeConsent.Scope)
+		}
+	}
+	return
+}
@@ -0,0 +1,36 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsentMergePrevious(t *testing.T) {
+	earlier := db.DateTime(time.Now().Add(-time.Hour))
+	now := db.DateTime(time.Now())
+	previous := &Consent{
+		GrantedAt: earlier,
+		Scopes: []ScopeConsent{
+			{Scope: "user:name", Approved: true, DecidedAt: earlier},
+			{Scope: "user:email:main", Approved: false, DecidedAt: earlier},
+		},
+	}
+	consent := &Consent{
+		GrantedAt: now,
+		Scopes: []ScopeConsent{
+			{Scope: "user:email:main", Approved: true, DecidedAt: now},
+			{Scope: "user:phone", Approved: true, DecidedAt: now},
+			{Scope: "user:github", Approved: false, DecidedAt: now},
+		},
+	}
+	consent.MergePrevious(previous)
+
+	assert.Len(t, consent.Scopes, 4)
+	assert.False(t, consent.IsDeclined("user:email:main"))
+	assert.True(t, consent.IsDeclined("user:github"))
+	assert.Equal(t, []string{"user:email:main", "user:phone"}, consent.NewlyApprovedScopes())
+	assert.Equal(t, []string{"user:name", "user:email:main", "user:phone"}, consent.FilterDeclinedScopes([]string{"user:name", "user:email:main", "user:phone", "user:github"}))
+}
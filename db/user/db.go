@@ -16,6 +16,7 @@ const (
 	mongoUsersCollectionName          = "users"
 	mongoAvatarFileCollectionName     = "avatarfiles"
 	mongoAuthorizationsCollectionName = "authorizations"
+	mongoConsentsCollectionName       = "consents"
 )
 
 //InitModels initialize models in mongo, if required.
@@ -47,6 +48,11 @@ func InitModels() {
 		Key: []string{"emailaddresses.emailaddress"},
 	}
 	db.EnsureIndex(mongoUsersCollectionName, emailIndex)
+
+	consentIndex := mgo.Index{
+		Key: []string{"username", "clientid", "-grantedat"},
+	}
+	db.EnsureIndex(mongoConsentsCollectionName, consentIndex)
 }
 
 //Manager is used to store users
@@ -70,6 +76,10 @@ func (m *Manager) getAuthorizationCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoAuthorizationsCollectionName)
 }
 
+func (m *Manager) getConsentCollection() *mgo.Collection {
+	return db.GetCollection(m.session, mongoConsentsCollectionName)
+}
+
 func (m *Manager) getAvatarFileCollection() *mgo.Collection {
 	return db.GetCollection(m.session, mongoAvatarFileCollectionName)
 }
@@ -158,7 +168,11 @@ func (m *Manager) Delete(u *User) error {
 		return errors.New("User not stored")
 	}
 
-	return m.getUserCollection().RemoveId(u.ID)
+	if err := m.getUserCollection().RemoveId(u.ID); err != nil {
+		return err
+	}
+	_, err := m.getConsentCollection().RemoveAll(bson.M{"username": u.Username})
+	return err
 }
 
 // SaveEmail save or update email along with its label
@@ -319,15 +333,49 @@ func (m *Manager) UpdateAuthorization(authorization *Authorization) (err error)
 	return
 }
 
-//DeleteAuthorization removes an authorization
+//DeleteAuthorization removes an authorization and the consents the user gave to the organization
+// Otherwise the declined scopes of the old consents would be taken over when the user authorizes the organization again
 func (m *Manager) DeleteAuthorization(username, organization string) (err error) {
 	_, err = m.getAuthorizationCollection().RemoveAll(bson.M{"username": username, "grantedto": organization})
+	if err != nil {
+		return
+	}
+	_, err = m.getConsentCollection().RemoveAll(bson.M{"username": username, "clientid": organization})
+	return
+}
+
+//SaveConsent adds a consent record
+func (m *Manager) SaveConsent(consent *Consent) error {
+	return m.getConsentCollection().Insert(consent)
+}
+
+//GetLatestConsent returns the most recent consent the user gave to a client, nil if the user never gave consent
+func (m *Manager) GetLatestConsent(username, clientID string) (consent *Consent, err error) {
+	err = m.getConsentCollection().Find(bson.M{"username": username, "clientid": clientID}).Sort("-grantedat").One(&consent)
+	if err == mgo.ErrNotFound {
+		err = nil
+	} else if err != nil {
+		consent = nil
+	}
 	return
 }
 
-//DeleteAllAuthorizations removes all authorizations from an organization
+//GetConsents returns the consent history of a user for a client, the most recent consent first
+func (m *Manager) GetConsents(username, clientID string) (consents []Consent, err error) {
+	err = m.getConsentCollection().Find(bson.M{"username": username, "clientid": clientID}).Sort("-grantedat").All(&consents)
+	if consents == nil {
+		consents = []Consent{}
+	}
+	return
+}
+
+//DeleteAllAuthorizations removes all authorizations and consents from an organization
 func (m *Manager) DeleteAllAuthorizations(organization string) (err error) {
 	_, err = m.getAuthorizationCollection().RemoveAll(bson.M{"grantedto": organization})
+	if err != nil {
+		return
+	}
+	_, err = m.getConsentCollection().RemoveAll(bson.M{"clientid": organization})
 	return err
 }
 
@@ -26,3 +26,6 @@ package main
 
 // ## Email templates ##
 //go:generate go-bindata -pkg templates -prefix templates/templates -o templates/packaged/templates.go templates/templates/...
+
+// ## Breached passwords ##
+//go:generate go-bindata -pkg breachedpasswords -prefix credentials/password/breachedpasswords -o credentials/password/packaged/breachedpasswords.go credentials/password/breachedpasswords/...
@@ -79,3 +79,10 @@ func (m *Manager) Delete(key string) error {
 
 	return m.collection.Remove(config)
 }
+
+// Upsert inserts a config key or updates its value if it already exists
+func (m *Manager) Upsert(c *GlobalConfig) error {
+	_, err := m.collection.Upsert(bson.M{"key": c.Key}, c)
+
+	return err
+}
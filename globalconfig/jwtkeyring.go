@@ -0,0 +1,198 @@
+package globalconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	//JWTKeyRingKey is the config key under which the jwt signing keys are stored
+	JWTKeyRingKey = "jwtkeyring"
+	//LegacyJWTKeyKey is the config key of the single pem encoded jwt signing key used before key rotation was supported
+	LegacyJWTKeyKey = "jwtkey"
+)
+
+var (
+	//ErrJWTKeyNotFound is returned when a key id is not in the key ring
+	ErrJWTKeyNotFound = errors.New("No jwt key with this kid in the key ring")
+	//ErrActiveJWTKey is returned when the active signing key is retired
+	ErrActiveJWTKey = errors.New("The active jwt signing key can not be retired, promote another key first")
+	//ErrNoActiveJWTKey is returned when the key ring does not have an active signing key
+	ErrNoActiveJWTKey = errors.New("The jwt key ring has no active signing key")
+)
+
+//JWTKey is a jwt signing key in the key ring
+type JWTKey struct {
+	KeyID string `json:"kid"`
+	//PrivateKey is the pem encoded ecdsa private key
+	PrivateKey string    `json:"privatekey"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"createdat"`
+}
+
+//JWTKeyRing holds all keys jwt's are verified with, only the active key is used to sign new jwt's
+//The other keys are upcoming keys that are published before they are promoted and retired keys that are kept until the jwt's they signed are expired
+type JWTKeyRing struct {
+	Keys []JWTKey `json:"keys"`
+	//LegacyKeyID is the kid of the single signing key used before key rotation was supported
+	//The jwt's it signed have no kid header, they are verified with this key as long as it is in the key ring
+	LegacyKeyID string `json:"legacykid,omitempty"`
+}
+
+//NewJWTKeyRingFromPEM creates a key ring with a single active key from the key used before key rotation was supported
+func NewJWTKeyRingFromPEM(pemKey []byte) (keyRing *JWTKeyRing, err error) {
+	privateKey, err := jwt.ParseECPrivateKeyFromPEM(pemKey)
+	if err != nil {
+		return
+	}
+	kid := oauth2.JWTKeyID(&privateKey.PublicKey)
+	keyRing = &JWTKeyRing{
+		Keys: []JWTKey{{
+			KeyID:      kid,
+			PrivateKey: string(pemKey),
+			Active:     true,
+			CreatedAt:  time.Now(),
+		}},
+		LegacyKeyID: kid,
+	}
+	return
+}
+
+//Generate adds a new ES384 key to the key ring
+//The new key only becomes the signing key if the key ring is empty, otherwise it needs to be promoted
+func (keyRing *JWTKeyRing) Generate() (key *JWTKey, err error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return
+	}
+	keyRing.Keys = append(keyRing.Keys, JWTKey{
+		KeyID:      oauth2.JWTKeyID(&privateKey.PublicKey),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		Active:     len(keyRing.Keys) == 0,
+		CreatedAt:  time.Now(),
+	})
+	key = &keyRing.Keys[len(keyRing.Keys)-1]
+	return
+}
+
+//Promote makes a key the active signing key
+func (keyRing *JWTKeyRing) Promote(kid string) (err error) {
+	if keyRing.find(kid) == nil {
+		return ErrJWTKeyNotFound
+	}
+	for i := range keyRing.Keys {
+		keyRing.Keys[i].Active = keyRing.Keys[i].KeyID == kid
+	}
+	return
+}
+
+//Retire removes a key from the key ring, jwt's signed with it are no longer valid
+func (keyRing *JWTKeyRing) Retire(kid string) (err error) {
+	key := keyRing.find(kid)
+	if key == nil {
+		return ErrJWTKeyNotFound
+	}
+	if key.Active {
+		return ErrActiveJWTKey
+	}
+	keys := make([]JWTKey, 0, len(keyRing.Keys)-1)
+	for _, key := range keyRing.Keys {
+		if key.KeyID != kid {
+			keys = append(keys, key)
+		}
+	}
+	keyRing.Keys = keys
+	if keyRing.LegacyKeyID == kid {
+		keyRing.LegacyKeyID = ""
+	}
+	return
+}
+
+//SigningKey returns the active key and its kid
+func (keyRing *JWTKeyRing) SigningKey() (privateKey *ecdsa.PrivateKey, kid string, err error) {
+	for _, key := range keyRing.Keys {
+		if key.Active {
+			privateKey, err = jwt.ParseECPrivateKeyFromPEM([]byte(key.PrivateKey))
+			kid = key.KeyID
+			return
+		}
+	}
+	err = ErrNoActiveJWTKey
+	return
+}
+
+//VerificationKeys returns the public keys of all keys in the key ring
+// jwt's without a kid header are only verified with the legacy key, never with the active key
+func (keyRing *JWTKeyRing) VerificationKeys() (keys *oauth2.JWTVerificationKeys, err error) {
+	keys = &oauth2.JWTVerificationKeys{Keys: map[string]*ecdsa.PublicKey{}, LegacyKeyID: keyRing.LegacyKeyID}
+	hasActiveKey := false
+	for _, key := range keyRing.Keys {
+		var privateKey *ecdsa.PrivateKey
+		privateKey, err = jwt.ParseECPrivateKeyFromPEM([]byte(key.PrivateKey))
+		if err != nil {
+			return
+		}
+		keys.Keys[key.KeyID] = &privateKey.PublicKey
+		hasActiveKey = hasActiveKey || key.Active
+	}
+	if !hasActiveKey {
+		err = ErrNoActiveJWTKey
+	}
+	return
+}
+
+func (keyRing *JWTKeyRing) find(kid string) *JWTKey {
+	for i := range keyRing.Keys {
+		if keyRing.Keys[i].KeyID == kid {
+			return &keyRing.Keys[i]
+		}
+	}
+	return nil
+}
+
+//GetJWTKeyRing loads the jwt key ring
+//If there is no key ring yet but a single jwt key is configured, a key ring with this key as the active key is returned
+//If no key is configured at all, nil is returned
+func (m *Manager) GetJWTKeyRing() (keyRing *JWTKeyRing, err error) {
+	config, err := m.GetByKey(JWTKeyRingKey)
+	if err == nil {
+		keyRing = &JWTKeyRing{}
+		err = json.Unmarshal([]byte(config.Value), keyRing)
+		return
+	}
+	if err != mgo.ErrNotFound {
+		return
+	}
+	config, err = m.GetByKey(LegacyJWTKeyKey)
+	if err == mgo.ErrNotFound {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	return NewJWTKeyRingFromPEM([]byte(config.Value))
+}
+
+//SaveJWTKeyRing stores the jwt key ring
+func (m *Manager) SaveJWTKeyRing(keyRing *JWTKeyRing) (err error) {
+	value, err := json.Marshal(keyRing)
+	if err != nil {
+		return
+	}
+	return m.Upsert(&GlobalConfig{Key: JWTKeyRingKey, Value: string(value)})
+}
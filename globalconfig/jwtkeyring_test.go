@@ -0,0 +1,104 @@
+package globalconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTKeyRingRotation(t *testing.T) {
+	keyRing := &JWTKeyRing{}
+	_, _, err := keyRing.SigningKey()
+	assert.Equal(t, ErrNoActiveJWTKey, err)
+
+	// The first key becomes the signing key
+	firstKey, err := keyRing.Generate()
+	assert.NoError(t, err)
+	assert.True(t, firstKey.Active)
+	firstKID := firstKey.KeyID
+
+	// Additional keys are only used for verification until they are promoted
+	secondKey, err := keyRing.Generate()
+	assert.NoError(t, err)
+	assert.False(t, secondKey.Active)
+	secondKID := secondKey.KeyID
+
+	_, kid, err := keyRing.SigningKey()
+	assert.NoError(t, err)
+	assert.Equal(t, firstKID, kid)
+	keys, err := keyRing.VerificationKeys()
+	assert.NoError(t, err)
+	assert.Len(t, keys.Keys, 2)
+	assert.Empty(t, keys.LegacyKeyID)
+
+	assert.Equal(t, ErrJWTKeyNotFound, keyRing.Promote("unknown"))
+	assert.NoError(t, keyRing.Promote(secondKID))
+	_, kid, err = keyRing.SigningKey()
+	assert.NoError(t, err)
+	assert.Equal(t, secondKID, kid)
+
+	assert.Equal(t, ErrActiveJWTKey, keyRing.Retire(secondKID))
+	assert.NoError(t, keyRing.Retire(firstKID))
+	assert.Equal(t, ErrJWTKeyNotFound, keyRing.Retire(firstKID))
+	keys, err = keyRing.VerificationKeys()
+	assert.NoError(t, err)
+	assert.Len(t, keys.Keys, 1)
+	assert.Empty(t, keys.LegacyKeyID)
+}
+
+func TestNewJWTKeyRingFromPEM(t *testing.T) {
+	generated := &JWTKeyRing{}
+	key, _ := generated.Generate()
+
+	keyRing, err := NewJWTKeyRingFromPEM([]byte(key.PrivateKey))
+	assert.NoError(t, err)
+	_, kid, err := keyRing.SigningKey()
+	assert.NoError(t, err)
+	assert.Equal(t, key.KeyID, kid)
+
+	_, err = NewJWTKeyRingFromPEM([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+func TestLegacyJWTKeyAfterRotation(t *testing.T) {
+	generated := &JWTKeyRing{}
+	legacyKey, _ := generated.Generate()
+	keyRing, err := NewJWTKeyRingFromPEM([]byte(legacyKey.PrivateKey))
+	assert.NoError(t, err)
+	assert.Equal(t, legacyKey.KeyID, keyRing.LegacyKeyID)
+
+	// A jwt issued before key rotation was supported has no kid header
+	legacyPrivateKey, _, err := keyRing.SigningKey()
+	assert.NoError(t, err)
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	legacyJWT, err := token.SignedString(legacyPrivateKey)
+	assert.NoError(t, err)
+
+	newKey, err := keyRing.Generate()
+	assert.NoError(t, err)
+	assert.NoError(t, keyRing.Promote(newKey.KeyID))
+	keys, err := keyRing.VerificationKeys()
+	assert.NoError(t, err)
+	_, err = oauth2.ParseJWT(legacyJWT, keys)
+	assert.NoError(t, err)
+
+	// A jwt without a kid signed by the active key is not accepted
+	newPrivateKey, _, err := keyRing.SigningKey()
+	assert.NoError(t, err)
+	forged, err := token.SignedString(newPrivateKey)
+	assert.NoError(t, err)
+	_, err = oauth2.ParseJWT(forged, keys)
+	assert.Error(t, err)
+
+	// Once the legacy key is retired, jwt's without a kid are no longer valid
+	assert.NoError(t, keyRing.Retire(legacyKey.KeyID))
+	assert.Empty(t, keyRing.LegacyKeyID)
+	keys, err = keyRing.VerificationKeys()
+	assert.NoError(t, err)
+	_, err = oauth2.ParseJWT(legacyJWT, keys)
+	assert.Error(t, err)
+}
@@ -2,29 +2,75 @@ package organization
 
 import (
 	"regexp"
+	"time"
 
 	"github.com/itsyouonline/identityserver/oauthservice"
 	"gopkg.in/validator.v2"
 )
 
 type APIKey struct {
-	CallbackURL                string `json:"callbackURL,omitempty" validate:"max=250"`
-	ClientCredentialsGrantType bool   `json:"clientCredentialsGrantType,omitempty"`
-	Label                      string `json:"label" validate:"min=2,max=50, pattern=^[a-zA-Z\d\-_\s]{2,50}$"`
-	Secret                     string `json:"secret,omitempty" validate:"max=250,nonzero"`
+	CallbackURL                        string   `json:"callbackURL,omitempty" validate:"max=250"`
+	AdditionalCallbackURLs             []string `json:"additionalCallbackURLs,omitempty" validate:"max=20"`
+	WildcardCallbackURLs               bool     `json:"wildcardCallbackURLs,omitempty"`
+	LoopbackCallbackURLs               bool     `json:"loopbackCallbackURLs,omitempty"`
+	ClientCredentialsGrantType         bool     `json:"clientCredentialsGrantType,omitempty"`
+	PublicClient                       bool     `json:"publicClient,omitempty"`
+	PrivateKeyJWT                      bool     `json:"privateKeyJWT,omitempty"`
+	PasswordGrantType                  bool     `json:"passwordGrantType,omitempty"`
+	JWTBearerGrantType                 bool     `json:"jwtBearerGrantType,omitempty"`
+	RequirePushedAuthorizationRequests bool     `json:"requirePushedAuthorizationRequests,omitempty"`
+	Label                              string   `json:"label" validate:"min=2,max=50, pattern=^[a-zA-Z\d\-_\s]{2,50}$"`
+	Secret                             string   `json:"secret,omitempty" validate:"max=250,nonzero"`
+	//PreviousSecretExpires and PreviousSecretLastUsed report on a secret rotation, they are ignored when creating or updating an api key
+	PreviousSecretExpires  *time.Time `json:"previousSecretExpires,omitempty"`
+	PreviousSecretLastUsed *time.Time `json:"previousSecretLastUsed,omitempty"`
 }
 
-//FromOAuthClient creates an APIKey instance from an oauthservice.Oauth2Client
+// FromOAuthClient creates an APIKey instance from an oauthservice.Oauth2Client
 func FromOAuthClient(client *oauthservice.Oauth2Client) APIKey {
 	apiKey := APIKey{
-		CallbackURL:                client.CallbackURL,
-		ClientCredentialsGrantType: client.ClientCredentialsGrantType,
-		Label:  client.Label,
-		Secret: client.Secret,
+		CallbackURL:                        client.CallbackURL,
+		AdditionalCallbackURLs:             client.AdditionalCallbackURLs,
+		WildcardCallbackURLs:               client.WildcardCallbackURLs,
+		LoopbackCallbackURLs:               client.LoopbackCallbackURLs,
+		ClientCredentialsGrantType:         client.ClientCredentialsGrantType,
+		PublicClient:                       client.PublicClient,
+		PrivateKeyJWT:                      client.PrivateKeyJWT,
+		PasswordGrantType:                  client.PasswordGrantType,
+		JWTBearerGrantType:                 client.JWTBearerGrantType,
+		RequirePushedAuthorizationRequests: client.RequirePushedAuthorizationRequests,
+		Label:                              client.Label,
+		Secret:                             client.Secret,
+	}
+	if client.PreviousSecret != "" {
+		apiKey.PreviousSecretExpires = &client.PreviousSecretExpires
+		if !client.PreviousSecretLastUsed.IsZero() {
+			apiKey.PreviousSecretLastUsed = &client.PreviousSecretLastUsed
+		}
 	}
 	return apiKey
 }
 
 func (a APIKey) Validate() bool {
+	for _, callbackURL := range a.AdditionalCallbackURLs {
+		if len(callbackURL) > 250 {
+			return false
+		}
+	}
 	return validator.Validate(a) == nil && regexp.MustCompile(`^[a-zA-Z\d\-_\s]{2,50}$`).MatchString(a.Label)
 }
+
+// applyTo copies the label, callback urls and grant type properties of the api key to an oauth client
+func (a APIKey) applyTo(client *oauthservice.Oauth2Client) {
+	client.Label = a.Label
+	client.CallbackURL = a.CallbackURL
+	client.AdditionalCallbackURLs = a.AdditionalCallbackURLs
+	client.WildcardCallbackURLs = a.WildcardCallbackURLs
+	client.LoopbackCallbackURLs = a.LoopbackCallbackURLs
+	client.ClientCredentialsGrantType = a.ClientCredentialsGrantType
+	client.PublicClient = a.PublicClient
+	client.PrivateKeyJWT = a.PrivateKeyJWT
+	client.PasswordGrantType = a.PasswordGrantType
+	client.JWTBearerGrantType = a.JWTBearerGrantType
+	client.RequirePushedAuthorizationRequests = a.RequirePushedAuthorizationRequests
+}
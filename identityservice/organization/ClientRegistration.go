@@ -0,0 +1,235 @@
+package organization
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/itsyouonline/identityserver/oauthservice"
+)
+
+//Dynamic client registration
+// See https://tools.ietf.org/html/rfc7591 and https://tools.ietf.org/html/rfc7592
+
+// Token endpoint authentication methods a registered client can use
+const (
+	tokenEndpointAuthMethodBasic = "client_secret_basic"
+	tokenEndpointAuthMethodPost  = "client_secret_post"
+	tokenEndpointAuthMethodNone  = "none"
+	tokenEndpointAuthMethodJWT   = "private_key_jwt"
+)
+
+// Error codes returned by the client registration endpoints
+const (
+	errorInvalidRedirectURI    = "invalid_redirect_uri"
+	errorInvalidClientMetadata = "invalid_client_metadata"
+)
+
+const maxRegisteredRedirectURIs = 21
+
+var clientNameRegex = regexp.MustCompile(`^[a-zA-Z\d\-_\s]{2,50}$`)
+
+// registrationGrantTypes are the grant types a client can register for
+var registrationGrantTypes = map[string]bool{
+	"authorization_code":                        true,
+	oauthservice.ClientCredentialsGrantCodeType: true,
+	oauthservice.RefreshTokenGrantType:          true,
+	oauthservice.DeviceCodeGrantType:            true,
+	oauthservice.TokenExchangeGrantType:         true,
+	oauthservice.PasswordGrantType:              true,
+	oauthservice.JWTBearerGrantType:             true,
+}
+
+// ClientMetadata is the metadata of a dynamically registered oauth client
+// The client name is used as the label of the api key
+type ClientMetadata struct {
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	//RequirePushedAuthorizationRequests only allows authorize requests with a request_uri from the par endpoint
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+	//ClientID and ClientSecret are only used in an update, if present they need to match the registered client
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// ClientInformation is the response of the client registration and client configuration endpoints
+type ClientInformation struct {
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientSecretExpiresAt   int64    `json:"client_secret_expires_at"`
+	RegistrationClientURI   string   `json:"registration_client_uri"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	//RequirePushedAuthorizationRequests is true if the client can only start an authorization with a request_uri from the par endpoint
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests"`
+}
+
+// registrationError is an error in the client metadata
+type registrationError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func writeRegistrationError(w http.ResponseWriter, err *registrationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(err)
+}
+
+// Validate checks the metadata and fills in the defaults for the omitted grant types, response types and authentication method
+func (m *ClientMetadata) Validate() *registrationError {
+	if !clientNameRegex.MatchString(m.ClientName) {
+		return &registrationError{errorInvalidClientMetadata, "client_name should be 2 to 50 alphanumeric characters, spaces, dashes or underscores"}
+	}
+	if len(m.GrantTypes) == 0 {
+		m.GrantTypes = []string{"authorization_code"}
+	}
+	if len(m.ResponseTypes) == 0 {
+		m.ResponseTypes = []string{oauthservice.AuthorizationGrantCodeType}
+	}
+	if m.TokenEndpointAuthMethod == "" {
+		m.TokenEndpointAuthMethod = tokenEndpointAuthMethodBasic
+	}
+
+	authorizationCode := false
+	clientCredentials := false
+	trustedGrant := false
+	for _, grantType := range m.GrantTypes {
+		if !registrationGrantTypes[grantType] {
+			return &registrationError{errorInvalidClientMetadata, "unsupported grant type " + grantType}
+		}
+		authorizationCode = authorizationCode || grantType == "authorization_code"
+		clientCredentials = clientCredentials || grantType == oauthservice.ClientCredentialsGrantCodeType
+		trustedGrant = trustedGrant || grantType == oauthservice.PasswordGrantType || grantType == oauthservice.JWTBearerGrantType
+	}
+	for _, responseType := range m.ResponseTypes {
+		if responseType != oauthservice.AuthorizationGrantCodeType {
+			return &registrationError{errorInvalidClientMetadata, "unsupported response type " + responseType}
+		}
+	}
+	switch m.TokenEndpointAuthMethod {
+	case tokenEndpointAuthMethodBasic, tokenEndpointAuthMethodPost, tokenEndpointAuthMethodJWT:
+	case tokenEndpointAuthMethodNone:
+		if clientCredentials || trustedGrant {
+			return &registrationError{errorInvalidClientMetadata, "a public client can not use the client credentials, password or jwt bearer grant"}
+		}
+	default:
+		return &registrationError{errorInvalidClientMetadata, "unsupported token endpoint authentication method " + m.TokenEndpointAuthMethod}
+	}
+
+	if authorizationCode && len(m.RedirectURIs) == 0 {
+		return &registrationError{errorInvalidRedirectURI, "redirect_uris are required for the authorization code grant"}
+	}
+	if len(m.RedirectURIs) > maxRegisteredRedirectURIs {
+		return &registrationError{errorInvalidRedirectURI, "too many redirect_uris"}
+	}
+	for _, redirectURI := range m.RedirectURIs {
+		if !isValidRegistrationURI(redirectURI) {
+			return &registrationError{errorInvalidRedirectURI, "invalid redirect uri " + redirectURI}
+		}
+	}
+	if m.LogoURI != "" && !isValidRegistrationURI(m.LogoURI) {
+		return &registrationError{errorInvalidClientMetadata, "invalid logo_uri"}
+	}
+	return nil
+}
+
+// isValidRegistrationURI checks that a uri is absolute, without a fragment and not longer than an api key callback url can be
+func isValidRegistrationURI(uri string) bool {
+	if len(uri) > 250 {
+		return false
+	}
+	parsedURI, err := url.Parse(uri)
+	return err == nil && parsedURI.IsAbs() && parsedURI.Host != "" && parsedURI.Fragment == ""
+}
+
+// applyTo copies the metadata to an oauth client, the first redirect uri is used as the callback url
+func (m *ClientMetadata) applyTo(client *oauthservice.Oauth2Client) {
+	client.Label = m.ClientName
+	client.CallbackURL = ""
+	client.AdditionalCallbackURLs = nil
+	if len(m.RedirectURIs) > 0 {
+		client.CallbackURL = m.RedirectURIs[0]
+		client.AdditionalCallbackURLs = m.RedirectURIs[1:]
+	}
+	client.LogoURI = m.LogoURI
+	client.PublicClient = m.TokenEndpointAuthMethod == tokenEndpointAuthMethodNone
+	client.PrivateKeyJWT = m.TokenEndpointAuthMethod == tokenEndpointAuthMethodJWT
+	client.RequirePushedAuthorizationRequests = m.RequirePushedAuthorizationRequests
+	client.ClientCredentialsGrantType = false
+	client.PasswordGrantType = false
+	client.JWTBearerGrantType = false
+	for _, grantType := range m.GrantTypes {
+		switch grantType {
+		case oauthservice.ClientCredentialsGrantCodeType:
+			client.ClientCredentialsGrantType = true
+		case oauthservice.PasswordGrantType:
+			client.PasswordGrantType = true
+		case oauthservice.JWTBearerGrantType:
+			client.JWTBearerGrantType = true
+		}
+	}
+}
+
+// clientConfigurationURI is the location where the registered client can be read, updated or deleted
+func clientConfigurationURI(r *http.Request, client *oauthservice.Oauth2Client) string {
+	configurationURI := url.URL{
+		Scheme: "https",
+		Host:   r.Host,
+		Path:   "/api/organizations/" + client.ClientID + "/clients/" + client.Label,
+	}
+	return configurationURI.String()
+}
+
+// newClientInformation describes a registered oauth client
+// The secret is not returned for public clients and clients that authenticate using a client assertion
+func newClientInformation(client *oauthservice.Oauth2Client, configurationURI string) *ClientInformation {
+	info := &ClientInformation{
+		ClientID:                           client.ClientID,
+		ClientSecret:                       client.Secret,
+		RegistrationClientURI:              configurationURI,
+		ClientName:                         client.Label,
+		RedirectURIs:                       client.RegisteredCallbackURLs(),
+		GrantTypes:                         []string{},
+		ResponseTypes:                      []string{oauthservice.AuthorizationGrantCodeType},
+		LogoURI:                            client.LogoURI,
+		TokenEndpointAuthMethod:            tokenEndpointAuthMethodBasic,
+		RequirePushedAuthorizationRequests: client.RequirePushedAuthorizationRequests,
+	}
+	if client.CallbackURL != "" {
+		info.GrantTypes = append(info.GrantTypes, "authorization_code", oauthservice.RefreshTokenGrantType)
+	}
+	if client.ClientCredentialsGrantType {
+		info.GrantTypes = append(info.GrantTypes, oauthservice.ClientCredentialsGrantCodeType)
+	}
+	if client.PasswordGrantType {
+		info.GrantTypes = append(info.GrantTypes, oauthservice.PasswordGrantType)
+	}
+	if client.JWTBearerGrantType {
+		info.GrantTypes = append(info.GrantTypes, oauthservice.JWTBearerGrantType)
+	}
+	if client.PublicClient {
+		info.ClientSecret = ""
+		info.TokenEndpointAuthMethod = tokenEndpointAuthMethodNone
+	} else if client.PrivateKeyJWT {
+		info.ClientSecret = ""
+		info.TokenEndpointAuthMethod = tokenEndpointAuthMethodJWT
+	}
+	return info
+}
+
+func writeClientInformation(w http.ResponseWriter, status int, info *ClientInformation) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(info)
+}
@@ -16,6 +16,7 @@ import (
 	"encoding/base64"
 
 	"github.com/gorilla/context"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
 	"github.com/itsyouonline/identityserver/db"
 	contractdb "github.com/itsyouonline/identityserver/db/contract"
 	"github.com/itsyouonline/identityserver/db/organization"
@@ -33,6 +34,7 @@ const (
 	itsyouonlineGlobalID                      = "itsyouonline"
 	maximumNumberOfOrganizationsPerUser       = 1000
 	maximumNumberOfInvitationsPerOrganization = 10000
+	maximumNumberOfPublicKeys                 = 20
 	DefaultLanguage                           = "en"
 )
 
@@ -783,6 +785,7 @@ func (api OrganizationsAPI) CreateNewAPIKey(w http.ResponseWriter, r *http.Reque
 
 	log.Debug("Creating apikey:", apiKey)
 	c := oauthservice.NewOauth2Client(globalID, apiKey.Label, apiKey.CallbackURL, apiKey.ClientCredentialsGrantType)
+	apiKey.applyTo(c)
 
 	mgr := oauthservice.NewManager(r)
 	err := mgr.CreateClient(c)
@@ -836,7 +839,8 @@ func (api OrganizationsAPI) UpdateAPIKey(w http.ResponseWriter, r *http.Request)
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
-	err = mgr.UpdateClient(globalID, oldLabel, apiKey.Label, apiKey.CallbackURL, apiKey.ClientCredentialsGrantType)
+	apiKey.applyTo(c)
+	err = mgr.UpdateClient(globalID, oldLabel, c)
 
 	if err != nil && db.IsDup(err) {
 		log.Debug("Duplicate label")
@@ -870,6 +874,222 @@ func (api OrganizationsAPI) DeleteAPIKey(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// StartAPIKeySecretRotation is the handler for POST /organizations/{globalid}/apikeys/{label}/secretrotation
+// Generates a new secret for an API key, the current secret keeps working during the grace period.
+func (api OrganizationsAPI) StartAPIKeySecretRotation(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+	label := mux.Vars(r)["label"]
+
+	body := struct {
+		GracePeriod int `json:"graceperiod"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			log.Debug("Error decoding the secret rotation: ", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+	gracePeriod := time.Duration(body.GracePeriod) * time.Second
+	if gracePeriod <= 0 {
+		gracePeriod = oauthservice.DefaultSecretRotationGracePeriod
+	}
+	if gracePeriod > oauthservice.MaxSecretRotationGracePeriod {
+		gracePeriod = oauthservice.MaxSecretRotationGracePeriod
+	}
+
+	mgr := oauthservice.NewManager(r)
+	c, err := mgr.GetClient(globalID, label)
+	if handleServerError(w, "getting api key", err) {
+		return
+	}
+	if c == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	now := time.Now()
+	if c.IsRotatingSecret(now) {
+		log.Debug("A secret rotation is already in progress for api key ", label)
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	}
+
+	c.StartSecretRotation(gracePeriod, now)
+	err = mgr.UpdateClientSecrets(c)
+	if handleServerError(w, "starting a secret rotation", err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FromOAuthClient(c))
+}
+
+// FinishAPIKeySecretRotation is the handler for DELETE /organizations/{globalid}/apikeys/{label}/secretrotation
+// Stops accepting the previous secret of an API key.
+func (api OrganizationsAPI) FinishAPIKeySecretRotation(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+	label := mux.Vars(r)["label"]
+
+	mgr := oauthservice.NewManager(r)
+	c, err := mgr.GetClient(globalID, label)
+	if handleServerError(w, "getting api key", err) {
+		return
+	}
+	if c == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	c.FinishSecretRotation()
+	err = mgr.UpdateClientSecrets(c)
+	if handleServerError(w, "finishing a secret rotation", err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegisterClient is the handler for POST /organizations/{globalid}/clients
+// Registers an oauth client from its metadata, the response contains the client
+// configuration endpoint to manage the client afterwards.
+func (api OrganizationsAPI) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+
+	metadata := ClientMetadata{}
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		log.Debug("Error decoding client metadata: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if registrationErr := metadata.Validate(); registrationErr != nil {
+		log.Debug("Invalid client metadata: ", registrationErr.Description)
+		writeRegistrationError(w, registrationErr)
+		return
+	}
+
+	c := oauthservice.NewOauth2Client(globalID, metadata.ClientName, "", false)
+	metadata.applyTo(c)
+
+	mgr := oauthservice.NewManager(r)
+	err := mgr.CreateClient(c)
+	if db.IsDup(err) {
+		log.Debug("Duplicate client name")
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	}
+	if handleServerError(w, "registering a client", err) {
+		return
+	}
+
+	configurationURI := clientConfigurationURI(r, c)
+	w.Header().Set("Location", configurationURI)
+	writeClientInformation(w, http.StatusCreated, newClientInformation(c, configurationURI))
+}
+
+// GetClientConfiguration is the handler for GET /organizations/{globalid}/clients/{label}
+// Returns the metadata and the current secret of a registered client.
+func (api OrganizationsAPI) GetClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+	label := mux.Vars(r)["label"]
+
+	mgr := oauthservice.NewManager(r)
+	c, err := mgr.GetClient(globalID, label)
+	if handleServerError(w, "getting a client", err) {
+		return
+	}
+	if c == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	writeClientInformation(w, http.StatusOK, newClientInformation(c, clientConfigurationURI(r, c)))
+}
+
+// UpdateClientConfiguration is the handler for PUT /organizations/{globalid}/clients/{label}
+// Replaces the metadata of a registered client. Changing the client name also
+// changes the client configuration endpoint.
+func (api OrganizationsAPI) UpdateClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+	oldLabel := mux.Vars(r)["label"]
+
+	metadata := ClientMetadata{}
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		log.Debug("Error decoding client metadata: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if registrationErr := metadata.Validate(); registrationErr != nil {
+		log.Debug("Invalid client metadata: ", registrationErr.Description)
+		writeRegistrationError(w, registrationErr)
+		return
+	}
+
+	mgr := oauthservice.NewManager(r)
+	c, err := mgr.GetClient(globalID, oldLabel)
+	if handleServerError(w, "getting a client", err) {
+		return
+	}
+	if c == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if (metadata.ClientID != "" && metadata.ClientID != c.ClientID) || (metadata.ClientSecret != "" && metadata.ClientSecret != c.Secret) {
+		log.Debug("The client id or secret in the metadata do not match the registered client")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	metadata.applyTo(c)
+	err = mgr.UpdateClient(globalID, oldLabel, c)
+	if db.IsDup(err) {
+		log.Debug("Duplicate client name")
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	}
+	if handleServerError(w, "updating a client", err) {
+		return
+	}
+
+	writeClientInformation(w, http.StatusOK, newClientInformation(c, clientConfigurationURI(r, c)))
+}
+
+// DeleteClientConfiguration is the handler for DELETE /organizations/{globalid}/clients/{label}
+// Removes a registered client
+func (api OrganizationsAPI) DeleteClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	api.DeleteAPIKey(w, r)
+}
+
+// RotateClientSecret is the handler for POST /organizations/{globalid}/clients/{label}/secret
+// Starts a secret rotation for a registered client, the previous secret keeps working during the default grace period.
+func (api OrganizationsAPI) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	globalID := mux.Vars(r)["globalid"]
+	label := mux.Vars(r)["label"]
+
+	mgr := oauthservice.NewManager(r)
+	c, err := mgr.GetClient(globalID, label)
+	if handleServerError(w, "getting a client", err) {
+		return
+	}
+	if c == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	if c.IsRotatingSecret(now) {
+		log.Debug("A secret rotation is already in progress for client ", label)
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	}
+
+	c.StartSecretRotation(oauthservice.DefaultSecretRotationGracePeriod, now)
+	err = mgr.UpdateClientSecrets(c)
+	if handleServerError(w, "starting a secret rotation", err) {
+		return
+	}
+
+	writeClientInformation(w, http.StatusOK, newClientInformation(c, clientConfigurationURI(r, c)))
+}
+
 // CreateOrganizationDns is the handler for POST /organizations/{globalid}/dns
 // Adds a dns address to an organization
 func (api OrganizationsAPI) CreateOrganizationDns(w http.ResponseWriter, r *http.Request) {
@@ -1316,6 +1536,185 @@ func (api OrganizationsAPI) Set2faValidityTime(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusOK)
 }
 
+// GetAccessTokenValidity is the handler for GET /organizations/globalid/accesstoken/validity
+// Get the lifetime of the access tokens handed out to the organization, in seconds. 0 means the default lifetime is used
+func (api OrganizationsAPI) GetAccessTokenValidity(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	mgr := organization.NewManager(r)
+
+	validity, err := mgr.GetAccessTokenValidity(globalid)
+	if err != nil && err != mgo.ErrNotFound {
+		log.Error("Error while getting access token validity: ", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if err == mgo.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	response := struct {
+		SecondsValidity int `json:"secondsvalidity"`
+	}{
+		SecondsValidity: validity,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
+
+// SetAccessTokenValidity is the handler for PUT /organizations/globalid/accesstoken/validity
+// Sets the lifetime of the access tokens handed out to the organization, in seconds. 0 restores the default lifetime
+func (api OrganizationsAPI) SetAccessTokenValidity(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+
+	body := struct {
+		SecondsValidity int `json:"secondsvalidity"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Debug("Error while setting access token validity: ", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mgr := organization.NewManager(r)
+	seconds := body.SecondsValidity
+
+	// Between 1 minute and 30 days, refresh tokens that are not used for 30 days expire as well
+	if seconds < 0 {
+		seconds = 0
+	} else if seconds > 0 && seconds < 60 {
+		seconds = 60
+	} else if seconds > 2592000 {
+		seconds = 2592000
+	}
+
+	err := mgr.SetAccessTokenValidity(globalid, seconds)
+	if err == mgo.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error while setting access token validity: ", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetOrganizationPublicKeys is the handler for GET /organizations/globalid/publickeys
+// Get the PEM encoded public keys the organization can sign client assertions with
+func (api OrganizationsAPI) GetOrganizationPublicKeys(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	mgr := organization.NewManager(r)
+
+	publicKeys, err := mgr.GetPublicKeys(globalid)
+	if err == mgo.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "getting the public keys", err) {
+		return
+	}
+	if publicKeys == nil {
+		publicKeys = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(publicKeys)
+}
+
+// SetOrganizationPublicKeys is the handler for PUT /organizations/globalid/publickeys
+// Replaces the PEM encoded public keys the organization can sign client assertions with
+func (api OrganizationsAPI) SetOrganizationPublicKeys(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+
+	var publicKeys []string
+	if err := json.NewDecoder(r.Body).Decode(&publicKeys); err != nil {
+		log.Debug("Error decoding the public keys: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if len(publicKeys) > maximumNumberOfPublicKeys {
+		log.Debug("Too many public keys")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	for _, publicKey := range publicKeys {
+		if _, err := oauth2.ParsePublicKey(publicKey); err != nil {
+			log.Debug("Invalid public key: ", err)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+
+	mgr := organization.NewManager(r)
+	err := mgr.SetPublicKeys(globalid, publicKeys)
+	if err == mgo.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "setting the public keys", err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetJWTClaimsTemplate is the handler for GET /organizations/globalid/jwtclaims
+// Get the custom claims and required audience of the jwt's handed out to the organization
+func (api OrganizationsAPI) GetJWTClaimsTemplate(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+	mgr := organization.NewManager(r)
+
+	template, err := mgr.GetJWTClaimsTemplate(globalid)
+	if err == mgo.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "getting the jwt claims template", err) {
+		return
+	}
+	if template == nil {
+		template = &organization.JWTClaimsTemplate{}
+	}
+	if template.Claims == nil {
+		template.Claims = []organization.TemplateClaim{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// SetJWTClaimsTemplate is the handler for PUT /organizations/globalid/jwtclaims
+// Replaces the custom claims and required audience of the jwt's handed out to the organization
+func (api OrganizationsAPI) SetJWTClaimsTemplate(w http.ResponseWriter, r *http.Request) {
+	globalid := mux.Vars(r)["globalid"]
+
+	template := &organization.JWTClaimsTemplate{}
+	if err := json.NewDecoder(r.Body).Decode(template); err != nil {
+		log.Debug("Error decoding the jwt claims template: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !template.IsValid() {
+		log.Debug("Invalid jwt claims template: ", template)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mgr := organization.NewManager(r)
+	err := mgr.SetJWTClaimsTemplate(globalid, template)
+	if err == mgo.ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if handleServerError(w, "setting the jwt claims template", err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // SetOrgMember is the handler for POST /organizations/{globalid}/orgmember
 // Sets an organization as a member of this one.
 func (api OrganizationsAPI) SetOrgMember(w http.ResponseWriter, r *http.Request) {
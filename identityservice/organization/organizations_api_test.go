@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/itsyouonline/identityserver/oauthservice"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,3 +33,69 @@ func TestAPIKeyValidation(t *testing.T) {
 		assert.Equal(t, test.valid, test.apiKey.Validate())
 	}
 }
+
+func TestClientMetadataValidation(t *testing.T) {
+	type testcase struct {
+		metadata ClientMetadata
+		err      string
+	}
+	cbUrl := "https://test.example.com/callback"
+	n := "test client"
+	testCases := []testcase{
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{cbUrl}}, err: ""},
+		{metadata: ClientMetadata{ClientName: "a", RedirectURIs: []string{cbUrl}}, err: errorInvalidClientMetadata},
+		{metadata: ClientMetadata{ClientName: n}, err: errorInvalidRedirectURI},
+		{metadata: ClientMetadata{ClientName: n, GrantTypes: []string{"client_credentials"}}, err: ""},
+		{metadata: ClientMetadata{ClientName: n, GrantTypes: []string{"implicit"}, RedirectURIs: []string{cbUrl}}, err: errorInvalidClientMetadata},
+		{metadata: ClientMetadata{ClientName: n, ResponseTypes: []string{"token"}, RedirectURIs: []string{cbUrl}}, err: errorInvalidClientMetadata},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{"/callback"}}, err: errorInvalidRedirectURI},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{cbUrl + "#fragment"}}, err: errorInvalidRedirectURI},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{"https://test.example.com/" + strings.Repeat("1", 250)}}, err: errorInvalidRedirectURI},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{cbUrl}, LogoURI: "logo.png"}, err: errorInvalidClientMetadata},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{cbUrl}, TokenEndpointAuthMethod: "none"}, err: ""},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{cbUrl}, TokenEndpointAuthMethod: "private_key_jwt"}, err: ""},
+		{metadata: ClientMetadata{ClientName: n, RedirectURIs: []string{cbUrl}, TokenEndpointAuthMethod: "tls_client_auth"}, err: errorInvalidClientMetadata},
+		{metadata: ClientMetadata{ClientName: n, GrantTypes: []string{"client_credentials"}, TokenEndpointAuthMethod: "none"}, err: errorInvalidClientMetadata},
+	}
+	for _, test := range testCases {
+		err := test.metadata.Validate()
+		if test.err == "" {
+			assert.Nil(t, err, test.metadata.ClientName)
+		} else if assert.NotNil(t, err, test.metadata.ClientName) {
+			assert.Equal(t, test.err, err.Code)
+		}
+	}
+}
+
+func TestClientMetadataApplyTo(t *testing.T) {
+	metadata := ClientMetadata{
+		ClientName:                         "test client",
+		RedirectURIs:                       []string{"https://test.example.com/callback", "https://test.example.com/other"},
+		GrantTypes:                         []string{"authorization_code", "client_credentials"},
+		LogoURI:                            "https://test.example.com/logo.png",
+		TokenEndpointAuthMethod:            "client_secret_post",
+		RequirePushedAuthorizationRequests: true,
+	}
+	assert.Nil(t, metadata.Validate())
+
+	c := oauthservice.NewOauth2Client("testorg", "", "", false)
+	metadata.applyTo(c)
+	assert.Equal(t, "test client", c.Label)
+	assert.Equal(t, "https://test.example.com/callback", c.CallbackURL)
+	assert.Equal(t, []string{"https://test.example.com/other"}, c.AdditionalCallbackURLs)
+	assert.True(t, c.ClientCredentialsGrantType)
+	assert.False(t, c.PublicClient)
+	assert.True(t, c.RequirePushedAuthorizationRequests)
+
+	info := newClientInformation(c, "https://example.com/api/organizations/testorg/clients/test%20client")
+	assert.Equal(t, c.Secret, info.ClientSecret)
+	assert.Equal(t, metadata.RedirectURIs, info.RedirectURIs)
+	assert.Equal(t, []string{"authorization_code", "refresh_token", "client_credentials"}, info.GrantTypes)
+	assert.Equal(t, "client_secret_basic", info.TokenEndpointAuthMethod)
+	assert.True(t, info.RequirePushedAuthorizationRequests)
+
+	c.PublicClient = true
+	info = newClientInformation(c, "")
+	assert.Empty(t, info.ClientSecret)
+	assert.Equal(t, "none", info.TokenEndpointAuthMethod)
+}
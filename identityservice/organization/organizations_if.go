@@ -39,6 +39,23 @@ type OrganizationsInterface interface { // CreateNewOrganization is the handler
 	// DeleteAPIKey is the handler for DELETE /organizations/{globalid}/apikeys/{label}
 	// Removes an API key
 	DeleteAPIKey(http.ResponseWriter, *http.Request)
+	// StartAPIKeySecretRotation is the handler for POST /organizations/{globalid}/apikeys/{label}/secretrotation
+	// Generates a new secret, the current secret keeps working during the grace period.
+	StartAPIKeySecretRotation(http.ResponseWriter, *http.Request)
+	// FinishAPIKeySecretRotation is the handler for DELETE /organizations/{globalid}/apikeys/{label}/secretrotation
+	// Stops accepting the previous secret.
+	FinishAPIKeySecretRotation(http.ResponseWriter, *http.Request)
+	// RegisterClient is the handler for POST /organizations/{globalid}/clients
+	// Registers an oauth client from its metadata.
+	RegisterClient(http.ResponseWriter, *http.Request)
+	// GetClientConfiguration is the handler for GET /organizations/{globalid}/clients/{label}
+	GetClientConfiguration(http.ResponseWriter, *http.Request)
+	// UpdateClientConfiguration is the handler for PUT /organizations/{globalid}/clients/{label}
+	UpdateClientConfiguration(http.ResponseWriter, *http.Request)
+	// DeleteClientConfiguration is the handler for DELETE /organizations/{globalid}/clients/{label}
+	DeleteClientConfiguration(http.ResponseWriter, *http.Request)
+	// RotateClientSecret is the handler for POST /organizations/{globalid}/clients/{label}/secret
+	RotateClientSecret(http.ResponseWriter, *http.Request)
 	// GetOrganizationTree is the handler for GET /organizations/{globalid}/tree
 	GetOrganizationTree(http.ResponseWriter, *http.Request)
 	// UpdateOrganizationMemberShip is the handler for PUT /organizations/{globalid}/members
@@ -101,6 +118,24 @@ type OrganizationsInterface interface { // CreateNewOrganization is the handler
 	// Set2faValidityTime is the handler for PUT /organizations/globalid/2fa/validity
 	// Sets the 2fa validity time for the organization, in seconds
 	Set2faValidityTime(w http.ResponseWriter, r *http.Request)
+	// GetAccessTokenValidity is the handler for GET /organizations/globalid/accesstoken/validity
+	// Get the lifetime of the access tokens handed out to the organization, in seconds
+	GetAccessTokenValidity(w http.ResponseWriter, r *http.Request)
+	// SetAccessTokenValidity is the handler for PUT /organizations/globalid/accesstoken/validity
+	// Sets the lifetime of the access tokens handed out to the organization, in seconds
+	SetAccessTokenValidity(w http.ResponseWriter, r *http.Request)
+	// GetOrganizationPublicKeys is the handler for GET /organizations/globalid/publickeys
+	// Get the public keys the organization can sign client assertions with
+	GetOrganizationPublicKeys(w http.ResponseWriter, r *http.Request)
+	// SetOrganizationPublicKeys is the handler for PUT /organizations/globalid/publickeys
+	// Replaces the public keys the organization can sign client assertions with
+	SetOrganizationPublicKeys(w http.ResponseWriter, r *http.Request)
+	// GetJWTClaimsTemplate is the handler for GET /organizations/globalid/jwtclaims
+	// Get the custom claims and required audience of the jwt's handed out to the organization
+	GetJWTClaimsTemplate(w http.ResponseWriter, r *http.Request)
+	// SetJWTClaimsTemplate is the handler for PUT /organizations/globalid/jwtclaims
+	// Replaces the custom claims and required audience of the jwt's handed out to the organization
+	SetJWTClaimsTemplate(w http.ResponseWriter, r *http.Request)
 	// SetOrgMember is the handler for POST /organizations/globalid/orgmembers
 	// Sets an organization as a member of this one.
 	SetOrgMember(w http.ResponseWriter, r *http.Request)
@@ -171,6 +206,13 @@ func OrganizationsInterfaceRoutes(r *mux.Router, i OrganizationsInterface) {
 	r.Handle("/organizations/{globalid}/apikeys/{label}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.GetAPIKey))).Methods("GET")
 	r.Handle("/organizations/{globalid}/apikeys/{label}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.UpdateAPIKey))).Methods("PUT")
 	r.Handle("/organizations/{globalid}/apikeys/{label}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.DeleteAPIKey))).Methods("DELETE")
+	r.Handle("/organizations/{globalid}/apikeys/{label}/secretrotation", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.StartAPIKeySecretRotation))).Methods("POST")
+	r.Handle("/organizations/{globalid}/apikeys/{label}/secretrotation", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.FinishAPIKeySecretRotation))).Methods("DELETE")
+	r.Handle("/organizations/{globalid}/clients", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.RegisterClient))).Methods("POST")
+	r.Handle("/organizations/{globalid}/clients/{label}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.GetClientConfiguration))).Methods("GET")
+	r.Handle("/organizations/{globalid}/clients/{label}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.UpdateClientConfiguration))).Methods("PUT")
+	r.Handle("/organizations/{globalid}/clients/{label}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.DeleteClientConfiguration))).Methods("DELETE")
+	r.Handle("/organizations/{globalid}/clients/{label}/secret", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.RotateClientSecret))).Methods("POST")
 	r.Handle("/organizations/{globalid}/tree", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:member", "organization:owner"}).Handler).Then(http.HandlerFunc(i.GetOrganizationTree))).Methods("GET")
 	r.Handle("/organizations/{globalid}/members", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.AddOrganizationMember))).Methods("POST")
 	r.Handle("/organizations/{globalid}/members", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.UpdateOrganizationMemberShip))).Methods("PUT")
@@ -195,6 +237,12 @@ func OrganizationsInterfaceRoutes(r *mux.Router, i OrganizationsInterface) {
 	r.Handle("/organizations/{globalid}/logo", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.DeleteOrganizationLogo))).Methods("DELETE")
 	r.Handle("/organizations/{globalid}/2fa/validity", http.HandlerFunc(i.Get2faValidityTime)).Methods("GET")
 	r.Handle("/organizations/{globalid}/2fa/validity", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.Set2faValidityTime))).Methods("PUT")
+	r.Handle("/organizations/{globalid}/accesstoken/validity", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.GetAccessTokenValidity))).Methods("GET")
+	r.Handle("/organizations/{globalid}/accesstoken/validity", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.SetAccessTokenValidity))).Methods("PUT")
+	r.Handle("/organizations/{globalid}/publickeys", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.GetOrganizationPublicKeys))).Methods("GET")
+	r.Handle("/organizations/{globalid}/publickeys", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.SetOrganizationPublicKeys))).Methods("PUT")
+	r.Handle("/organizations/{globalid}/jwtclaims", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.GetJWTClaimsTemplate))).Methods("GET")
+	r.Handle("/organizations/{globalid}/jwtclaims", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.SetJWTClaimsTemplate))).Methods("PUT")
 	r.Handle("/organizations/{globalid}/orgmembers", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.SetOrgMember))).Methods("POST")
 	r.Handle("/organizations/{globalid}/orgowners", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.SetOrgOwner))).Methods("POST")
 	r.Handle("/organizations/{globalid}/orgmembers/{globalid2}", alice.New(newOauth2oauth_2_0Middleware([]string{"organization:owner"}).Handler).Then(http.HandlerFunc(i.DeleteOrgMember))).Methods("DELETE")
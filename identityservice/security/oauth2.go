@@ -1,9 +1,10 @@
 package security
 
 import (
-	"crypto/ecdsa"
 	"net/http"
 	"strings"
+
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
 )
 
 // OAuth2Middleware defines the common oauth2 functionality
@@ -11,8 +12,8 @@ type OAuth2Middleware struct {
 	Scopes []string
 }
 
-//JWTPublicKey has the public key of the allowed JWT issuer
-var JWTPublicKey *ecdsa.PublicKey
+//JWTVerificationKeys has the public keys of the allowed JWT issuer
+var JWTVerificationKeys *oauth2.JWTVerificationKeys
 
 //GetAccessToken returns the access token from the authorization header or from the query parameters.
 // If the authorization header starts with "bearer", "" is returned
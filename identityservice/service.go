@@ -27,7 +27,10 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/communication"
 	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/recoverycodes"
+	"github.com/itsyouonline/identityserver/credentials/throttle"
 	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/credentials/webauthn"
 	"github.com/itsyouonline/identityserver/db/registry"
 	"github.com/itsyouonline/identityserver/identityservice/invitations"
 	"github.com/itsyouonline/identityserver/validation"
@@ -63,6 +66,9 @@ func (service *Service) AddRoutes(router *mux.Router) {
 	user.UsersInterfaceRoutes(router, user.UsersAPI{SmsService: service.smsService, PhonenumberValidationService: service.phonenumberValidationService, EmailService: service.emailService, EmailAddressValidationService: service.emailaddresValidationService})
 	userdb.InitModels()
 	totp.InitModels()
+	webauthn.InitModels()
+	recoverycodes.InitModels()
+	throttle.InitModels()
 	see.InitModels()
 
 	// Company API
@@ -162,6 +168,11 @@ func (service *Service) FilterAuthorizedScopes(r *http.Request, username string,
 	return
 }
 
+//GetLatestConsent returns the most recent consent the user gave to the client, nil if there is none
+func (service *Service) GetLatestConsent(r *http.Request, username string, clientID string) (consent *userdb.Consent, err error) {
+	return userdb.NewManager(r).GetLatestConsent(username, clientID)
+}
+
 //FilterPossibleScopes filters the requestedScopes to the relevant ones that are possible
 // For example, a `user:memberof:orgid1` is not possible if the user is not a member the `orgid1` organization and there is no outstanding invite for this organization
 // If allowInvitations is true, invitations to organizations allows the "user:memberof:organization" as possible scopes
@@ -37,7 +37,7 @@ func (om *Oauth2oauth_2_0Middleware) Handler(next http.Handler) http.Handler {
 
 		accessToken := om.GetAccessToken(r)
 
-		token, err := oauth2.GetValidJWT(r, security.JWTPublicKey)
+		token, err := oauth2.GetValidJWT(r, security.JWTVerificationKeys)
 		if err != nil {
 			log.Error(err)
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
@@ -16,7 +16,10 @@ import (
 	"github.com/itsyouonline/identityserver/communication"
 	"github.com/itsyouonline/identityserver/credentials/oauth2"
 	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/recoverycodes"
+	"github.com/itsyouonline/identityserver/credentials/throttle"
 	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/credentials/webauthn"
 	"github.com/itsyouonline/identityserver/db"
 	contractdb "github.com/itsyouonline/identityserver/db/contract"
 	"github.com/itsyouonline/identityserver/db/keystore"
@@ -438,8 +441,8 @@ func (api UsersAPI) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	userMgr := user.NewManager(r)
-	exists, err := userMgr.Exists(username)
-	if !exists || err != nil {
+	userobj, err := userMgr.GetByName(username)
+	if err != nil {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
@@ -454,9 +457,27 @@ func (api UsersAPI) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		writeErrorResponse(w, 422, "incorrect_password")
 		return
 	}
-	err = passwordMgr.Save(username, body.Newpassword)
+	emails := []string{}
+	for _, email := range userobj.EmailAddresses {
+		emails = append(emails, email.EmailAddress)
+	}
+	err = passwordMgr.Save(username, body.Newpassword, emails)
+	if policyErr, ok := err.(*password.PolicyError); ok {
+		log.Debug("422 ", err)
+		response := struct {
+			Error      string                     `json:"error"`
+			Violations []password.PolicyViolation `json:"violations"`
+		}{
+			Error:      policyErr.Error(),
+			Violations: policyErr.Violations,
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(&response)
+		return
+	}
 	if err != nil {
-		writeErrorResponse(w, 422, err.Error())
+		log.Error("Error while saving the password: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -1718,6 +1739,80 @@ func (api UsersAPI) DeleteAuthorization(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetConsents is the handler for GET /users/{username}/authorizations/{grantedTo}/consents
+// Get the history of consents the user gave to an organization, the most recent consent first.
+func (api UsersAPI) GetConsents(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	grantedTo := mux.Vars(r)["grantedTo"]
+
+	consents, err := user.NewManager(r).GetConsents(username, grantedTo)
+	if handleServerError(w, "getting consents", err) {
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// AddConsent is the handler for POST /users/{username}/authorizations/{grantedTo}/consents
+// Record the scopes the user approved and declined on the authorize page.
+func (api UsersAPI) AddConsent(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	grantedTo := mux.Vars(r)["grantedTo"]
+
+	body := struct {
+		Scopes []user.ScopeConsent `json:"scopes"`
+		// Validity is the number of seconds the consent is valid, 0 if it does not expire
+		Validity int64 `json:"validity"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	validity := time.Duration(body.Validity) * time.Second
+	if body.Validity < 0 || validity > user.MaxConsentValidity {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for i, scopeConsent := range body.Scopes {
+		if strings.TrimSpace(scopeConsent.Scope) == "" {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		body.Scopes[i].DecidedAt = db.DateTime(now)
+	}
+
+	userMgr := user.NewManager(r)
+	previousConsent, err := userMgr.GetLatestConsent(username, grantedTo)
+	if handleServerError(w, "getting the previous consent", err) {
+		return
+	}
+	consent := &user.Consent{
+		Username:  username,
+		ClientID:  grantedTo,
+		GrantedAt: db.DateTime(now),
+		Scopes:    body.Scopes,
+	}
+	if consent.Scopes == nil {
+		consent.Scopes = []user.ScopeConsent{}
+	}
+	if validity > 0 {
+		expiresAt := db.DateTime(now.Add(validity))
+		consent.ExpiresAt = &expiresAt
+	}
+	// On an incremental authorization only the additional scopes were asked, the earlier decisions still count
+	if previousConsent != nil && !previousConsent.IsExpired(now) {
+		consent.MergePrevious(previousConsent)
+	}
+	err = userMgr.SaveConsent(consent)
+	if handleServerError(w, "saving consent", err) {
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(consent)
+}
+
 func (api UsersAPI) GetSeeObjects(w http.ResponseWriter, r *http.Request) {
 	username := mux.Vars(r)["username"]
 	globalid := r.FormValue("globalid")
@@ -2456,8 +2551,10 @@ func (api UsersAPI) GetTwoFAMethods(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := struct {
-		Totp bool               `json:"totp"`
-		Sms  []user.Phonenumber `json:"sms"`
+		Totp          bool               `json:"totp"`
+		Sms           []user.Phonenumber `json:"sms"`
+		Webauthn      bool               `json:"webauthn"`
+		RecoveryCodes int                `json:"recoverycodes"`
 	}{}
 	totpMgr := totp.NewManager(r)
 	response.Totp, err = totpMgr.HasTOTP(username)
@@ -2466,6 +2563,18 @@ func (api UsersAPI) GetTwoFAMethods(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	response.Webauthn, err = webauthn.NewManager(r).HasCredentials(username)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	response.RecoveryCodes, err = recoverycodes.NewManager(r).Remaining(username)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 	valMgr := validationdb.NewManager(r)
 	verifiedPhones, err := valMgr.GetByUsernameValidatedPhonenumbers(username)
 	if err != nil {
@@ -2573,7 +2682,13 @@ func (api UsersAPI) RemoveTOTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	if !hasValidatedPhones {
+	hasWebAuthnCredentials, err := webauthn.NewManager(r).HasCredentials(username)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !hasValidatedPhones && !hasWebAuthnCredentials {
 		w.WriteHeader(http.StatusConflict)
 		return
 	}
@@ -2588,6 +2703,187 @@ func (api UsersAPI) RemoveTOTP(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListWebAuthnCredentials is the handler for GET /users/{username}/webauthn
+// List the security keys and platform authenticators of the user
+func (api UsersAPI) ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	credentials, err := webauthn.NewManager(r).GetCredentials(username)
+	if handleServerError(w, "getting webauthn credentials", err) {
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(credentials)
+}
+
+// StartWebAuthnRegistration is the handler for POST /users/{username}/webauthn/registration
+// Get the options to pass to the browser to register a new security key or platform authenticator
+func (api UsersAPI) StartWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	body := struct {
+		Passwordless bool `json:"passwordless"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	webauthnMgr := webauthn.NewManager(r)
+	credentials, err := webauthnMgr.GetCredentials(username)
+	if handleServerError(w, "getting webauthn credentials", err) {
+		return
+	}
+	challenge, err := webauthn.NewChallenge()
+	if handleServerError(w, "generating a webauthn challenge", err) {
+		return
+	}
+	err = webauthnMgr.SaveChallenge(&webauthn.Challenge{
+		Username:     username,
+		Challenge:    challenge,
+		Ceremony:     webauthn.CeremonyRegistration,
+		Passwordless: body.Passwordless,
+		CreatedAt:    time.Now(),
+	})
+	if handleServerError(w, "saving a webauthn challenge", err) {
+		return
+	}
+	options := webauthn.NewCreationOptions(webauthn.GetRelyingParty(), username, challenge, credentials, body.Passwordless)
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// RegisterWebAuthnCredential is the handler for POST /users/{username}/webauthn
+// Register a security key or platform authenticator with the response of the browser
+func (api UsersAPI) RegisterWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	body := struct {
+		Label             string `json:"label"`
+		ClientDataJSON    string `json:"clientdatajson"`
+		AttestationObject string `json:"attestationobject"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	clientDataJSON, err := webauthn.DecodeBase64URL(body.ClientDataJSON)
+	if err != nil || !user.IsValidLabel(body.Label) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	attestationObject, err := webauthn.DecodeBase64URL(body.AttestationObject)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	challenge, err := webauthn.ChallengeFromClientData(clientDataJSON)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	webauthnMgr := webauthn.NewManager(r)
+	outstanding, err := webauthnMgr.ConsumeChallenge(username, challenge, webauthn.CeremonyRegistration)
+	if handleServerError(w, "getting the webauthn challenge", err) {
+		return
+	}
+	if outstanding == nil {
+		log.Debug("Unknown or expired webauthn registration challenge")
+		w.WriteHeader(422)
+		return
+	}
+	credential, err := webauthn.VerifyRegistration(webauthn.GetRelyingParty(), challenge, clientDataJSON, attestationObject, outstanding.Passwordless)
+	if err != nil {
+		log.Debug("Invalid webauthn registration: ", err)
+		w.WriteHeader(422)
+		return
+	}
+	credential.Username = username
+	credential.Label = body.Label
+	credential.CreatedAt = db.DateTime(time.Now())
+	err = webauthnMgr.Save(credential)
+	if webauthnMgr.IsDuplicate(err) {
+		http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		return
+	}
+	if handleServerError(w, "saving the webauthn credential", err) {
+		return
+	}
+	user.NewManager(r).RemoveExpireDate(username)
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(credential)
+}
+
+// DeleteWebAuthnCredential is the handler for DELETE /users/{username}/webauthn/{id}
+// Remove a security key or platform authenticator, a user always needs to keep a second factor
+func (api UsersAPI) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	id := mux.Vars(r)["id"]
+
+	webauthnMgr := webauthn.NewManager(r)
+	credentials, err := webauthnMgr.GetCredentials(username)
+	if handleServerError(w, "getting webauthn credentials", err) {
+		return
+	}
+	found := false
+	for _, credential := range credentials {
+		found = found || credential.ID == id
+	}
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if len(credentials) == 1 {
+		hasTOTP, err := totp.NewManager(r).HasTOTP(username)
+		if handleServerError(w, "checking the totp secret", err) {
+			return
+		}
+		hasValidatedPhones, err := validationdb.NewManager(r).HasValidatedPhones(username)
+		if handleServerError(w, "checking the validated phone numbers", err) {
+			return
+		}
+		if !hasTOTP && !hasValidatedPhones {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+	err = webauthnMgr.Remove(username, id)
+	if handleServerError(w, "removing the webauthn credential", err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GenerateRecoveryCodes is the handler for POST /users/{username}/recoverycodes
+// Generate a new set of one-time recovery codes, the previous codes can no longer be used
+func (api UsersAPI) GenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	codes, err := recoverycodes.NewManager(r).Regenerate(username)
+	if handleServerError(w, "generating recovery codes", err) {
+		return
+	}
+	response := struct {
+		Codes []string `json:"codes"`
+	}{Codes: codes}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListLockouts is the handler for GET /users/{username}/lockouts
+// List the recent lockouts of the account caused by too many failed login attempts
+func (api UsersAPI) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	lockouts, err := throttle.NewManager(r).GetLockouts(username)
+	if handleServerError(w, "getting the lockouts", err) {
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(lockouts)
+}
+
 // LeaveOrganization is the handler for DELETE /users/{username}/organizations/{globalid}/leave
 // Removes the user from an organization
 func (api UsersAPI) LeaveOrganization(w http.ResponseWriter, r *http.Request) {
@@ -105,6 +105,12 @@ type UsersInterface interface { // Post is the handler for POST /users
 	// Remove the authorization for an organization, the granted organization will no longer
 	// have access the user's information.
 	DeleteAuthorization(http.ResponseWriter, *http.Request)
+	// GetConsents is the handler for GET /users/{username}/authorizations/{grantedTo}/consents
+	// Get the history of consents the user gave to an organization, the most recent consent first.
+	GetConsents(http.ResponseWriter, *http.Request)
+	// AddConsent is the handler for POST /users/{username}/authorizations/{grantedTo}/consents
+	// Record the scopes the user approved and declined on the authorize page.
+	AddConsent(http.ResponseWriter, *http.Request)
 	// GetSeeObjects is the handler for GET /users/{username}/see
 	// Get a list of all see objects.
 	GetSeeObjects(http.ResponseWriter, *http.Request)
@@ -150,6 +156,24 @@ type UsersInterface interface { // Post is the handler for POST /users
 	SetupTOTP(http.ResponseWriter, *http.Request)
 	// RemoveTOTP is the handler for DELETE /users/{username}/totp
 	RemoveTOTP(http.ResponseWriter, *http.Request)
+	// ListWebAuthnCredentials is the handler for GET /users/{username}/webauthn
+	// List the security keys and platform authenticators of the user
+	ListWebAuthnCredentials(http.ResponseWriter, *http.Request)
+	// RegisterWebAuthnCredential is the handler for POST /users/{username}/webauthn
+	// Register a security key or platform authenticator with the response of the browser
+	RegisterWebAuthnCredential(http.ResponseWriter, *http.Request)
+	// StartWebAuthnRegistration is the handler for POST /users/{username}/webauthn/registration
+	// Get the options to pass to the browser to register a new security key or platform authenticator
+	StartWebAuthnRegistration(http.ResponseWriter, *http.Request)
+	// DeleteWebAuthnCredential is the handler for DELETE /users/{username}/webauthn/{id}
+	// Remove a security key or platform authenticator
+	DeleteWebAuthnCredential(http.ResponseWriter, *http.Request)
+	// GenerateRecoveryCodes is the handler for POST /users/{username}/recoverycodes
+	// Generate a new set of one-time recovery codes, the previous codes can no longer be used
+	GenerateRecoveryCodes(http.ResponseWriter, *http.Request)
+	// ListLockouts is the handler for GET /users/{username}/lockouts
+	// List the recent lockouts of the account caused by too many failed login attempts
+	ListLockouts(http.ResponseWriter, *http.Request)
 	GetDigitalWallet(http.ResponseWriter, *http.Request)
 	RegisterNewDigitalAssetAddress(http.ResponseWriter, *http.Request)
 	GetDigitalAssetAddress(http.ResponseWriter, *http.Request)
@@ -249,6 +273,8 @@ func UsersInterfaceRoutes(r *mux.Router, i UsersInterface) {
 	r.Handle("/users/{username}/authorizations/{grantedTo}", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetAuthorization))).Methods("GET")
 	r.Handle("/users/{username}/authorizations/{grantedTo}", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.UpdateAuthorization))).Methods("PUT")
 	r.Handle("/users/{username}/authorizations/{grantedTo}", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.DeleteAuthorization))).Methods("DELETE")
+	r.Handle("/users/{username}/authorizations/{grantedTo}/consents", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetConsents))).Methods("GET")
+	r.Handle("/users/{username}/authorizations/{grantedTo}/consents", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.AddConsent))).Methods("POST")
 	r.Handle("/users/{username}/see", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin", "user:see"}).Handler).Then(http.HandlerFunc(i.GetSeeObjects))).Methods("GET")
 	r.Handle("/users/{username}/see", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:see"}).Handler).Then(http.HandlerFunc(i.CreateSeeObject))).Methods("POST")
 	r.Handle("/users/{username}/see/{uniqueid}/{globalid}", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin", "user:see"}).Handler).Then(http.HandlerFunc(i.GetSeeObject))).Methods("GET")
@@ -258,6 +284,12 @@ func UsersInterfaceRoutes(r *mux.Router, i UsersInterface) {
 	r.Handle("/users/{username}/totp", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GetTOTPSecret))).Methods("GET")
 	r.Handle("/users/{username}/totp", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.SetupTOTP))).Methods("POST")
 	r.Handle("/users/{username}/totp", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.RemoveTOTP))).Methods("DELETE")
+	r.Handle("/users/{username}/webauthn", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ListWebAuthnCredentials))).Methods("GET")
+	r.Handle("/users/{username}/webauthn", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.RegisterWebAuthnCredential))).Methods("POST")
+	r.Handle("/users/{username}/webauthn/registration", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.StartWebAuthnRegistration))).Methods("POST")
+	r.Handle("/users/{username}/webauthn/{id}", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.DeleteWebAuthnCredential))).Methods("DELETE")
+	r.Handle("/users/{username}/recoverycodes", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.GenerateRecoveryCodes))).Methods("POST")
+	r.Handle("/users/{username}/lockouts", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ListLockouts))).Methods("GET")
 	r.Handle("/users/{username}/organizations/{globalid}/leave", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.LeaveOrganization))).Methods("DELETE")
 	r.Handle("/users/{username}/registry", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.ListUserRegistry))).Methods("GET")
 	r.Handle("/users/{username}/registry", alice.New(newUserIndentifierMiddleware().Handler, newOauth2oauth_2_0Middleware([]string{"user:admin"}).Handler).Then(http.HandlerFunc(i.AddUserRegistryEntry))).Methods("POST")
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/globalconfig"
+)
+
+//jwtKeysCommand creates the command to manage the jwt signing key ring
+//A key rotation is done by generating a new key, promoting it once all instances publish it and retiring the old key once the jwt's it signed are expired
+func jwtKeysCommand(dbConnectionString *string) cli.Command {
+	return cli.Command{
+		Name:  "jwtkeys",
+		Usage: "Manage the keys jwt's are signed with",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the keys in the key ring",
+				Action: jwtKeysAction(dbConnectionString, listJWTKeys),
+			},
+			{
+				Name:   "generate",
+				Usage:  "Generate a new key, it only becomes the signing key if the key ring is empty",
+				Action: jwtKeysAction(dbConnectionString, generateJWTKey),
+			},
+			{
+				Name:      "promote",
+				Usage:     "Make a key the active signing key",
+				ArgsUsage: "<kid>",
+				Action:    jwtKeysAction(dbConnectionString, promoteJWTKey),
+			},
+			{
+				Name:      "retire",
+				Usage:     "Remove a key that is no longer used for signing, jwt's signed with it are no longer valid",
+				ArgsUsage: "<kid>",
+				Action:    jwtKeysAction(dbConnectionString, retireJWTKey),
+			},
+		},
+	}
+}
+
+//jwtKeysAction loads the key ring, applies a change to it and saves it again if the change succeeded
+func jwtKeysAction(dbConnectionString *string, change func(c *cli.Context, keyRing *globalconfig.JWTKeyRing) (modified bool, err error)) func(c *cli.Context) {
+	return func(c *cli.Context) {
+		db.Connect(*dbConnectionString)
+		defer db.Close()
+
+		config := globalconfig.NewManager()
+		keyRing, err := config.GetJWTKeyRing()
+		if err != nil {
+			log.Fatal("Unable to load the jwt key ring: ", err)
+		}
+		if keyRing == nil {
+			keyRing = &globalconfig.JWTKeyRing{}
+		}
+		modified, err := change(c, keyRing)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !modified {
+			return
+		}
+		if err = config.SaveJWTKeyRing(keyRing); err != nil {
+			log.Fatal("Unable to save the jwt key ring: ", err)
+		}
+		log.Info("The jwt key ring is saved, restart the identityserver instances to use it")
+	}
+}
+
+func listJWTKeys(c *cli.Context, keyRing *globalconfig.JWTKeyRing) (modified bool, err error) {
+	for _, key := range keyRing.Keys {
+		status := "verification only"
+		if key.Active {
+			status = "active"
+		}
+		fmt.Printf("%s\t%s\t%s\n", key.KeyID, key.CreatedAt.Format("2006-01-02 15:04:05"), status)
+	}
+	return
+}
+
+func generateJWTKey(c *cli.Context, keyRing *globalconfig.JWTKeyRing) (modified bool, err error) {
+	key, err := keyRing.Generate()
+	if err != nil {
+		return
+	}
+	fmt.Println(key.KeyID)
+	modified = true
+	return
+}
+
+func promoteJWTKey(c *cli.Context, keyRing *globalconfig.JWTKeyRing) (modified bool, err error) {
+	err = keyRing.Promote(c.Args().First())
+	modified = err == nil
+	return
+}
+
+func retireJWTKey(c *cli.Context, keyRing *globalconfig.JWTKeyRing) (modified bool, err error) {
+	err = keyRing.Retire(c.Args().First())
+	modified = err == nil
+	return
+}
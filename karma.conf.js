@@ -43,6 +43,8 @@ module.exports = function(config) {
           'components/common.js',
           'components/shared/country-info.js',
           'components/shared/directives/telinput.js',
+          'components/shared/webAuthnService.js',
+          'components/shared/passwordPolicyService.js',
           'thirdpartyassets/showdown/compressed/Showdown.min.js',
           'thirdpartyassets/angular-markdown-directive/markdown.js',
 
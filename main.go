@@ -7,8 +7,9 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/itsyouonline/identityserver/communication"
+	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/webauthn"
 	"github.com/itsyouonline/identityserver/db"
 	"github.com/itsyouonline/identityserver/globalconfig"
 	"github.com/itsyouonline/identityserver/https"
@@ -36,12 +37,16 @@ func main() {
 	var debugLogging, ignoreDevcert, testEnv bool
 	var bindAddress, dbConnectionString string
 	var tlsCert, tlsKey string
+	var webauthnOrigin, webauthnRPID string
 	var twilioAccountSID, twilioAuthToken, twilioMessagingServiceSID string
 	var smtpserver, smtpuser, smtppassword string
 	var smtpport int
 
 	var smsAeroUser, smsAeroPassword, smsAeroSenderId string
 
+	var passwordMinLength, passwordCharacterClasses, passwordHistory int
+	var breachedPasswordsFile string
+
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:        "debug, d",
@@ -72,6 +77,17 @@ func main() {
 			Value:       "",
 			Destination: &tlsKey,
 		},
+		cli.StringFlag{
+			Name:        "webauthn-origin",
+			Usage:       "Origin (https://host[:port]) the website is served on, security keys are only accepted on this origin",
+			Value:       webauthn.DefaultOrigin,
+			Destination: &webauthnOrigin,
+		},
+		cli.StringFlag{
+			Name:        "webauthn-rp-id",
+			Usage:       "Webauthn relying party id, the hostname of the webauthn origin or a parent domain of it, defaults to the hostname",
+			Destination: &webauthnRPID,
+		},
 		cli.BoolFlag{
 			Name:        "ignore-devcert, i",
 			Usage:       "Ignore default devcert even if exists",
@@ -128,6 +144,29 @@ func main() {
 			Usage:       "The sender Id for SmsAero, filled in in the from field",
 			Destination: &smsAeroSenderId,
 		},
+		cli.IntFlag{
+			Name:        "password-min-length",
+			Usage:       "Minimum number of characters of a password",
+			Value:       password.DefaultPolicy.MinLength,
+			Destination: &passwordMinLength,
+		},
+		cli.IntFlag{
+			Name:        "password-character-classes",
+			Usage:       "Minimum number of character classes (lowercase, uppercase, digits and symbols) in a password",
+			Value:       password.DefaultPolicy.MinCharacterClasses,
+			Destination: &passwordCharacterClasses,
+		},
+		cli.IntFlag{
+			Name:        "password-history",
+			Usage:       "Number of last passwords of a user that can not be reused",
+			Value:       password.DefaultPolicy.HistorySize,
+			Destination: &passwordHistory,
+		},
+		cli.StringFlag{
+			Name:        "breached-passwords",
+			Usage:       "File with SHA-1 hashes of breached passwords to reject, defaults to the list of common passwords that is shipped",
+			Destination: &breachedPasswordsFile,
+		},
 		cli.BoolFlag{
 			Name:        "testEnv",
 			Usage:       "Designate if this is a production environment",
@@ -143,6 +182,8 @@ func main() {
 		return nil
 	}
 
+	app.Commands = []cli.Command{jwtKeysCommand(&dbConnectionString)}
+
 	app.Action = func(c *cli.Context) {
 
 		log.Infoln(app.Name, "version", app.Version)
@@ -150,6 +191,34 @@ func main() {
 		go db.Connect(dbConnectionString)
 		defer db.Close()
 
+		relyingParty, err := webauthn.NewRelyingParty(webauthnRPID, webauthnOrigin)
+		if err != nil {
+			log.Fatal("Invalid webauthn settings: ", err)
+		}
+		webauthn.SetRelyingParty(relyingParty)
+
+		password.DefaultPolicy.MinLength = passwordMinLength
+		password.DefaultPolicy.MinCharacterClasses = passwordCharacterClasses
+		password.DefaultPolicy.HistorySize = passwordHistory
+		if err = password.DefaultPolicy.Validate(); err != nil {
+			log.Fatal("Invalid password policy: ", err)
+		}
+		var breachedPasswords *password.BreachedList
+		if breachedPasswordsFile == "" {
+			breachedPasswords, err = password.LoadDefaultBreachedList()
+		} else {
+			var f *os.File
+			if f, err = os.Open(breachedPasswordsFile); err == nil {
+				breachedPasswords, err = password.LoadBreachedList(f)
+				f.Close()
+			}
+		}
+		if err != nil {
+			log.Fatal("Unable to load the breached passwords list: ", err)
+		}
+		log.Infoln("Loaded", breachedPasswords.Len(), "breached password hashes")
+		password.DefaultPolicy.Breached = breachedPasswords
+
 		cookieSecret := identityservice.GetCookieSecret()
 		var smsService communication.SMSService
 		var emailService communication.EmailService
@@ -210,33 +279,36 @@ func main() {
 
 		config := globalconfig.NewManager()
 
-		var jwtKey []byte
-		var err error
-		exists, err := config.Exists("jwtkey")
-		if err == nil && exists {
-			var jwtKeyConfig *globalconfig.GlobalConfig
-			jwtKeyConfig, err = config.GetByKey("jwtkey")
-			jwtKey = []byte(jwtKeyConfig.Value)
-		} else {
-			if err == nil {
-				if _, e := os.Stat("devcert/jwt_key.pem"); e == nil {
-					log.Warning("===============================================================================")
-					log.Warning("This instance uses a development JWT signing key, don't do this in production !")
-					log.Warning("===============================================================================")
+		keyRing, err := config.GetJWTKeyRing()
+		if err == nil && keyRing == nil {
+			if _, e := os.Stat("devcert/jwt_key.pem"); e == nil {
+				log.Warning("===============================================================================")
+				log.Warning("This instance uses a development JWT signing key, don't do this in production !")
+				log.Warning("===============================================================================")
 
-					jwtKey, err = ioutil.ReadFile("devcert/jwt_key.pem")
+				var jwtKey []byte
+				jwtKey, err = ioutil.ReadFile("devcert/jwt_key.pem")
+				if err == nil {
+					keyRing, err = globalconfig.NewJWTKeyRingFromPEM(jwtKey)
 				}
 			}
 		}
+		if err == nil && keyRing == nil {
+			err = globalconfig.ErrNoActiveJWTKey
+		}
 		if err != nil {
 			log.Fatal("Unable to load a valid key for signing JWT's: ", err)
 		}
-		ecdsaKey, err := jwt.ParseECPrivateKeyFromPEM(jwtKey)
+		ecdsaKey, _, err := keyRing.SigningKey()
 		if err != nil {
 			log.Fatal("Unable to load a valid key for signing JWT's: ", err)
 		}
-		security.JWTPublicKey = &ecdsaKey.PublicKey
-		oauthsc, err := oauthservice.NewService(sc, is, ecdsaKey)
+		verificationKeys, err := keyRing.VerificationKeys()
+		if err != nil {
+			log.Fatal("Unable to load the keys to verify JWT's: ", err)
+		}
+		security.JWTVerificationKeys = verificationKeys
+		oauthsc, err := oauthservice.NewService(sc, is, ecdsaKey, verificationKeys)
 		if err != nil {
 			log.Fatal("Unable to create the oauthservice: ", err)
 		}
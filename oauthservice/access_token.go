@@ -10,14 +10,19 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
 	"github.com/itsyouonline/identityserver/db/organization"
 	"github.com/itsyouonline/identityserver/db/user/apikey"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-//AccessTokenExpiration is the time in seconds an access token expires
+//AccessTokenExpiration is the default time in seconds an access token expires, organizations can configure a different lifetime
 var AccessTokenExpiration = time.Second * 3600 * 24 //Tokens expire after 1 day
 
+//maxExpiresInMargin is the maximum safety margin the expires_in of an access token response is shortened with
+const maxExpiresInMargin = time.Minute * 10
+
 //AccessToken is an oauth2 accesstoken together with the access information it stands for
 type AccessToken struct {
 	ID          bson.ObjectId `json:"-" bson:"_id,omitempty"`
@@ -28,6 +33,9 @@ type AccessToken struct {
 	Scope       string
 	ClientID    string //The client_id of the organization that was granted the token
 	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	//RefreshTokenFamily is the family of the refresh token this access token was issued with, if any
+	RefreshTokenFamily string `json:"-" bson:"refreshtokenfamily,omitempty"`
 }
 
 //IsExpiredAt checks if the token is expired at a specific time
@@ -42,16 +50,46 @@ func (at *AccessToken) IsExpired() bool {
 
 //ExpirationTime return the time at which this token expires
 func (at *AccessToken) ExpirationTime() time.Time {
-	return at.CreatedAt.Add(AccessTokenExpiration)
+	// Tokens created before the lifetime was configurable do not have an ExpiresAt
+	if at.ExpiresAt.IsZero() {
+		return at.CreatedAt.Add(AccessTokenExpiration)
+	}
+	return at.ExpiresAt
+}
+
+//ExpiresIn returns the number of seconds a client can use this token, it is a bit shorter than
+// the actual remaining lifetime so clients request a new token before this one expires
+func (at *AccessToken) ExpiresIn(now time.Time) int64 {
+	margin := at.ExpirationTime().Sub(at.CreatedAt) / 10
+	if margin > maxExpiresInMargin {
+		margin = maxExpiresInMargin
+	}
+	return int64(at.ExpirationTime().Sub(now).Seconds() - margin.Seconds())
 }
 
-func newAccessToken(username, globalID, clientID, scope string) *AccessToken {
+//accessTokenValidity returns the lifetime of the access tokens handed out to a client
+// The client_id of an organization is its globalid, user api keys get the default lifetime
+func accessTokenValidity(clientID string, orgMgr *organization.Manager) (validity time.Duration, err error) {
+	validity = AccessTokenExpiration
+	seconds, err := orgMgr.GetAccessTokenValidity(clientID)
+	if err == mgo.ErrNotFound {
+		err = nil
+		return
+	}
+	if err == nil && seconds > 0 {
+		validity = time.Second * time.Duration(seconds)
+	}
+	return
+}
+
+func newAccessToken(username, globalID, clientID, scope string, validity time.Duration) *AccessToken {
 	var at AccessToken
 
 	randombytes := make([]byte, 21) //Multiple of 3 to make sure no padding is added
 	rand.Read(randombytes)
 	at.AccessToken = base64.URLEncoding.EncodeToString(randombytes)
 	at.CreatedAt = time.Now()
+	at.ExpiresAt = at.CreatedAt.Add(validity)
 	at.Username = username
 	at.GlobalID = globalID
 	at.ClientID = clientID
@@ -72,22 +110,33 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var clientID, clientSecret string
 	code := r.FormValue("code")
 	grantType := r.FormValue("grant_type")
-	clientSecret = r.FormValue("client_secret")
-	clientID = r.FormValue("client_id")
-
-	//If clientSecret if missing from form data check if its available as basicauth
-	//See https://tools.ietf.org/html/rfc6749#section-2.3.1
-	if clientSecret == "" {
-		var ok bool
-		clientID, clientSecret, ok = r.BasicAuth()
-		if !ok {
-			log.Debug("clientSecret not found in form data nor basicauth")
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	codeVerifier := r.FormValue("code_verifier")
+	clientID, clientSecret := getClientCredentials(r)
+
+	//Instead of the secret, a client can authenticate with a jwt signed with one of the organization's public keys
+	if r.FormValue("client_assertion") != "" {
+		clientID, clientSecret, err = service.clientAssertionCredentials(r, grantType)
+		if err == errInvalidClientAssertion {
+			log.Debug("Invalid client assertion")
+			writeOAuthError(w, errorInvalidClient)
 			return
 		}
+		if err != nil {
+			log.Error("Error authenticating a client assertion: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	//Public clients can not keep a secret, they redeem an authorization code using the PKCE code_verifier
+	// and use their refresh tokens without secret
+	publicClientRequest := codeVerifier != "" || grantType == RefreshTokenGrantType || grantType == DeviceCodeGrantType
+	if clientSecret == "" && !publicClientRequest {
+		log.Debug("clientSecret not found in form data nor basicauth")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
 	}
 
 	//Also accept some alternatives
@@ -95,19 +144,50 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		grantType = ""
 	}
 
-	if clientSecret == "" || clientID == "" || (grantType == "" && code == "") {
+	if clientID == "" || (grantType == "" && code == "") || (clientSecret == "" && grantType != "" && !publicClientRequest) {
 		log.Debug("Required parameter missing in the request")
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
+	// A refresh token is rotated when it is used, which does not happen when a JWT is handed out instead of an access token
+	if grantType == RefreshTokenGrantType && r.FormValue("response_type") == "id_token" {
+		log.Debug("The id_token response type is not supported for the refresh_token grant")
+		writeOAuthError(w, "unsupported_response_type")
+		return
+	}
+
 	var at *AccessToken
+	var ar *authorizationRequest
+	var usedRefreshToken *refreshToken
+	var errorCode string
 	httpStatusCode := http.StatusOK
 
+	validity, err := accessTokenValidity(clientID, organization.NewManager(r))
+	if err != nil {
+		log.Error("Error getting the access token validity: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// A token exchange results in a jwt instead of an access token
+	if grantType == TokenExchangeGrantType {
+		service.tokenExchangeHandler(w, r, clientID, clientSecret, validity)
+		return
+	}
+
 	mgr := NewManager(r)
 	if grantType != "" {
 		if grantType == ClientCredentialsGrantCodeType {
-			at, httpStatusCode = clientCredentialsTokenHandler(clientID, clientSecret, mgr, r)
+			at, httpStatusCode = clientCredentialsTokenHandler(clientID, clientSecret, validity, mgr, r)
+		} else if grantType == RefreshTokenGrantType {
+			at, usedRefreshToken, httpStatusCode = service.refreshTokenGrantHandler(r, clientID, clientSecret, r.FormValue("refresh_token"), r.FormValue("scope"), validity, mgr)
+		} else if grantType == DeviceCodeGrantType {
+			at, ar, errorCode, httpStatusCode = deviceCodeGrantHandler(clientID, clientSecret, r.FormValue("device_code"), validity, mgr)
+		} else if grantType == PasswordGrantType {
+			at, errorCode, httpStatusCode = service.passwordGrantHandler(r, clientID, clientSecret, validity, mgr)
+		} else if grantType == JWTBearerGrantType {
+			at, errorCode, httpStatusCode = service.jwtBearerGrantHandler(r, clientID, clientSecret, validity, mgr)
 		} else {
 			log.Debug("Invalid grant_type")
 			httpStatusCode = http.StatusBadRequest
@@ -115,13 +195,17 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 	} else {
 		redirectURI := r.FormValue("redirect_uri")
 		state := r.FormValue("state")
-		at, httpStatusCode = convertCodeToAccessTokenHandler(code, clientID, clientSecret, redirectURI, state, mgr)
+		at, ar, httpStatusCode = convertCodeToAccessTokenHandler(code, clientID, clientSecret, redirectURI, state, codeVerifier, validity, mgr)
 	}
 
 	if httpStatusCode != http.StatusOK {
 		http.Error(w, http.StatusText(httpStatusCode), httpStatusCode)
 		return
 	}
+	if errorCode != "" {
+		writeOAuthError(w, errorCode)
+		return
+	}
 
 	// It is also possible to immediately get a JWT by specifying 'id_token' as the response type
 	// In this case, the scope parameter needs to be given to prevent consumers to accidentally handing out too powerful tokens to third party services
@@ -157,6 +241,47 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
+
+	// Refresh tokens are rotated on every use, a refresh token is handed out for the first time
+	// when the offline_access scope was requested in an authorization code flow
+	var rt *refreshToken
+	if usedRefreshToken != nil {
+		successor := usedRefreshToken.rotate()
+		var replaced bool
+		replaced, err = mgr.replaceRefreshToken(usedRefreshToken)
+		if err != nil {
+			log.Error("Failed to rotate the refresh token: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !replaced {
+			// The same refresh token was used concurrently
+			if err = service.revokeRefreshTokenFamily(usedRefreshToken, mgr); err != nil {
+				log.Error("Failed to revoke the refresh token family: ", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		rt = &successor
+	} else if ar != nil {
+		if _, offlineAccessRequested := stripOfflineAccess(oauth2.SplitScopeString(ar.Scope)); offlineAccessRequested {
+			newRT := newRefreshTokenFamily(at)
+			rt = &newRT
+		}
+	}
+	var refreshTokenString string
+	if rt != nil {
+		at.RefreshTokenFamily = rt.Family
+		if err = mgr.saveRefreshToken(rt); err != nil {
+			log.Error("Failed to save the refresh token: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		refreshTokenString = rt.RefreshToken
+	}
+
 	mgr.saveAccessToken(at)
 
 	orgMgr := organization.NewManager(r)
@@ -167,17 +292,44 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// An id_token is added when the openid scope was requested in an authorization code flow
+	var idToken string
+	if ar != nil && isOpenIDRequest(at.Scope) {
+		idToken, err = service.createIDToken(r, at, ar)
+		if err != nil {
+			log.Error("Failed to create id_token: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// For a token issued after the user authorized the client, tell which scopes are granted for the first time
+	var newScope, previousScope string
+	if ar != nil {
+		newScopes, previousScopes := splitNewScopes(strings.Split(scope, ","), oauth2.SplitScopeString(ar.NewScope), at.ClientID)
+		newScope = strings.Join(newScopes, ",")
+		previousScope = strings.Join(previousScopes, ",")
+	}
+
 	response := struct {
-		AccessToken string      `json:"access_token"`
-		TokenType   string      `json:"token_type"`
-		Scope       string      `json:"scope"`
-		ExpiresIn   int64       `json:"expires_in"`
-		Info        interface{} `json:"info"`
+		AccessToken   string      `json:"access_token"`
+		TokenType     string      `json:"token_type"`
+		Scope         string      `json:"scope"`
+		NewScope      string      `json:"new_scope,omitempty"`
+		PreviousScope string      `json:"previous_scope,omitempty"`
+		ExpiresIn     int64       `json:"expires_in"`
+		RefreshToken  string      `json:"refresh_token,omitempty"`
+		IDToken       string      `json:"id_token,omitempty"`
+		Info          interface{} `json:"info"`
 	}{
-		AccessToken: at.AccessToken,
-		TokenType:   at.Type,
-		Scope:       scope,
-		ExpiresIn:   int64(at.ExpirationTime().Sub(time.Now()).Seconds() - 600),
+		AccessToken:   at.AccessToken,
+		TokenType:     at.Type,
+		Scope:         scope,
+		NewScope:      newScope,
+		PreviousScope: previousScope,
+		ExpiresIn:     at.ExpiresIn(time.Now()),
+		RefreshToken:  refreshTokenString,
+		IDToken:       idToken,
 
 		Info: struct {
 			Username string `json:"username"`
@@ -190,7 +342,43 @@ func (service *Service) AccessTokenHandler(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(&response)
 }
 
-func clientCredentialsTokenHandler(clientID string, secret string, mgr *Manager, r *http.Request) (at *AccessToken, httpStatusCode int) {
+//splitNewScopes divides the scopes of a token in the scopes the user authorized during the authorization request
+// and the scopes that were granted before
+// The memberof scope of the client itself can be replaced by the memberof scopes of its suborganizations, these follow the original scope
+func splitNewScopes(scopes []string, authorizedScopes []string, clientID string) (newScopes []string, previousScopes []string) {
+	isNew := make(map[string]bool, len(authorizedScopes))
+	for _, scope := range authorizedScopes {
+		isNew[scope] = true
+	}
+	clientMemberOfScope := "user:memberof:" + clientID
+	for _, scope := range scopes {
+		if scope == "" {
+			continue
+		}
+		if isNew[scope] || (isNew[clientMemberOfScope] && strings.HasPrefix(scope, clientMemberOfScope+".")) {
+			newScopes = append(newScopes, scope)
+		} else {
+			previousScopes = append(previousScopes, scope)
+		}
+	}
+	return
+}
+
+//getClientCredentials returns the client_id and client_secret from the form data,
+// if the client_secret is missing from the form data, the basic auth header is checked
+// See https://tools.ietf.org/html/rfc6749#section-2.3.1
+func getClientCredentials(r *http.Request) (clientID, clientSecret string) {
+	clientID = r.FormValue("client_id")
+	clientSecret = r.FormValue("client_secret")
+	if clientSecret == "" {
+		if basicAuthClientID, basicAuthSecret, ok := r.BasicAuth(); ok {
+			clientID, clientSecret = basicAuthClientID, basicAuthSecret
+		}
+	}
+	return
+}
+
+func clientCredentialsTokenHandler(clientID string, secret string, validity time.Duration, mgr *Manager, r *http.Request) (at *AccessToken, httpStatusCode int) {
 	httpStatusCode = http.StatusOK
 	var scopes string
 	username := ""
@@ -225,11 +413,11 @@ func clientCredentialsTokenHandler(clientID string, secret string, mgr *Manager,
 		scopes = "organization:owner"
 	}
 
-	at = newAccessToken(username, organization, clientID, scopes)
+	at = newAccessToken(username, organization, clientID, scopes, validity)
 	return
 }
 
-func convertCodeToAccessTokenHandler(code string, clientID string, secret string, redirectURI string, state string, mgr *Manager) (at *AccessToken, httpStatusCode int) {
+func convertCodeToAccessTokenHandler(code string, clientID string, secret string, redirectURI string, state string, codeVerifier string, validity time.Duration, mgr *Manager) (at *AccessToken, ar *authorizationRequest, httpStatusCode int) {
 	httpStatusCode = http.StatusOK
 
 	ar, err := mgr.getAuthorizationRequest(code)
@@ -259,7 +447,24 @@ func convertCodeToAccessTokenHandler(code string, clientID string, secret string
 		return
 	}
 
-	client, err := mgr.getClientByCredentials(clientID, secret)
+	if ar.CodeChallenge != "" && !verifyCodeVerifier(codeVerifier, ar.CodeChallenge, ar.CodeChallengeMethod) {
+		log.Info("The code_verifier does not match the code_challenge of the original authorization request")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	var client *Oauth2Client
+	if secret == "" {
+		//Without a secret, the code_verifier is the only proof the client started the authorization request
+		if ar.CodeChallenge == "" {
+			log.Info("No client secret given for an authorization request without code_challenge")
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		client, err = mgr.getPublicClient(clientID, redirectURI)
+	} else {
+		client, err = mgr.getClientByCredentials(clientID, secret)
+	}
 	if err != nil {
 		log.Error("Error getting the oauth client: ", err)
 		httpStatusCode = http.StatusInternalServerError
@@ -271,18 +476,95 @@ func convertCodeToAccessTokenHandler(code string, clientID string, secret string
 		return
 	}
 
-	if !strings.HasPrefix(redirectURI, client.CallbackURL) {
+	if !client.MatchesRedirectURI(redirectURI) {
 		log.Debug("return_uri does not match the callback uri")
 		httpStatusCode = http.StatusBadRequest
 		return
 	}
 
-	at = newAccessToken(ar.Username, "", ar.ClientID, ar.Scope)
+	// offline_access only results in a refresh token, it is not part of the access token's scope
+	scopes, _ := stripOfflineAccess(oauth2.SplitScopeString(ar.Scope))
+	at = newAccessToken(ar.Username, "", ar.ClientID, strings.Join(scopes, ","), validity)
+	return
+}
+
+//refreshTokenGrantHandler validates the refresh token presented in a refresh_token grant and creates a new access token
+// The returned refresh token is the one that was used, it still needs to be rotated
+// See https://tools.ietf.org/html/rfc6749#section-6
+func (service *Service) refreshTokenGrantHandler(r *http.Request, clientID, secret, refreshTokenString, requestedScopeString string, validity time.Duration, mgr *Manager) (at *AccessToken, rt *refreshToken, httpStatusCode int) {
+	httpStatusCode = http.StatusOK
+
+	authenticated, err := mgr.authenticateClient(clientID, secret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if !authenticated {
+		log.Info("Client authentication failed")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	storedRT, err := mgr.getRefreshToken(refreshTokenString)
+	if err != nil {
+		log.Error("Error getting the refresh token: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	// Refresh tokens embedded in a jwt do not have a family, they can only be used to refresh the jwt
+	if storedRT == nil || storedRT.Family == "" || storedRT.AuthorizedParty != clientID || storedRT.IsExpiredAt(time.Now()) {
+		log.Debug("Invalid refresh token")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if storedRT.IsUsed() {
+		if err = service.revokeRefreshTokenFamily(storedRT, mgr); err != nil {
+			log.Error("Failed to revoke the refresh token family: ", err)
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// The user might have revoked (a part of) the authorization in the meantime
+	authorizedScopes, err := service.identityService.FilterAuthorizedScopes(r, storedRT.Subject, clientID, storedRT.Scopes)
+	if err != nil {
+		log.Error("Error while filtering the authorized scopes: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if authorizedScopes == nil {
+		log.Debug("The authorization for the refresh token is removed")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	// A client may request less scopes than originally granted, but not more
+	scopes := authorizedScopes
+	if requestedScopes := oauth2.SplitScopeString(requestedScopeString); len(requestedScopes) > 0 {
+		if !IsAuthorizationValid(requestedScopes, authorizedScopes) {
+			log.Debug("Requested scopes exceed the scopes of the refresh token")
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		scopes = requestedScopes
+	}
+
+	rt = storedRT
+	at = newAccessToken(rt.Subject, "", clientID, strings.Join(scopes, ","), validity)
 	return
 }
 
+//revokeRefreshTokenFamily removes all refresh tokens and the access tokens issued with them after a refresh token was used twice
+// Either the client or an attacker has a stolen refresh token, there is no way to tell which one is legitimate
+func (service *Service) revokeRefreshTokenFamily(rt *refreshToken, mgr *Manager) error {
+	log.Warnf("Refresh token reuse detected for user %s and client %s, revoking the token family", rt.Subject, rt.AuthorizedParty)
+	return mgr.removeRefreshTokenFamily(rt.Family)
+}
+
 func (service *Service) createItsYouOnlineAdminToken(username string, r *http.Request) (token string, err error) {
-	at := newAccessToken(username, "", "itsyouonline", "admin")
+	at := newAccessToken(username, "", "itsyouonline", "admin", AccessTokenExpiration)
 
 	mgr := NewManager(r)
 	err = mgr.saveAccessToken(at)
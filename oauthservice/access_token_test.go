@@ -1,6 +1,7 @@
 package oauthservice
 
 import (
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -13,15 +14,69 @@ func TestAccessTokenExpiration(t *testing.T) {
 
 	assert.True(t, ar.IsExpiredAt(ar.CreatedAt.Add(AccessTokenExpiration).Add(time.Second)))
 	assert.False(t, ar.IsExpiredAt(ar.CreatedAt.Add(AccessTokenExpiration)))
+
+	ar = newAccessToken("user1", "", "client1", "scope", time.Minute*5)
+	assert.True(t, ar.IsExpiredAt(ar.CreatedAt.Add(time.Minute*5).Add(time.Second)))
+	assert.False(t, ar.IsExpiredAt(ar.CreatedAt.Add(time.Minute*5)))
+}
+
+func TestAccessTokenExpiresIn(t *testing.T) {
+	at := newAccessToken("user1", "", "client1", "scope", AccessTokenExpiration)
+	assert.Equal(t, int64(AccessTokenExpiration.Seconds()-600), at.ExpiresIn(at.CreatedAt))
+
+	at = newAccessToken("user1", "", "client1", "scope", time.Minute*5)
+	assert.Equal(t, int64(270), at.ExpiresIn(at.CreatedAt))
+	assert.Equal(t, int64(210), at.ExpiresIn(at.CreatedAt.Add(time.Minute)))
 }
 
 func TestNewAccessToken(t *testing.T) {
-	at := newAccessToken("user1", "globalid1", "client1", "scope")
+	at := newAccessToken("user1", "globalid1", "client1", "scope", AccessTokenExpiration)
 	assert.NotEmpty(t, at.AccessToken)
 	assert.False(t, strings.HasSuffix(at.AccessToken, "="))
 	assert.NotEqual(t, time.Time{}, at.CreatedAt)
+	assert.Equal(t, at.CreatedAt.Add(AccessTokenExpiration), at.ExpirationTime())
 	assert.Equal(t, "user1", at.Username)
 	assert.Equal(t, "client1", at.ClientID)
 	assert.Equal(t, "globalid1", at.GlobalID)
 	assert.Equal(t, "scope", at.Scope)
 }
+
+func TestGetClientCredentials(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/oauth/revoke?client_id=client1&client_secret=secret1", nil)
+	r.SetBasicAuth("client2", "secret2")
+	clientID, clientSecret := getClientCredentials(r)
+	assert.Equal(t, "client1", clientID)
+	assert.Equal(t, "secret1", clientSecret)
+
+	r = httptest.NewRequest("POST", "/v1/oauth/revoke?client_id=client1", nil)
+	r.SetBasicAuth("client2", "secret2")
+	clientID, clientSecret = getClientCredentials(r)
+	assert.Equal(t, "client2", clientID)
+	assert.Equal(t, "secret2", clientSecret)
+
+	r = httptest.NewRequest("POST", "/v1/oauth/revoke?client_id=client1", nil)
+	clientID, clientSecret = getClientCredentials(r)
+	assert.Equal(t, "client1", clientID)
+	assert.Equal(t, "", clientSecret)
+}
+
+func TestSplitNewScopes(t *testing.T) {
+	scopes := []string{"user:name", "user:email:main", "user:memberof:testorg.suborg", ""}
+
+	newScopes, previousScopes := splitNewScopes(scopes, []string{"user:email:main", "user:memberof:testorg"}, "testorg")
+	assert.Equal(t, []string{"user:email:main", "user:memberof:testorg.suborg"}, newScopes)
+	assert.Equal(t, []string{"user:name"}, previousScopes)
+
+	newScopes, previousScopes = splitNewScopes(scopes, nil, "testorg")
+	assert.Empty(t, newScopes)
+	assert.Equal(t, []string{"user:name", "user:email:main", "user:memberof:testorg.suborg"}, previousScopes)
+}
+
+func TestRefreshTokenGrantRejectsIDTokenResponseType(t *testing.T) {
+	service := &Service{}
+	r := httptest.NewRequest("POST", "/v1/oauth/access_token?grant_type=refresh_token&client_id=client1&refresh_token=token1&response_type=id_token&scope=user:name", nil)
+	w := httptest.NewRecorder()
+	service.AccessTokenHandler(w, r)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "unsupported_response_type")
+}
@@ -11,6 +11,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/credentials/oauth2"
 	organizationdb "github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
 )
 
 type authorizationRequest struct {
@@ -20,7 +21,16 @@ type authorizationRequest struct {
 	ClientID          string
 	State             string
 	Scope             string
-	CreatedAt         time.Time
+	//NewScope are the scopes the user authorized on the authorize page during this request, the other scopes were granted before
+	NewScope  string
+	CreatedAt time.Time
+	//Nonce, AuthTime and ACR are only relevant in an OpenID Connect flow, they end up in the id_token
+	Nonce    string
+	AuthTime time.Time
+	ACR      string
+	//CodeChallenge and CodeChallengeMethod are set when the client uses PKCE
+	CodeChallenge       string
+	CodeChallengeMethod string
 }
 
 func (ar *authorizationRequest) IsExpiredAt(testtime time.Time) bool {
@@ -62,7 +72,7 @@ func validateRedirectURI(mgr ClientManager, redirectURI string, clientID string)
 		return
 	}
 
-	//For now, just check if the redirectURI is registered in 'a' apikey
+	//Check if the redirectURI is registered in 'a' apikey
 	//The redirect_uri is saved in the authorization request and during
 	// the access_token request when the secret is available, check again against the known value
 	clients, err := mgr.AllByClientID(clientID)
@@ -73,8 +83,8 @@ func validateRedirectURI(mgr ClientManager, redirectURI string, clientID string)
 
 	match := false
 	for _, client := range clients {
-		log.Debug("Possible redirect_uri: ", client.Label, "\n ", client.CallbackURL)
-		match = match || strings.HasPrefix(redirectURI, client.CallbackURL)
+		log.Debug("Possible redirect_uris: ", client.Label, "\n ", client.RegisteredCallbackURLs())
+		match = match || client.MatchesRedirectURI(redirectURI)
 	}
 	valid = valid && match
 
@@ -94,13 +104,17 @@ func redirectToNextPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func redirectToScopeRequestPage(w http.ResponseWriter, r *http.Request, possibleScopes []string) {
-	var possibleScopesString string
-	if possibleScopes != nil {
-		possibleScopesString = strings.Join(possibleScopes, ",")
-	}
+//redirectToScopeRequestPage sends the user to the authorize page
+// If the user already authorized some of the scopes, only the new scopes are asked
+// For a pushed authorization request the scopes are not added to the url, the authorize page gets them from the par scopes endpoint
+func redirectToScopeRequestPage(w http.ResponseWriter, r *http.Request, possibleScopes []string, newScopes []string) {
 	queryvalues := r.URL.Query()
-	queryvalues.Set("scope", possibleScopesString)
+	if r.Form.Get("request_uri") == "" {
+		queryvalues.Set("scope", strings.Join(possibleScopes, ","))
+		if newScopes != nil {
+			queryvalues.Set("newscope", strings.Join(newScopes, ","))
+		}
+	}
 	queryvalues.Add("endpoint", r.URL.EscapedPath())
 	//TODO: redirect according the the received http method
 	http.Redirect(w, r, "/authorize?"+queryvalues.Encode(), http.StatusFound)
@@ -125,6 +139,19 @@ func (service *Service) AuthorizeHandler(w http.ResponseWriter, request *http.Re
 		return
 	}
 
+	//The parameters can be pushed to the par endpoint before, the request only contains the request_uri then
+	mgr := NewManager(request)
+	par, validPAR, err := resolvePushedAuthorizationRequest(request, mgr)
+	if err != nil {
+		log.Error("Error resolving the request_uri: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !validPAR {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
 	//Check if the requested authorization grant type is supported
 	requestedResponseType := request.Form.Get("response_type")
 	if requestedResponseType != AuthorizationGrantCodeType {
@@ -133,26 +160,20 @@ func (service *Service) AuthorizeHandler(w http.ResponseWriter, request *http.Re
 		return
 	}
 
+	if !isValidCodeChallenge(request.Form.Get("code_challenge"), request.Form.Get("code_challenge_method")) {
+		log.Debug("Invalid code_challenge or code_challenge_method")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
 	//Check if the user is already authenticated, if not, redirect to the login page before returning here
-	var protectedSession bool
-	username, err := service.GetWebuser(request, w)
+	username, protectedSession, err := service.getAuthenticatedUser(w, request)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 	if username == "" {
-		username, err = service.GetOauthUser(request, w)
-		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-		if username != "" {
-			log.Debug("protected session")
-			protectedSession = true
-		} else {
-			redirectToNextPage(w, request)
-			return
-		}
+		return
 	}
 
 	//Validate client and redirect_uri
@@ -163,7 +184,6 @@ func (service *Service) AuthorizeHandler(w http.ResponseWriter, request *http.Re
 		return
 	}
 	clientID := request.Form.Get("client_id")
-	mgr := NewManager(request)
 	valid, err := validateRedirectURI(mgr, redirectURI, clientID)
 	if err != nil {
 		log.Error(err)
@@ -175,35 +195,87 @@ func (service *Service) AuthorizeHandler(w http.ResponseWriter, request *http.Re
 		return
 	}
 
-	requestedScopes := oauth2.SplitScopeString(request.Form.Get("scope"))
-	possibleScopes, err := service.filterPossibleScopes(request, username, requestedScopes, true)
+	authorizedScopeString, newScopeString, validAuthorization, err := service.getAuthorizedScopes(w, request, username, clientID, protectedSession)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !validAuthorization {
+		return
+	}
+
+	if clientID == "itsyouonline" {
+		log.Warn("HACK attempt, someone tried to get a token as the 'itsyouonline' client")
+		//TODO: log the entire request and everything we know
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	authTime, acr, err := service.getAuthenticationContext(w, request, protectedSession)
 	if err != nil {
 		log.Error(err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	redirectURI, err = handleAuthorizationGrantCodeType(request, username, clientID, redirectURI, authorizedScopeString, newScopeString, authTime, acr)
 
-	authorizedScopes, err := service.filterAuthorizedScopes(request, username, clientID, possibleScopes)
 	if err != nil {
 		log.Error(err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	//A request_uri can only be used for one authorization code
+	if par != nil {
+		if err = mgr.removePushedAuthorizationRequest(par.RequestURI); err != nil {
+			log.Error("Error removing the pushed authorization request: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.Redirect(w, request, redirectURI, http.StatusFound)
 
-	var authorizedScopeString string
-	var validAuthorization bool
+}
 
+//getAuthenticatedUser returns the logged in user, protectedSession is true if the user logged in without 2FA because of a recent 2FA login for this client
+// If no user is logged in, the user is redirected to the login page before returning to the current request and the returned username is empty
+func (service *Service) getAuthenticatedUser(w http.ResponseWriter, request *http.Request) (username string, protectedSession bool, err error) {
+	username, err = service.GetWebuser(request, w)
+	if err != nil || username != "" {
+		return
+	}
+	username, err = service.GetOauthUser(request, w)
+	if err != nil {
+		return
+	}
+	if username != "" {
+		log.Debug("protected session")
+		protectedSession = true
+		return
+	}
+	redirectToNextPage(w, request)
+	return
+}
+
+//getAuthorizedScopes filters the requested scopes in the scope parameter to the ones the user authorized for the client
+// If the user did not authorize all possible requested scopes yet, the user is redirected to give the authorization before returning to the current request and validAuthorization is false
+// When returning from the authorize page, newScopeString contains the scopes the user just authorized
+func (service *Service) getAuthorizedScopes(w http.ResponseWriter, request *http.Request, username string, clientID string, protectedSession bool) (authorizedScopeString string, newScopeString string, validAuthorization bool, err error) {
+	possibleScopes, authorizedScopes, consent, err := service.getScopeAuthorizations(request, username, clientID)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
 	if authorizedScopes != nil {
 		authorizedScopeString = strings.Join(authorizedScopes, ",")
-		validAuthorization = IsAuthorizationValid(possibleScopes, authorizedScopes)
+		validAuthorization = IsConsentValid(possibleScopes, authorizedScopes, consent, now)
 		//Check if we are redirected from the authorize page, it might be that not all authorizations were given,
 		// authorize the login but only with the authorized scopes
-		referrer := request.Header.Get("Referer")
-		if referrer != "" && !validAuthorization { //If we already have a valid authorization, no need to check if we come from the authorize page
-			if referrerURL, e := url.Parse(referrer); e == nil {
-				validAuthorization = referrerURL.Host == request.Host && referrerURL.Path == "/authorize"
-			} else {
-				log.Debug("Error parsing referrer: ", e)
+		if isRedirectedFromAuthorizePage(request) {
+			validAuthorization = true
+			if consent != nil {
+				newScopeString = strings.Join(filterScopes(authorizedScopes, consent.NewlyApprovedScopes()), ",")
 			}
 		}
 	}
@@ -216,51 +288,107 @@ func (service *Service) AuthorizeHandler(w http.ResponseWriter, request *http.Re
 			// This way the login function will require 2fa and give a full session with admin scopes
 			l2faMgr := organizationdb.NewLast2FAManager(request)
 			if l2faMgr.Exists(clientID, username) {
-				err = l2faMgr.RemoveLast2FA(clientID, username)
-				if err != nil {
-					log.Error(err)
-					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				if err = l2faMgr.RemoveLast2FA(clientID, username); err != nil {
 					return
 				}
 			}
 			redirectToNextPage(w, request)
 			return
 		}
-		token, e := service.createItsYouOnlineAdminToken(username, request)
-		if e != nil {
-			log.Error(e)
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		var token string
+		token, err = service.createItsYouOnlineAdminToken(username, request)
+		if err != nil {
 			return
 		}
 		service.sessionService.SetAPIAccessToken(w, token)
-		redirectToScopeRequestPage(w, request, possibleScopes)
+		redirectToScopeRequestPage(w, request, possibleScopes, scopesToAsk(possibleScopes, authorizedScopes, consent, now))
 		return
 	}
+	return
+}
 
-	if clientID == "itsyouonline" {
-		log.Warn("HACK attempt, someone tried to get a token as the 'itsyouonline' client")
-		//TODO: log the entire request and everything we know
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+//getScopeAuthorizations returns the requested scopes the user can authorize for the client, the ones the user already authorized and the latest consent
+func (service *Service) getScopeAuthorizations(request *http.Request, username string, clientID string) (possibleScopes []string, authorizedScopes []string, consent *user.Consent, err error) {
+	requestedScopes := oauth2.SplitScopeString(request.Form.Get("scope"))
+	possibleScopes, err = service.filterPossibleScopes(request, username, requestedScopes, true)
+	if err != nil {
 		return
 	}
-	redirectURI, err = handleAuthorizationGrantCodeType(request, username, clientID, redirectURI, authorizedScopeString)
-
+	authorizedScopes, err = service.filterAuthorizedScopes(request, username, clientID, possibleScopes)
 	if err != nil {
-		log.Error(err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, request, redirectURI, http.StatusFound)
+	consent, err = service.identityService.GetLatestConsent(request, username, clientID)
+	return
+}
 
+//scopesToAsk returns the scopes to ask on the authorize page if the user does not need to decide on all possible scopes
+// With a standing consent, the user only needs to decide on the scopes that are requested for the first time
+func scopesToAsk(possibleScopes []string, authorizedScopes []string, consent *user.Consent, now time.Time) (newScopes []string) {
+	if authorizedScopes != nil && (consent == nil || !consent.IsExpired(now)) {
+		newScopes = undecidedScopes(possibleScopes, authorizedScopes, consent)
+	}
+	return
 }
 
-func handleAuthorizationGrantCodeType(r *http.Request, username, clientID, redirectURI, scopes string) (correctedRedirectURI string, err error) {
+//isRedirectedFromAuthorizePage checks if the user comes from the authorize page where the authorization was just given
+func isRedirectedFromAuthorizePage(request *http.Request) bool {
+	referrer := request.Header.Get("Referer")
+	if referrer == "" {
+		return false
+	}
+	referrerURL, err := url.Parse(referrer)
+	if err != nil {
+		log.Debug("Error parsing referrer: ", err)
+		return false
+	}
+	return referrerURL.Host == request.Host && referrerURL.Path == "/authorize"
+}
+
+//undecidedScopes returns the possible scopes that are not authorized and were not declined in the consent
+func undecidedScopes(possibleScopes []string, authorizedScopes []string, consent *user.Consent) (scopes []string) {
+	scopes = []string{}
+	for _, scope := range possibleScopes {
+		if len(filterScopes([]string{scope}, authorizedScopes)) == 0 && (consent == nil || !consent.IsDeclined(scope)) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return
+}
+
+//getAuthenticationContext returns the time the user authenticated and the acr value for the id_token
+func (service *Service) getAuthenticationContext(w http.ResponseWriter, request *http.Request, protectedSession bool) (authTime time.Time, acr string, err error) {
+	authTime, err = service.sessionService.GetAuthTime(request, w)
+	if err != nil {
+		return
+	}
+	acr = acrTwoFactor
+	if protectedSession {
+		acr = acrPassword
+	}
+	return
+}
+
+func handleAuthorizationGrantCodeType(r *http.Request, username, clientID, redirectURI, scopes, newScopes string, authTime time.Time, acr string) (correctedRedirectURI string, err error) {
 	correctedRedirectURI = redirectURI
 	log.Debug("Handling authorization grant code type for user ", username, ", ", clientID, " is asking for ", scopes)
 	clientState := r.Form.Get("state")
 	//TODO: validate state (length and stuff)
 
 	ar := newAuthorizationRequest(username, clientID, clientState, scopes, redirectURI)
+	ar.NewScope = newScopes
+	if isOpenIDRequest(scopes) {
+		ar.Nonce = r.Form.Get("nonce")
+		ar.AuthTime = authTime
+		ar.ACR = acr
+	}
+	if codeChallenge := r.Form.Get("code_challenge"); codeChallenge != "" {
+		ar.CodeChallenge = codeChallenge
+		ar.CodeChallengeMethod = r.Form.Get("code_challenge_method")
+		if ar.CodeChallengeMethod == "" {
+			ar.CodeChallengeMethod = CodeChallengeMethodPlain
+		}
+	}
 	mgr := NewManager(r)
 	err = mgr.saveAuthorizationRequest(ar)
 	if err != nil {
@@ -283,6 +411,18 @@ func handleAuthorizationGrantCodeType(r *http.Request, username, clientID, redir
 	return
 }
 
+// IsConsentValid checks if the standing authorization and the latest consent of the user still cover the possible scopes
+// Scopes the user explicitly declined do not need to be authorized, once the consent expired the user needs to give consent again
+func IsConsentValid(possibleScopes []string, authorizedScopes []string, consent *user.Consent, now time.Time) bool {
+	if consent == nil {
+		return IsAuthorizationValid(possibleScopes, authorizedScopes)
+	}
+	if consent.IsExpired(now) {
+		return false
+	}
+	return IsAuthorizationValid(consent.FilterDeclinedScopes(possibleScopes), authorizedScopes)
+}
+
 // IsAuthorizationValid checks if the possible scopes that are being requested are already authorized
 func IsAuthorizationValid(possibleScopes []string, authorizedScopes []string) bool {
 	if len(possibleScopes) > len(authorizedScopes) {
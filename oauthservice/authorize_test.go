@@ -1,10 +1,15 @@
 package oauthservice
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/itsyouonline/identityserver/db"
+	"github.com/itsyouonline/identityserver/db/user"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,6 +41,69 @@ func TestIsValidAuthorization(t *testing.T) {
 	assert.True(t, IsAuthorizationValid([]string{"user:name", "user:email:main", "user:memberof:testorg"}, authorizedScopes))
 }
 
+func TestIsConsentValid(t *testing.T) {
+	now := time.Now()
+	authorizedScopes := []string{"user:name", "user:memberof:testorg"}
+	possibleScopes := []string{"user:name", "user:email:main", "user:memberof:testorg"}
+	consent := &user.Consent{
+		Scopes: []user.ScopeConsent{
+			{Scope: "user:name", Approved: true},
+			{Scope: "user:email:main", Approved: false},
+			{Scope: "user:memberof:testorg", Approved: true},
+		},
+	}
+	assert.False(t, IsConsentValid(possibleScopes, authorizedScopes, nil, now))
+	assert.True(t, IsConsentValid(possibleScopes, authorizedScopes, consent, now))
+	assert.False(t, IsConsentValid(append(possibleScopes, "user:phone"), authorizedScopes, consent, now))
+
+	expiresAt := db.DateTime(now.Add(time.Hour))
+	consent.ExpiresAt = &expiresAt
+	assert.True(t, IsConsentValid(possibleScopes, authorizedScopes, consent, now))
+	assert.False(t, IsConsentValid(possibleScopes, authorizedScopes, consent, now.Add(2*time.Hour)))
+}
+
+func TestUndecidedScopes(t *testing.T) {
+	possibleScopes := []string{"user:name", "user:email:main", "user:phone", "user:memberof:testorg"}
+	authorizedScopes := []string{"user:name"}
+	consent := &user.Consent{
+		Scopes: []user.ScopeConsent{
+			{Scope: "user:name", Approved: true},
+			{Scope: "user:email:main", Approved: false},
+		},
+	}
+	assert.Equal(t, []string{"user:phone", "user:memberof:testorg"}, undecidedScopes(possibleScopes, authorizedScopes, consent))
+	assert.Equal(t, []string{"user:email:main", "user:phone", "user:memberof:testorg"}, undecidedScopes(possibleScopes, authorizedScopes, nil))
+}
+
+func TestRedirectToScopeRequestPage(t *testing.T) {
+	scopes := []string{"user:name", "user:email:main"}
+	newScopes := []string{"user:email:main"}
+
+	r := httptest.NewRequest("GET", "/v1/oauth/authorize?client_id=client&response_type=code&scope=user:name,user:email:main", nil)
+	r.ParseForm()
+	w := httptest.NewRecorder()
+	redirectToScopeRequestPage(w, r, scopes, newScopes)
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, "/authorize", location.Path)
+	assert.Equal(t, "user:name,user:email:main", location.Query().Get("scope"))
+	assert.Equal(t, "user:email:main", location.Query().Get("newscope"))
+	assert.Equal(t, "/v1/oauth/authorize", location.Query().Get("endpoint"))
+
+	//The scopes of a pushed authorization request stay out of the url
+	r = httptest.NewRequest("GET", "/v1/oauth/authorize?client_id=client&request_uri="+url.QueryEscape(requestURIPrefix+"abc"), nil)
+	r.ParseForm()
+	r.Form.Set("scope", "user:name,user:email:main")
+	w = httptest.NewRecorder()
+	redirectToScopeRequestPage(w, r, scopes, newScopes)
+	location, _ = url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, url.Values{
+		"client_id":   {"client"},
+		"request_uri": {requestURIPrefix + "abc"},
+		"endpoint":    {"/v1/oauth/authorize"},
+	}, location.Query())
+}
+
 type testClientManager struct {
 	clients []*Oauth2Client
 }
@@ -60,7 +128,10 @@ func TestValidateRedirectURI(t *testing.T) {
 		testcase{redirectURI: "https://itsyou.online", valid: false},
 		testcase{redirectURI: "https://test.itsyou.online", valid: false},
 		testcase{redirectURI: "https://test.itsyou.online:443", valid: false},
-		testcase{redirectURI: "http://www.url.com/callback/subpath", valid: true},
+		testcase{redirectURI: "http://www.url.com/callback", valid: true},
+		testcase{redirectURI: "http://www.url.com/callback/subpath", valid: false},
+		testcase{redirectURI: "http://www.url.com/callbackevil", valid: false},
+		testcase{redirectURI: "http://www.url.com.evil.net/callback", valid: false},
 	}
 	for i, test := range testcases {
 		valid, err := validateRedirectURI(mgr, test.redirectURI, "clientID")
@@ -3,6 +3,18 @@ package oauthservice
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	//DefaultSecretRotationGracePeriod is how long the previous secret is accepted after a secret rotation is started
+	DefaultSecretRotationGracePeriod = 24 * time.Hour
+	//MaxSecretRotationGracePeriod is the maximum grace period of a secret rotation
+	MaxSecretRotationGracePeriod = 30 * 24 * time.Hour
 )
 
 //Oauth2Client is an oauth2 client
@@ -12,6 +24,33 @@ type Oauth2Client struct {
 	Secret                     string
 	CallbackURL                string
 	ClientCredentialsGrantType bool //ClientCredentialsGrantType indicates if this client can be used in an oauth2 client credentials grant flow
+	PublicClient               bool //PublicClient indicates the client can not keep the secret confidential (mobile and javascript apps), it redeems authorization codes using PKCE without secret
+	//AdditionalCallbackURLs are the redirect uris this client can use besides the CallbackURL
+	AdditionalCallbackURLs []string `bson:"additionalcallbackurls,omitempty"`
+	//WildcardCallbackURLs allows callback urls ending with '/*' to match all paths below it
+	WildcardCallbackURLs bool `bson:"wildcardcallbackurls,omitempty"`
+	//LoopbackCallbackURLs allows native applications to use any port on loopback callback urls
+	// See https://tools.ietf.org/html/rfc8252#section-7.3
+	LoopbackCallbackURLs bool `bson:"loopbackcallbackurls,omitempty"`
+	//PasswordGrantType allows a trusted first-party client to exchange the username and password of a user for an access token
+	PasswordGrantType bool `bson:"passwordgranttype,omitempty"`
+	//JWTBearerGrantType allows a trusted first-party client to get an access token for a user with a jwt signed by one of the organization's public keys
+	// See https://tools.ietf.org/html/rfc7523#section-2.1
+	JWTBearerGrantType bool `bson:"jwtbearergranttype,omitempty"`
+	//PrivateKeyJWT allows the client to authenticate on the token endpoint with a jwt signed by one of the organization's public keys
+	// See https://tools.ietf.org/html/rfc7523#section-2.2
+	PrivateKeyJWT bool `bson:"privatekeyjwt,omitempty"`
+	//RequirePushedAuthorizationRequests rejects authorize requests for this client that do not use a request_uri from the par endpoint
+	// See https://tools.ietf.org/html/rfc9126#section-5
+	RequirePushedAuthorizationRequests bool `bson:"requirepushedauthorizationrequests,omitempty"`
+	//LogoURI is the logo of the client application as provided through dynamic client registration
+	LogoURI string `bson:"logouri,omitempty"`
+	//PreviousSecret is the secret that was replaced when a secret rotation was started,
+	// it is accepted until PreviousSecretExpires so running deployments can switch to the new secret
+	PreviousSecret        string    `bson:"previoussecret,omitempty"`
+	PreviousSecretExpires time.Time `bson:"previoussecretexpires,omitempty"`
+	//PreviousSecretLastUsed is the last time the previous secret was used to authenticate
+	PreviousSecretLastUsed time.Time `bson:"previoussecretlastused,omitempty"`
 }
 
 //NewOauth2Client creates a new NewOauth2Client with a random secret
@@ -22,9 +61,128 @@ func NewOauth2Client(clientID, label, callbackURL string, clientCredentialsGrant
 		CallbackURL:                callbackURL,
 		ClientCredentialsGrantType: clientCredentialsGrantType,
 	}
+	c.GenerateSecret()
+	return c
+}
 
+//GenerateSecret replaces the secret of the client by a new random secret
+func (c *Oauth2Client) GenerateSecret() {
 	randombytes := make([]byte, 39) //Multiple of 3 to make sure no padding is added
 	rand.Read(randombytes)
 	c.Secret = base64.URLEncoding.EncodeToString(randombytes)
-	return c
+}
+
+//AllowsGrantType checks if the grant type is enabled for this client, the grants that need to be enabled explicitly are
+// the client credentials, password and jwt bearer grants
+func (c *Oauth2Client) AllowsGrantType(grantType string) bool {
+	switch grantType {
+	case ClientCredentialsGrantCodeType:
+		return c.ClientCredentialsGrantType
+	case PasswordGrantType:
+		return c.PasswordGrantType
+	case JWTBearerGrantType:
+		return c.JWTBearerGrantType
+	}
+	return true
+}
+
+//IsRotatingSecret checks if the previous secret of a secret rotation is still accepted
+func (c *Oauth2Client) IsRotatingSecret(now time.Time) bool {
+	return c.PreviousSecret != "" && now.Before(c.PreviousSecretExpires)
+}
+
+//StartSecretRotation replaces the secret by a new random secret, the current secret is kept as previous secret during the grace period
+func (c *Oauth2Client) StartSecretRotation(gracePeriod time.Duration, now time.Time) {
+	c.PreviousSecret = c.Secret
+	c.PreviousSecretExpires = now.Add(gracePeriod)
+	c.PreviousSecretLastUsed = time.Time{}
+	c.GenerateSecret()
+}
+
+//FinishSecretRotation removes the previous secret
+func (c *Oauth2Client) FinishSecretRotation() {
+	c.PreviousSecret = ""
+	c.PreviousSecretExpires = time.Time{}
+	c.PreviousSecretLastUsed = time.Time{}
+}
+
+//RegisteredCallbackURLs returns all redirect uris registered for this client
+func (c *Oauth2Client) RegisteredCallbackURLs() (callbackURLs []string) {
+	if c.CallbackURL != "" {
+		callbackURLs = append(callbackURLs, c.CallbackURL)
+	}
+	for _, callbackURL := range c.AdditionalCallbackURLs {
+		if callbackURL != "" {
+			callbackURLs = append(callbackURLs, callbackURL)
+		}
+	}
+	return
+}
+
+//MatchesRedirectURI checks if a redirect uri is registered for this client
+// Redirect uris need to match a registered callback url exactly unless wildcard or loopback callback urls are enabled
+func (c *Oauth2Client) MatchesRedirectURI(redirectURI string) bool {
+	for _, callbackURL := range c.RegisteredCallbackURLs() {
+		if matchRedirectURI(callbackURL, redirectURI, c.WildcardCallbackURLs, c.LoopbackCallbackURLs) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRedirectURI(callbackURL, redirectURI string, allowWildcard, allowLoopback bool) bool {
+	if callbackURL == redirectURI {
+		return true
+	}
+	if !allowWildcard && !allowLoopback {
+		return false
+	}
+	registered, err := url.Parse(callbackURL)
+	if err != nil {
+		return false
+	}
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	if registered.Scheme != redirect.Scheme || registered.RawQuery != redirect.RawQuery || redirect.User != nil || redirect.Fragment != "" {
+		return false
+	}
+
+	registeredHost, registeredPort := splitHostPort(registered.Host)
+	redirectHost, redirectPort := splitHostPort(redirect.Host)
+	if !strings.EqualFold(registeredHost, redirectHost) {
+		return false
+	}
+	// A native application listens on a random port, the port is left out of the registered callback url
+	loopbackPort := allowLoopback && registeredPort == "" && registered.Scheme == "http" && isLoopbackHost(registeredHost)
+	if registeredPort != redirectPort && !loopbackPort {
+		return false
+	}
+
+	if allowWildcard && strings.HasSuffix(registered.Path, "/*") {
+		// Do not allow to escape the wildcard path using '..'
+		cleanPath := path.Clean(redirect.Path)
+		if cleanPath != redirect.Path && cleanPath+"/" != redirect.Path {
+			return false
+		}
+		return strings.HasPrefix(redirect.Path, strings.TrimSuffix(registered.Path, "*"))
+	}
+	return registered.Path == redirect.Path
+}
+
+func splitHostPort(hostport string) (host, port string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport, ""
+	}
+	return
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
 }
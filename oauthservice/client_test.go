@@ -2,6 +2,7 @@ package oauthservice
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,3 +18,80 @@ func TestNewOauth2Client(t *testing.T) {
 	c2 := NewOauth2Client("clientid", "", "", true)
 	assert.NotEqual(t, c.Secret, c2.Secret)
 }
+
+func TestMatchesRedirectURI(t *testing.T) {
+	type testcase struct {
+		redirectURI string
+		valid       bool
+	}
+	c := &Oauth2Client{
+		CallbackURL:            "https://app.example.com/callback",
+		AdditionalCallbackURLs: []string{"https://app.example.com/other/*", "http://127.0.0.1/native"},
+	}
+	exactTestcases := []testcase{
+		testcase{redirectURI: "https://app.example.com/callback", valid: true},
+		testcase{redirectURI: "https://app.example.com/callback/", valid: false},
+		testcase{redirectURI: "https://app.example.com.evil.net/callback", valid: false},
+		testcase{redirectURI: "https://app.example.com/other/page", valid: false},
+		testcase{redirectURI: "https://app.example.com/other/*", valid: true},
+		testcase{redirectURI: "http://127.0.0.1:51234/native", valid: false},
+	}
+	for _, test := range exactTestcases {
+		assert.Equal(t, test.valid, c.MatchesRedirectURI(test.redirectURI), test.redirectURI)
+	}
+
+	c.WildcardCallbackURLs = true
+	c.LoopbackCallbackURLs = true
+	optInTestcases := []testcase{
+		testcase{redirectURI: "https://app.example.com/callback", valid: true},
+		testcase{redirectURI: "https://app.example.com/callback/sub", valid: false},
+		testcase{redirectURI: "https://app.example.com/other/page", valid: true},
+		testcase{redirectURI: "https://app.example.com/other/", valid: true},
+		testcase{redirectURI: "https://app.example.com/other", valid: false},
+		testcase{redirectURI: "https://app.example.com/other/../evil", valid: false},
+		testcase{redirectURI: "https://app.example.com/other/%2e%2e/evil", valid: false},
+		testcase{redirectURI: "https://app.example.com/other/page?next=1", valid: false},
+		testcase{redirectURI: "https://app.example.com:8443/other/page", valid: false},
+		testcase{redirectURI: "https://evil.net/other/page", valid: false},
+		testcase{redirectURI: "http://app.example.com/other/page", valid: false},
+		testcase{redirectURI: "http://127.0.0.1:51234/native", valid: true},
+		testcase{redirectURI: "http://127.0.0.1/native", valid: true},
+		testcase{redirectURI: "http://127.0.0.1:51234/other", valid: false},
+		testcase{redirectURI: "http://localhost:51234/native", valid: false},
+	}
+	for _, test := range optInTestcases {
+		assert.Equal(t, test.valid, c.MatchesRedirectURI(test.redirectURI), test.redirectURI)
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	now := time.Now()
+	c := NewOauth2Client("testorg", "test", "", false)
+	assert.False(t, c.IsRotatingSecret(now))
+
+	originalSecret := c.Secret
+	c.StartSecretRotation(time.Hour, now)
+	assert.NotEqual(t, originalSecret, c.Secret)
+	assert.Equal(t, originalSecret, c.PreviousSecret)
+	assert.True(t, c.IsRotatingSecret(now))
+	assert.True(t, c.IsRotatingSecret(now.Add(59*time.Minute)))
+	assert.False(t, c.IsRotatingSecret(now.Add(time.Hour)))
+
+	c.FinishSecretRotation()
+	assert.Empty(t, c.PreviousSecret)
+	assert.False(t, c.IsRotatingSecret(now))
+}
+
+func TestAllowsGrantType(t *testing.T) {
+	c := NewOauth2Client("testorg", "test", "", false)
+	assert.True(t, c.AllowsGrantType(RefreshTokenGrantType))
+	assert.False(t, c.AllowsGrantType(ClientCredentialsGrantCodeType))
+	assert.False(t, c.AllowsGrantType(PasswordGrantType))
+	assert.False(t, c.AllowsGrantType(JWTBearerGrantType))
+
+	c.PasswordGrantType = true
+	assert.True(t, c.AllowsGrantType(PasswordGrantType))
+	assert.False(t, c.AllowsGrantType(JWTBearerGrantType))
+	c.JWTBearerGrantType = true
+	assert.True(t, c.AllowsGrantType(JWTBearerGrantType))
+}
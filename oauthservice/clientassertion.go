@@ -0,0 +1,180 @@
+package oauthservice
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/db/organization"
+	"gopkg.in/mgo.v2"
+)
+
+//Client authentication using a jwt signed with a private key, the private_key_jwt client authentication method
+// See https://tools.ietf.org/html/rfc7523#section-2.2 and http://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+
+//ClientAssertionTypeJWTBearer is the only supported client_assertion_type
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+//maxClientAssertionLifetime limits how long the jti of a client assertion needs to be remembered to detect replays
+const maxClientAssertionLifetime = time.Hour
+
+const errorInvalidClient = "invalid_client"
+
+var errInvalidClientAssertion = errors.New("Invalid client assertion")
+
+//usedClientAssertion records the jti of a client assertion until it expires so it can not be used again
+type usedClientAssertion struct {
+	ClientID  string
+	JTI       string
+	ExpiresAt time.Time
+}
+
+//parseClientAssertion verifies the signature of a client assertion against the public keys of the organization
+func parseClientAssertion(assertion string, publicKeys []string) (token *jwt.Token, err error) {
+	for _, pemKey := range publicKeys {
+		publicKey, parseErr := oauth2.ParsePublicKey(pemKey)
+		if parseErr != nil {
+			log.Debug("Invalid public key registered on the organization: ", parseErr)
+			continue
+		}
+		token, err = jwt.Parse(assertion, func(token *jwt.Token) (interface{}, error) {
+			// Only accept asymmetric signatures with a matching key type, a public key must never be used as hmac secret
+			switch token.Method.(type) {
+			case *jwt.SigningMethodECDSA:
+				if _, ok := publicKey.(*ecdsa.PublicKey); ok {
+					return publicKey, nil
+				}
+			case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+				if _, ok := publicKey.(*rsa.PublicKey); ok {
+					return publicKey, nil
+				}
+			}
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		})
+		if err == nil && token.Valid {
+			return
+		}
+	}
+	token = nil
+	err = errInvalidClientAssertion
+	return
+}
+
+//validateClientAssertionClaims checks the claims of a client assertion with a verified signature
+// The issuer and subject need to be the client
+func validateClientAssertionClaims(claims map[string]interface{}, clientID string, audiences []string, now time.Time) (jti string, expires time.Time, err error) {
+	if sub, _ := claims["sub"].(string); sub != clientID {
+		err = errInvalidClientAssertion
+		return
+	}
+	return validateAssertionClaims(claims, clientID, audiences, now)
+}
+
+//validateAssertionClaims checks the claims every assertion of an organization needs to have
+// The issuer needs to be the organization, the audience needs to be this authorization server and
+// the jti and a short expiration time are required to prevent replays
+func validateAssertionClaims(claims map[string]interface{}, clientID string, audiences []string, now time.Time) (jti string, expires time.Time, err error) {
+	err = errInvalidClientAssertion
+	if iss, _ := claims["iss"].(string); iss != clientID {
+		return
+	}
+	audienceFound := false
+	for _, audience := range getAudiencesFromClaim(claims["aud"]) {
+		for _, allowedAudience := range audiences {
+			audienceFound = audienceFound || audience == allowedAudience
+		}
+	}
+	if !audienceFound {
+		return
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return
+	}
+	expires = time.Unix(int64(exp), 0)
+	if !expires.After(now) || expires.After(now.Add(maxClientAssertionLifetime)) {
+		return
+	}
+	if jti, _ = claims["jti"].(string); jti == "" {
+		return
+	}
+	err = nil
+	return
+}
+
+//tokenEndpointAudiences are the accepted audiences of an assertion, the token endpoint or the issuer of this authorization server
+func tokenEndpointAudiences(r *http.Request) []string {
+	return []string{fmt.Sprintf("https://%s/v1/oauth/access_token", r.Host), issuer}
+}
+
+//authenticateClientAssertion authenticates a client using the client_assertion parameter, the client id is returned
+// The jti of a valid assertion is recorded, presenting the same assertion again fails
+func (service *Service) authenticateClientAssertion(r *http.Request, mgr *Manager) (clientID string, err error) {
+	if r.FormValue("client_assertion_type") != ClientAssertionTypeJWTBearer {
+		err = errInvalidClientAssertion
+		return
+	}
+	assertion := r.FormValue("client_assertion")
+	// The issuer is needed to know which public keys to verify the assertion with
+	unverified, _ := jwt.Parse(assertion, nil)
+	if unverified == nil {
+		err = errInvalidClientAssertion
+		return
+	}
+	clientID, _ = unverified.Claims["iss"].(string)
+	if formClientID := r.FormValue("client_id"); clientID == "" || (formClientID != "" && formClientID != clientID) {
+		err = errInvalidClientAssertion
+		return
+	}
+
+	publicKeys, err := organization.NewManager(r).GetPublicKeys(clientID)
+	if err == mgo.ErrNotFound {
+		err = errInvalidClientAssertion
+	}
+	if err != nil {
+		return
+	}
+	token, err := parseClientAssertion(assertion, publicKeys)
+	if err != nil {
+		return
+	}
+	jti, expires, err := validateClientAssertionClaims(token.Claims, clientID, tokenEndpointAudiences(r), time.Now())
+	if err != nil {
+		return
+	}
+
+	replayed, err := mgr.saveClientAssertion(&usedClientAssertion{ClientID: clientID, JTI: jti, ExpiresAt: expires})
+	if err == nil && replayed {
+		log.Info("Replayed client assertion for ", clientID)
+		err = errInvalidClientAssertion
+	}
+	return
+}
+
+//clientAssertionCredentials authenticates a client assertion on the token endpoint and returns the credentials of the
+// api key the client is authenticated as, this is an api key of the organization with private_key_jwt enabled that
+// supports the requested grant
+func (service *Service) clientAssertionCredentials(r *http.Request, grantType string) (clientID, secret string, err error) {
+	mgr := NewManager(r)
+	clientID, err = service.authenticateClientAssertion(r, mgr)
+	if err != nil {
+		return
+	}
+	client, err := mgr.getPrivateKeyJWTClient(clientID, r.FormValue("redirect_uri"), grantType)
+	if err != nil {
+		return
+	}
+	if client == nil {
+		log.Info("No api key of ", clientID, " allows client assertions for this request")
+		err = errInvalidClientAssertion
+		return
+	}
+	secret = client.Secret
+	return
+}
@@ -0,0 +1,103 @@
+package oauthservice
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateAssertionKey(t *testing.T) (privateKey *ecdsa.PrivateKey, pemPublicKey string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.NoError(t, err)
+	pemPublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}))
+	return
+}
+
+func TestParseClientAssertion(t *testing.T) {
+	privateKey, publicKey := generateAssertionKey(t)
+	_, otherPublicKey := generateAssertionKey(t)
+
+	token := jwt.New(jwt.SigningMethodES256)
+	token.Claims["iss"] = "testorg"
+	token.Claims["exp"] = time.Now().Add(time.Minute).Unix()
+	assertion, err := token.SignedString(privateKey)
+	assert.NoError(t, err)
+
+	parsedToken, err := parseClientAssertion(assertion, []string{otherPublicKey, "invalid", publicKey})
+	assert.NoError(t, err)
+	assert.Equal(t, "testorg", parsedToken.Claims["iss"])
+
+	_, err = parseClientAssertion(assertion, []string{otherPublicKey})
+	assert.Equal(t, errInvalidClientAssertion, err)
+
+	_, err = parseClientAssertion(assertion, nil)
+	assert.Equal(t, errInvalidClientAssertion, err)
+
+	// The public key can not be abused as hmac secret
+	token = jwt.New(jwt.SigningMethodHS256)
+	token.Claims["iss"] = "testorg"
+	assertion, err = token.SignedString([]byte(publicKey))
+	assert.NoError(t, err)
+	_, err = parseClientAssertion(assertion, []string{publicKey})
+	assert.Equal(t, errInvalidClientAssertion, err)
+}
+
+func TestValidateClientAssertionClaims(t *testing.T) {
+	now := time.Now()
+	audiences := []string{"https://itsyou.online/v1/oauth/access_token", "itsyouonline"}
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "testorg",
+			"sub": "testorg",
+			"aud": "https://itsyou.online/v1/oauth/access_token",
+			"exp": float64(now.Add(5 * time.Minute).Unix()),
+			"jti": "abc",
+		}
+	}
+
+	jti, expires, err := validateClientAssertionClaims(validClaims(), "testorg", audiences, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", jti)
+	assert.Equal(t, now.Add(5*time.Minute).Unix(), expires.Unix())
+
+	claims := validClaims()
+	claims["aud"] = []interface{}{"https://other.example.com", "itsyouonline"}
+	_, _, err = validateClientAssertionClaims(claims, "testorg", audiences, now)
+	assert.NoError(t, err)
+
+	type testcase struct {
+		claim string
+		value interface{}
+	}
+	invalidCases := []testcase{
+		{claim: "iss", value: "otherorg"},
+		{claim: "sub", value: "otherorg"},
+		{claim: "sub", value: nil},
+		{claim: "aud", value: "https://other.example.com"},
+		{claim: "aud", value: nil},
+		{claim: "exp", value: nil},
+		{claim: "exp", value: float64(now.Add(-time.Minute).Unix())},
+		{claim: "exp", value: float64(now.Add(2 * time.Hour).Unix())},
+		{claim: "jti", value: ""},
+		{claim: "jti", value: nil},
+	}
+	for _, test := range invalidCases {
+		claims := validClaims()
+		if test.value == nil {
+			delete(claims, test.claim)
+		} else {
+			claims[test.claim] = test.value
+		}
+		_, _, err = validateClientAssertionClaims(claims, "testorg", audiences, now)
+		assert.Equal(t, errInvalidClientAssertion, err, test.claim)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 
 	"fmt"
+	log "github.com/Sirupsen/logrus"
 	"github.com/itsyouonline/identityserver/db"
 	"strings"
 )
@@ -17,6 +18,9 @@ const (
 	tokensCollectionName       = "oauth_accesstokens"
 	clientsCollectionName      = "oauth_clients"
 	refreshTokenCollectionName = "oauth_refreshtokens"
+	deviceCollectionName       = "oauth_deviceauthorizations"
+	assertionCollectionName    = "oauth_clientassertions"
+	parCollectionName          = "oauth_pushedauthorizationrequests"
 )
 
 //InitModels initialize models in mongo, if required.
@@ -46,9 +50,16 @@ func InitModels() {
 
 	//TODO: unique username/clientid combination
 
+	//Access tokens used to expire a fixed time after their creation, the lifetime is configurable per organization now
+	// The old index is only dropped once every token has an expiresat, otherwise tokens stored before would never be removed
+	if err := backfillAccessTokenExpiration(); err != nil {
+		log.Error("Failed to set the expiration of existing access tokens: ", err)
+	} else {
+		db.DropIndex(tokensCollectionName, "createdat")
+	}
 	automaticExpiration = mgo.Index{
-		Key:         []string{"createdat"},
-		ExpireAfter: AccessTokenExpiration,
+		Key:         []string{"expiresat"},
+		ExpireAfter: time.Second,
 		Background:  true,
 	}
 	db.EnsureIndex(tokensCollectionName, automaticExpiration)
@@ -72,6 +83,58 @@ func InitModels() {
 	}
 	db.EnsureIndex(refreshTokenCollectionName, automaticExpiration)
 
+	index = mgo.Index{
+		Key:    []string{"family"},
+		Sparse: true,
+	}
+	db.EnsureIndex(refreshTokenCollectionName, index)
+
+	index = mgo.Index{
+		Key:    []string{"devicecode"},
+		Unique: true,
+	}
+	db.EnsureIndex(deviceCollectionName, index)
+
+	index = mgo.Index{
+		Key:    []string{"usercode"},
+		Unique: true,
+	}
+	db.EnsureIndex(deviceCollectionName, index)
+
+	// Keep expired device authorizations a while so polling devices get an expired_token error
+	automaticExpiration = mgo.Index{
+		Key:         []string{"createdat"},
+		ExpireAfter: deviceCodeExpiration * 2,
+		Background:  true,
+	}
+	db.EnsureIndex(deviceCollectionName, automaticExpiration)
+
+	index = mgo.Index{
+		Key:    []string{"clientid", "jti"},
+		Unique: true,
+	}
+	db.EnsureIndex(assertionCollectionName, index)
+
+	automaticExpiration = mgo.Index{
+		Key:         []string{"expiresat"},
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+	db.EnsureIndex(assertionCollectionName, automaticExpiration)
+
+	index = mgo.Index{
+		Key:    []string{"requesturi"},
+		Unique: true,
+	}
+	db.EnsureIndex(parCollectionName, index)
+
+	automaticExpiration = mgo.Index{
+		Key:         []string{"createdat"},
+		ExpireAfter: pushedAuthorizationRequestExpiration,
+		Background:  true,
+	}
+	db.EnsureIndex(parCollectionName, automaticExpiration)
+
 }
 
 //Manager is used to store
@@ -93,6 +156,24 @@ type ClientManager interface {
 	AllByClientID(clientID string) ([]*Oauth2Client, error)
 }
 
+//backfillAccessTokenExpiration sets the expiresat of access tokens created before the lifetime was configurable
+func backfillAccessTokenExpiration() (err error) {
+	session := db.GetSession()
+	defer session.Close()
+	c := db.GetCollection(session, tokensCollectionName)
+
+	var at AccessToken
+	iter := c.Find(bson.M{"expiresat": bson.M{"$exists": false}}).Select(bson.M{"_id": 1, "createdat": 1}).Iter()
+	for iter.Next(&at) {
+		err = c.UpdateId(at.ID, bson.M{"$set": bson.M{"expiresat": at.CreatedAt.Add(AccessTokenExpiration)}})
+		if err != nil && err != mgo.ErrNotFound {
+			iter.Close()
+			return
+		}
+	}
+	return iter.Close()
+}
+
 //getAuthorizationRequestCollection returns the mongo collection for the authorizationRequests
 func (m *Manager) getAuthorizationRequestCollection() *mgo.Collection {
 	return db.GetCollection(m.session, requestsCollectionName)
@@ -139,6 +220,12 @@ func (m *Manager) saveAccessToken(at *AccessToken) (err error) {
 	return
 }
 
+//removeAccessToken removes an access token
+func (m *Manager) removeAccessToken(token string) (err error) {
+	_, err = m.getAccessTokenCollection().RemoveAll(bson.M{"accesstoken": token})
+	return
+}
+
 //GetAccessToken gets an access token by it's actual token string
 // If the token is not found or is expired, nil is returned
 func (m *Manager) GetAccessToken(token string) (at *AccessToken, err error) {
@@ -227,6 +314,161 @@ func (m *Manager) saveRefreshToken(t *refreshToken) (err error) {
 	return
 }
 
+//replaceRefreshToken marks a refresh token as used by storing its successor
+// If the refresh token was already replaced, false is returned
+func (m *Manager) replaceRefreshToken(t *refreshToken) (replaced bool, err error) {
+	err = m.getRefreshTokenCollection().Update(
+		bson.M{"refreshtoken": t.RefreshToken, "replacedby": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"replacedby": t.ReplacedBy, "lastused": t.LastUsed}})
+	if err == mgo.ErrNotFound {
+		err = nil
+		return
+	}
+	replaced = err == nil
+	return
+}
+
+//removeRefreshTokenTree removes a refresh token and all refresh tokens of jwt's that were created using it as parent
+func (m *Manager) removeRefreshTokenTree(token string) (err error) {
+	tokens := []string{token}
+	for len(tokens) > 0 {
+		children := []struct{ RefreshToken string }{}
+		err = m.getRefreshTokenCollection().Find(bson.M{"parent": bson.M{"$in": tokens}}).Select(bson.M{"refreshtoken": 1}).All(&children)
+		if err != nil {
+			return
+		}
+		if _, err = m.getRefreshTokenCollection().RemoveAll(bson.M{"refreshtoken": bson.M{"$in": tokens}}); err != nil {
+			return
+		}
+		tokens = make([]string, 0, len(children))
+		for _, child := range children {
+			tokens = append(tokens, child.RefreshToken)
+		}
+	}
+	return
+}
+
+//removeRefreshTokenFamily removes all refresh tokens of a family and the access tokens that were issued with them
+func (m *Manager) removeRefreshTokenFamily(family string) (err error) {
+	if family == "" {
+		return
+	}
+	if _, err = m.getRefreshTokenCollection().RemoveAll(bson.M{"family": family}); err != nil {
+		return
+	}
+	_, err = m.getAccessTokenCollection().RemoveAll(bson.M{"refreshtokenfamily": family})
+	return
+}
+
+//getDeviceCollection returns the mongo collection for the device authorizations
+func (m *Manager) getDeviceCollection() *mgo.Collection {
+	return db.GetCollection(m.session, deviceCollectionName)
+}
+
+//saveDeviceAuthorization stores a new device authorization
+func (m *Manager) saveDeviceAuthorization(da *deviceAuthorization) (err error) {
+	err = m.getDeviceCollection().Insert(da)
+	return
+}
+
+//getDeviceAuthorization gets a device authorization by its device code, nil is returned if it does not exist
+func (m *Manager) getDeviceAuthorization(deviceCode string) (da *deviceAuthorization, err error) {
+	return m.findDeviceAuthorization(bson.M{"devicecode": deviceCode})
+}
+
+//getDeviceAuthorizationByUserCode gets a device authorization by its user code, nil is returned if it does not exist
+func (m *Manager) getDeviceAuthorizationByUserCode(userCode string) (da *deviceAuthorization, err error) {
+	return m.findDeviceAuthorization(bson.M{"usercode": userCode})
+}
+
+func (m *Manager) findDeviceAuthorization(query bson.M) (da *deviceAuthorization, err error) {
+	da = &deviceAuthorization{}
+	err = m.getDeviceCollection().Find(query).One(da)
+	if err == mgo.ErrNotFound {
+		err = nil
+		da = nil
+	}
+	if err != nil {
+		da = nil
+	}
+	return
+}
+
+//updateDevicePolling stores the last time a device polled and the polling interval
+func (m *Manager) updateDevicePolling(da *deviceAuthorization) (err error) {
+	err = m.getDeviceCollection().Update(bson.M{"devicecode": da.DeviceCode}, bson.M{"$set": bson.M{"lastpolled": da.LastPolled, "interval": da.Interval}})
+	return
+}
+
+//setDeviceConfirmation stores the user, authorized scopes and confirmation token of a pending device authorization
+// The device is approved once the user confirms it
+func (m *Manager) setDeviceConfirmation(da *deviceAuthorization) (err error) {
+	err = m.getDeviceCollection().Update(
+		bson.M{"devicecode": da.DeviceCode, "status": deviceAuthorizationPending},
+		bson.M{"$set": bson.M{"username": da.Username, "scope": da.Scope, "newscope": da.NewScope, "authtime": da.AuthTime, "acr": da.ACR, "confirmationtoken": da.ConfirmationToken}})
+	return
+}
+
+//confirmDeviceAuthorization marks a pending device authorization as approved or denied by the user it was confirmed with
+func (m *Manager) confirmDeviceAuthorization(da *deviceAuthorization, status string) (err error) {
+	err = m.getDeviceCollection().Update(
+		bson.M{"devicecode": da.DeviceCode, "status": deviceAuthorizationPending, "confirmationtoken": da.ConfirmationToken},
+		bson.M{"$set": bson.M{"status": status}, "$unset": bson.M{"confirmationtoken": ""}})
+	return
+}
+
+//removeDeviceAuthorization removes a device authorization, removed is false if it was already removed
+func (m *Manager) removeDeviceAuthorization(deviceCode string) (removed bool, err error) {
+	err = m.getDeviceCollection().Remove(bson.M{"devicecode": deviceCode})
+	if err == mgo.ErrNotFound {
+		err = nil
+		return
+	}
+	removed = err == nil
+	return
+}
+
+//saveClientAssertion records the jti of a client assertion, replayed is true if it was already used
+func (m *Manager) saveClientAssertion(assertion *usedClientAssertion) (replayed bool, err error) {
+	err = db.GetCollection(m.session, assertionCollectionName).Insert(assertion)
+	if mgo.IsDup(err) {
+		replayed = true
+		err = nil
+	}
+	return
+}
+
+//getPushedAuthorizationRequestCollection returns the mongo collection for the pushed authorization requests
+func (m *Manager) getPushedAuthorizationRequestCollection() *mgo.Collection {
+	return db.GetCollection(m.session, parCollectionName)
+}
+
+//savePushedAuthorizationRequest stores a new pushed authorization request
+func (m *Manager) savePushedAuthorizationRequest(par *pushedAuthorizationRequest) (err error) {
+	err = m.getPushedAuthorizationRequestCollection().Insert(par)
+	return
+}
+
+//getPushedAuthorizationRequest gets a pushed authorization request by its request_uri, nil is returned if it does not exist
+func (m *Manager) getPushedAuthorizationRequest(requestURI string) (par *pushedAuthorizationRequest, err error) {
+	par = &pushedAuthorizationRequest{}
+	err = m.getPushedAuthorizationRequestCollection().Find(bson.M{"requesturi": requestURI}).One(par)
+	if err == mgo.ErrNotFound {
+		err = nil
+		par = nil
+	}
+	if err != nil {
+		par = nil
+	}
+	return
+}
+
+//removePushedAuthorizationRequest removes a pushed authorization request so its request_uri can not be used anymore
+func (m *Manager) removePushedAuthorizationRequest(requestURI string) (err error) {
+	_, err = m.getPushedAuthorizationRequestCollection().RemoveAll(bson.M{"requesturi": requestURI})
+	return
+}
+
 //getClientsCollection returns the mongo collection for the clients
 func (m *Manager) getClientsCollection() *mgo.Collection {
 	return db.GetCollection(m.session, clientsCollectionName)
@@ -254,10 +496,23 @@ func (m *Manager) CreateClient(client *Oauth2Client) (err error) {
 	return
 }
 
-//UpdateClient updates the label, callbackurl and clientCredentialsGrantType properties of a client
-func (m *Manager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL string, clientcredentialsGrantType bool) (err error) {
-
-	_, err = m.getClientsCollection().UpdateAll(bson.M{"clientid": clientID, "label": oldLabel}, bson.M{"$set": bson.M{"label": newLabel, "callbackurl": callbackURL, "clientcredentialsgranttype": clientcredentialsGrantType}})
+//UpdateClient updates the label, callback urls, logo and grant type properties of a client, the secret is not changed
+func (m *Manager) UpdateClient(clientID, oldLabel string, client *Oauth2Client) (err error) {
+
+	_, err = m.getClientsCollection().UpdateAll(bson.M{"clientid": clientID, "label": oldLabel}, bson.M{"$set": bson.M{
+		"label":                              client.Label,
+		"callbackurl":                        client.CallbackURL,
+		"additionalcallbackurls":             client.AdditionalCallbackURLs,
+		"clientcredentialsgranttype":         client.ClientCredentialsGrantType,
+		"publicclient":                       client.PublicClient,
+		"wildcardcallbackurls":               client.WildcardCallbackURLs,
+		"loopbackcallbackurls":               client.LoopbackCallbackURLs,
+		"privatekeyjwt":                      client.PrivateKeyJWT,
+		"passwordgranttype":                  client.PasswordGrantType,
+		"jwtbearergranttype":                 client.JWTBearerGrantType,
+		"requirepushedauthorizationrequests": client.RequirePushedAuthorizationRequests,
+		"logouri":                            client.LogoURI,
+	}})
 
 	if err != nil && mgo.IsDup(err) {
 		err = db.ErrDuplicate
@@ -265,6 +520,23 @@ func (m *Manager) UpdateClient(clientID, oldLabel, newLabel string, callbackURL
 	return
 }
 
+//UpdateClientSecrets saves the secret and the previous secret of a client
+func (m *Manager) UpdateClientSecrets(client *Oauth2Client) (err error) {
+	update := bson.M{"$set": bson.M{"secret": client.Secret}}
+	if client.PreviousSecret == "" {
+		update["$unset"] = bson.M{"previoussecret": "", "previoussecretexpires": "", "previoussecretlastused": ""}
+	} else {
+		update["$set"] = bson.M{
+			"secret":                client.Secret,
+			"previoussecret":        client.PreviousSecret,
+			"previoussecretexpires": client.PreviousSecretExpires,
+		}
+		update["$unset"] = bson.M{"previoussecretlastused": ""}
+	}
+	err = m.getClientsCollection().Update(bson.M{"clientid": client.ClientID, "label": client.Label}, update)
+	return
+}
+
 //DeleteClient removes a client secret by it's clientID and label
 func (m *Manager) DeleteClient(clientID, label string) (err error) {
 	_, err = m.getClientsCollection().RemoveAll(bson.M{"clientid": clientID, "label": label})
@@ -298,14 +570,87 @@ func (m *Manager) AllByClientID(clientID string) (clients []*Oauth2Client, err e
 }
 
 //GetClientByCredentials retrieves a client given a clientid and a secret
+// During a secret rotation, the previous secret is also accepted and the time it was last used is recorded
 func (m *Manager) getClientByCredentials(clientID, secret string) (client *Oauth2Client, err error) {
+	if secret == "" {
+		return
+	}
+	now := time.Now()
 	client = &Oauth2Client{}
-	err = m.getClientsCollection().Find(bson.M{"clientid": clientID, "secret": secret}).One(client)
+	err = m.getClientsCollection().Find(bson.M{"clientid": clientID, "$or": []bson.M{
+		{"secret": secret},
+		{"previoussecret": secret, "previoussecretexpires": bson.M{"$gt": now}},
+	}}).One(client)
 	if err == mgo.ErrNotFound {
 		err = nil
 		client = nil
 		return
 	}
+	if err != nil || client.Secret == secret {
+		return
+	}
+	client.PreviousSecretLastUsed = now
+	err = m.getClientsCollection().Update(
+		bson.M{"clientid": clientID, "label": client.Label},
+		bson.M{"$set": bson.M{"previoussecretlastused": now}})
+	return
+}
+
+//getPublicClient retrieves a client flagged as public with a callback url that matches the redirectURI
+func (m *Manager) getPublicClient(clientID, redirectURI string) (client *Oauth2Client, err error) {
+	clients := make([]*Oauth2Client, 0)
+	err = m.getClientsCollection().Find(bson.M{"clientid": clientID, "publicclient": true}).All(&clients)
+	if err != nil {
+		return
+	}
+	for _, c := range clients {
+		if c.MatchesRedirectURI(redirectURI) {
+			client = c
+			return
+		}
+	}
+	return
+}
+
+//getPrivateKeyJWTClient retrieves a client that allows authentication with a client assertion and the requested grant type
+// If a redirect uri is given, it needs to match the client's callback urls, clientCredentials requires the client credentials grant type to be enabled
+func (m *Manager) getPrivateKeyJWTClient(clientID, redirectURI, grantType string) (client *Oauth2Client, err error) {
+	clients := make([]*Oauth2Client, 0)
+	err = m.getClientsCollection().Find(bson.M{"clientid": clientID, "privatekeyjwt": true}).All(&clients)
+	if err != nil {
+		return
+	}
+	for _, c := range clients {
+		if (redirectURI == "" || c.MatchesRedirectURI(redirectURI)) && c.AllowsGrantType(grantType) {
+			client = c
+			return
+		}
+	}
+	return
+}
+
+//authenticateClient checks the credentials of a client
+// Clients flagged as public can not keep a secret, they are authenticated without one
+func (m *Manager) authenticateClient(clientID, secret string) (authenticated bool, err error) {
+	if secret == "" {
+		return m.isPublicClient(clientID)
+	}
+	client, err := m.getClientByCredentials(clientID, secret)
+	authenticated = client != nil
+	return
+}
+
+//isPublicClient checks if a client has an api key flagged as public
+func (m *Manager) isPublicClient(clientID string) (public bool, err error) {
+	count, err := m.getClientsCollection().Find(bson.M{"clientid": clientID, "publicclient": true}).Count()
+	public = count > 0
+	return
+}
+
+//requiresPushedAuthorizationRequests checks if a client has an api key that only accepts authorize requests with a request_uri
+func (m *Manager) requiresPushedAuthorizationRequests(clientID string) (required bool, err error) {
+	count, err := m.getClientsCollection().Find(bson.M{"clientid": clientID, "requirepushedauthorizationrequests": true}).Count()
+	required = count > 0
 	return
 }
 
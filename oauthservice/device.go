@@ -0,0 +1,439 @@
+package oauthservice
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+)
+
+//Device authorization grant support
+// See https://tools.ietf.org/html/rfc8628
+
+const (
+	//deviceCodeExpiration is the time a user has to enter the user code and authorize the device
+	deviceCodeExpiration = time.Minute * 10
+	//devicePollingInterval is the minimum number of seconds a device must wait between polling requests
+	devicePollingInterval = 5
+	//userCodeCharacters are the characters a user code consists of, vowels are left out to avoid forming words
+	userCodeCharacters = "BCDFGHJKLMNPQRSTVWXZ"
+	//userCodeLength is the number of characters in a user code
+	userCodeLength = 8
+)
+
+const (
+	deviceAuthorizationPending  = "pending"
+	deviceAuthorizationApproved = "approved"
+	deviceAuthorizationDenied   = "denied"
+)
+
+//Error codes returned by the access_token endpoint while a device is polling
+const (
+	errorAuthorizationPending = "authorization_pending"
+	errorSlowDown             = "slow_down"
+	errorAccessDenied         = "access_denied"
+	errorExpiredToken         = "expired_token"
+	errorInvalidGrant         = "invalid_grant"
+)
+
+//deviceAuthorization is an outstanding authorization request of a device
+type deviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	CreatedAt  time.Time
+	Interval   int64
+	LastPolled time.Time
+	Status     string
+	//Username, NewScope, AuthTime and ACR are set when the user is asked to confirm the device
+	Username string
+	NewScope string
+	AuthTime time.Time
+	ACR      string
+	//ConfirmationToken has to be posted back by the user to approve or deny the device
+	ConfirmationToken string
+}
+
+func newDeviceAuthorization(clientID, scope string) *deviceAuthorization {
+	var da deviceAuthorization
+	randombytes := make([]byte, 30) //Multiple of 3 to make sure no padding is added
+	rand.Read(randombytes)
+	da.DeviceCode = base64.URLEncoding.EncodeToString(randombytes)
+	da.UserCode = newUserCode()
+	da.ClientID = clientID
+	da.Scope = scope
+	da.CreatedAt = time.Now()
+	da.Interval = devicePollingInterval
+	da.Status = deviceAuthorizationPending
+	return &da
+}
+
+//newUserCode creates a random user code
+func newUserCode() string {
+	randombytes := make([]byte, userCodeLength)
+	rand.Read(randombytes)
+	code := make([]byte, userCodeLength)
+	for i, b := range randombytes {
+		code[i] = userCodeCharacters[int(b)%len(userCodeCharacters)]
+	}
+	return string(code)
+}
+
+//formatUserCode formats a user code as XXXX-XXXX so it is easier to read and type over
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+//normalizeUserCode converts a user code as typed by a user to the stored format, dashes, spaces and casing are ignored
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(userCodeCharacters, r) {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(userCode))
+}
+
+//IsExpiredAt checks if the device authorization is expired at a specific time
+func (da *deviceAuthorization) IsExpiredAt(testtime time.Time) bool {
+	return testtime.After(da.CreatedAt.Add(deviceCodeExpiration))
+}
+
+//isPollingTooFast checks if the device respects the polling interval
+func (da *deviceAuthorization) isPollingTooFast(testtime time.Time) bool {
+	return testtime.Before(da.LastPolled.Add(time.Duration(da.Interval) * time.Second))
+}
+
+//authorizationRequest converts an approved device authorization to the authorizationRequest it stands for
+func (da *deviceAuthorization) authorizationRequest() *authorizationRequest {
+	return &authorizationRequest{
+		Username:  da.Username,
+		ClientID:  da.ClientID,
+		Scope:     da.Scope,
+		NewScope:  da.NewScope,
+		CreatedAt: da.CreatedAt,
+		AuthTime:  da.AuthTime,
+		ACR:       da.ACR,
+	}
+}
+
+//writeOAuthError writes an oauth2 error response
+// See https://tools.ietf.org/html/rfc6749#section-5.2
+func writeOAuthError(w http.ResponseWriter, errorCode string) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: errorCode})
+}
+
+//DeviceCodeHandler is the handler of the /v1/oauth/device/code endpoint, it starts a device authorization
+func (service *Service) DeviceCodeHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	clientID, clientSecret := getClientCredentials(r)
+	if clientID == "" {
+		log.Debug("Required parameter missing in the request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if clientID == "itsyouonline" {
+		log.Warn("HACK attempt, someone tried to get a device code as the 'itsyouonline' client")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mgr := NewManager(r)
+	authenticated, err := mgr.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !authenticated {
+		log.Info("Client authentication failed")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	scope := strings.Join(oauth2.SplitScopeString(r.FormValue("scope")), ",")
+	da := newDeviceAuthorization(clientID, scope)
+	if err = mgr.saveDeviceAuthorization(da); err != nil {
+		log.Error("Error saving the device authorization: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	verificationURI := fmt.Sprintf("https://%s/device", r.Host)
+	response := struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int64  `json:"expires_in"`
+		Interval                int64  `json:"interval"`
+	}{
+		DeviceCode:              da.DeviceCode,
+		UserCode:                formatUserCode(da.UserCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {formatUserCode(da.UserCode)}}.Encode(),
+		ExpiresIn:               int64(deviceCodeExpiration.Seconds()),
+		Interval:                da.Interval,
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
+
+//DeviceAuthorizeHandler is the handler of GET /v1/oauth/device/authorize
+// The device page of the website sends the user here after the user entered the user code.
+// Like the authorize endpoint, it makes sure the user is logged in and authorized the requested scopes.
+// The device is not approved here, the user is sent back to the device page to confirm the client and scopes,
+// a link with the user code of somebody else's device can not connect that device to the user's account.
+func (service *Service) DeviceAuthorizeHandler(w http.ResponseWriter, request *http.Request) {
+	err := request.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	userCode := normalizeUserCode(request.Form.Get("user_code"))
+	mgr := NewManager(request)
+	da, err := mgr.getDeviceAuthorizationByUserCode(userCode)
+	if err != nil {
+		log.Error("Error getting the device authorization: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if da == nil || da.IsExpiredAt(time.Now()) || da.Status != deviceAuthorizationPending {
+		log.Debug("Unknown or expired user code")
+		redirectToDevicePage(w, request, "invalid")
+		return
+	}
+
+	//The login and authorize pages need the client_id and requested scopes
+	if request.Form.Get("client_id") != da.ClientID {
+		parameters := url.Values{
+			"user_code": {formatUserCode(da.UserCode)},
+			"client_id": {da.ClientID},
+			"scope":     {da.Scope},
+		}
+		http.Redirect(w, request, request.URL.Path+"?"+parameters.Encode(), http.StatusFound)
+		return
+	}
+
+	username, protectedSession, err := service.getAuthenticatedUser(w, request)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		return
+	}
+
+	authorizedScopeString, newScopeString, validAuthorization, err := service.getAuthorizedScopes(w, request, username, da.ClientID, protectedSession)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !validAuthorization {
+		return
+	}
+
+	da.Username = username
+	//The scope parameter passes through the browser, never hand out more than the device requested
+	da.Scope = strings.Join(filterScopes(oauth2.SplitScopeString(authorizedScopeString), oauth2.SplitScopeString(da.Scope)), ",")
+	da.NewScope = strings.Join(filterScopes(oauth2.SplitScopeString(newScopeString), oauth2.SplitScopeString(da.Scope)), ",")
+	da.AuthTime, da.ACR, err = service.getAuthenticationContext(w, request, protectedSession)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	da.ConfirmationToken = newConfirmationToken()
+	if err = mgr.setDeviceConfirmation(da); err != nil {
+		log.Error("Error storing the device confirmation: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	parameters := url.Values{
+		"status":             {"confirm"},
+		"user_code":          {formatUserCode(da.UserCode)},
+		"client_id":          {da.ClientID},
+		"scope":              {da.Scope},
+		"confirmation_token": {da.ConfirmationToken},
+	}
+	http.Redirect(w, request, "/device?"+parameters.Encode(), http.StatusFound)
+}
+
+//DeviceConfirmHandler is the handler of POST /v1/oauth/device/authorize
+// The device page posts the user code, the confirmation token and the decision of the user (action approve or deny).
+// The token is bound to the user who was asked to confirm, so the decision can not be forged by another site.
+func (service *Service) DeviceConfirmHandler(w http.ResponseWriter, request *http.Request) {
+	err := request.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mgr := NewManager(request)
+	da, err := mgr.getDeviceAuthorizationByUserCode(normalizeUserCode(request.PostForm.Get("user_code")))
+	if err != nil {
+		log.Error("Error getting the device authorization: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if da == nil || da.IsExpiredAt(time.Now()) || da.Status != deviceAuthorizationPending {
+		log.Debug("Unknown or expired user code")
+		redirectToDevicePage(w, request, "invalid")
+		return
+	}
+
+	username, err := service.GetWebuser(request, w)
+	if err == nil && username == "" {
+		username, err = service.GetOauthUser(request, w)
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !da.isConfirmationValid(username, request.PostForm.Get("confirmation_token")) {
+		log.Debug("Invalid device confirmation")
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	status := deviceAuthorizationApproved
+	if request.PostForm.Get("action") == "deny" {
+		status = deviceAuthorizationDenied
+	}
+	if err = mgr.confirmDeviceAuthorization(da, status); err != nil {
+		log.Error("Error confirming the device authorization: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	redirectToDevicePage(w, request, status)
+}
+
+//newConfirmationToken creates a random token the user needs to post back to confirm a device
+func newConfirmationToken() string {
+	randombytes := make([]byte, 30) //Multiple of 3 to make sure no padding is added
+	rand.Read(randombytes)
+	return base64.URLEncoding.EncodeToString(randombytes)
+}
+
+//isConfirmationValid checks if the user was asked to confirm this device with this token
+func (da *deviceAuthorization) isConfirmationValid(username, confirmationToken string) bool {
+	if username == "" || da.Username != username || da.ConfirmationToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(da.ConfirmationToken), []byte(confirmationToken)) == 1
+}
+
+//filterScopes returns the scopes that are also part of the allowed scopes
+func filterScopes(scopes []string, allowedScopes []string) (filtered []string) {
+	filtered = make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		for _, allowedScope := range allowedScopes {
+			if scope == allowedScope {
+				filtered = append(filtered, scope)
+				break
+			}
+		}
+	}
+	return
+}
+
+func redirectToDevicePage(w http.ResponseWriter, r *http.Request, status string) {
+	http.Redirect(w, r, "/device?"+url.Values{"status": {status}}.Encode(), http.StatusFound)
+}
+
+//deviceCodeGrantHandler handles the polling of a device for an access token
+// If the device can not get an access token (yet), errorCode is set
+func deviceCodeGrantHandler(clientID, secret, deviceCode string, validity time.Duration, mgr *Manager) (at *AccessToken, ar *authorizationRequest, errorCode string, httpStatusCode int) {
+	httpStatusCode = http.StatusOK
+
+	authenticated, err := mgr.authenticateClient(clientID, secret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if !authenticated {
+		log.Info("Client authentication failed")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	da, err := mgr.getDeviceAuthorization(deviceCode)
+	if err != nil {
+		log.Error("Error getting the device authorization: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if da == nil || da.ClientID != clientID {
+		errorCode = errorInvalidGrant
+		return
+	}
+	now := time.Now()
+	if da.IsExpiredAt(now) {
+		errorCode = errorExpiredToken
+		return
+	}
+	if da.isPollingTooFast(now) {
+		da.Interval += devicePollingInterval
+		errorCode = errorSlowDown
+	}
+	da.LastPolled = now
+	if err = mgr.updateDevicePolling(da); err != nil {
+		log.Error("Error saving the device polling: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if errorCode != "" {
+		return
+	}
+
+	switch da.Status {
+	case deviceAuthorizationPending:
+		errorCode = errorAuthorizationPending
+		return
+	case deviceAuthorizationDenied:
+		errorCode = errorAccessDenied
+		return
+	}
+
+	//A device code can only be exchanged for an access token once
+	removed, err := mgr.removeDeviceAuthorization(deviceCode)
+	if err != nil {
+		log.Error("Error removing the device authorization: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if !removed {
+		errorCode = errorInvalidGrant
+		return
+	}
+
+	ar = da.authorizationRequest()
+	// offline_access only results in a refresh token, it is not part of the access token's scope
+	scopes, _ := stripOfflineAccess(oauth2.SplitScopeString(ar.Scope))
+	at = newAccessToken(ar.Username, "", ar.ClientID, strings.Join(scopes, ","), validity)
+	return
+}
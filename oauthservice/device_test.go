@@ -0,0 +1,55 @@
+package oauthservice
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserCode(t *testing.T) {
+	userCode := newUserCode()
+	assert.Len(t, userCode, userCodeLength)
+	assert.Equal(t, "", strings.Trim(userCode, userCodeCharacters))
+	assert.NotEqual(t, userCode, newUserCode())
+
+	assert.Equal(t, "BCDF-GHJK", formatUserCode("BCDFGHJK"))
+	assert.Equal(t, "BCDFGHJK", normalizeUserCode("BCDF-GHJK"))
+	assert.Equal(t, "BCDFGHJK", normalizeUserCode(" bcdf ghjk "))
+	assert.Equal(t, "", normalizeUserCode("AEIOU-123"))
+}
+
+func TestDeviceAuthorizationTiming(t *testing.T) {
+	da := newDeviceAuthorization("client", "user:name")
+	now := time.Now()
+	assert.False(t, da.IsExpiredAt(now))
+	assert.True(t, da.IsExpiredAt(now.Add(deviceCodeExpiration+time.Second)))
+
+	assert.False(t, da.isPollingTooFast(now))
+	da.LastPolled = now
+	assert.True(t, da.isPollingTooFast(now.Add(time.Second)))
+	assert.False(t, da.isPollingTooFast(now.Add(devicePollingInterval*time.Second)))
+}
+
+func TestFilterScopes(t *testing.T) {
+	assert.Equal(t, []string{"user:name"}, filterScopes([]string{"user:name", "user:email"}, []string{"user:name", "offline_access"}))
+	assert.Empty(t, filterScopes([]string{"user:email"}, []string{"user:name"}))
+	assert.Empty(t, filterScopes(nil, []string{"user:name"}))
+}
+
+func TestDeviceConfirmation(t *testing.T) {
+	token := newConfirmationToken()
+	assert.Len(t, token, 40)
+	assert.NotEqual(t, token, newConfirmationToken())
+
+	da := newDeviceAuthorization("client", "user:name")
+	assert.False(t, da.isConfirmationValid("bob", ""))
+	da.Username = "bob"
+	da.ConfirmationToken = token
+	assert.True(t, da.isConfirmationValid("bob", token))
+	assert.False(t, da.isConfirmationValid("alice", token))
+	assert.False(t, da.isConfirmationValid("", token))
+	assert.False(t, da.isConfirmationValid("bob", ""))
+	assert.False(t, da.isConfirmationValid("bob", newConfirmationToken()))
+}
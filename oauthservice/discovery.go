@@ -0,0 +1,141 @@
+package oauthservice
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+)
+
+//jsonWebKey is the JWK representation (RFC 7517) of an ECDSA public key
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+//jsonWebKeySet is a JWK set as returned by the jwks endpoint
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+//openIDConfiguration is the OpenID Connect discovery document
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type openIDConfiguration struct {
+	Issuer                             string   `json:"issuer"`
+	AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+	TokenEndpoint                      string   `json:"token_endpoint"`
+	JWTEndpoint                        string   `json:"jwt_endpoint"`
+	JWTRefreshEndpoint                 string   `json:"jwt_refresh_endpoint"`
+	UserInfoEndpoint                   string   `json:"userinfo_endpoint"`
+	RevocationEndpoint                 string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint              string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint        string   `json:"device_authorization_endpoint"`
+	PushedAuthorizationRequestEndpoint string   `json:"pushed_authorization_request_endpoint"`
+	JWKSURI                            string   `json:"jwks_uri"`
+	ScopesSupported                    []string `json:"scopes_supported"`
+	ResponseTypesSupported             []string `json:"response_types_supported"`
+	GrantTypesSupported                []string `json:"grant_types_supported"`
+	SubjectTypesSupported              []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported  []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                    []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported      []string `json:"code_challenge_methods_supported"`
+}
+
+//supportedScopes are the scopes (or scope prefixes for the labelled ones) an oauth client can request
+// See docs/oauth2/availableScopes.md
+var supportedScopes = []string{
+	openIDScope,
+	"offline_access",
+	"user:name",
+	"user:memberof",
+	"user:address",
+	"user:email",
+	"user:phone",
+	"user:validated:email",
+	"user:validated:phone",
+	"user:github",
+	"user:facebook",
+	"user:bankaccount",
+	"user:digitalwalletaddress",
+	"user:publickey",
+	"user:avatar",
+	"user:keystore",
+	"user:see",
+	"user:ownerof:email",
+}
+
+//newJSONWebKey creates the JWK representation of an ECDSA public key
+func newJSONWebKey(publicKey *ecdsa.PublicKey, kid string) jsonWebKey {
+	params := publicKey.Curve.Params()
+	size := (params.BitSize + 7) / 8
+	return jsonWebKey{
+		KeyType:   "EC",
+		Curve:     params.Name,
+		X:         base64.RawURLEncoding.EncodeToString(oauth2.PaddedBytes(publicKey.X, size)),
+		Y:         base64.RawURLEncoding.EncodeToString(oauth2.PaddedBytes(publicKey.Y, size)),
+		Use:       "sig",
+		Algorithm: "ES384",
+		KeyID:     kid,
+	}
+}
+
+//OpenIDConfigurationHandler is the handler of the /.well-known/openid-configuration endpoint
+func (service *Service) OpenIDConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	baseURL := fmt.Sprintf("https://%s", r.Host)
+	configuration := openIDConfiguration{
+		Issuer:                             issuer,
+		AuthorizationEndpoint:              baseURL + "/v1/oauth/authorize",
+		TokenEndpoint:                      baseURL + "/v1/oauth/access_token",
+		JWTEndpoint:                        baseURL + "/v1/oauth/jwt",
+		JWTRefreshEndpoint:                 baseURL + "/v1/oauth/jwt/refresh",
+		UserInfoEndpoint:                   baseURL + "/v1/oauth/userinfo",
+		RevocationEndpoint:                 baseURL + "/v1/oauth/revoke",
+		IntrospectionEndpoint:              baseURL + "/v1/oauth/introspect",
+		DeviceAuthorizationEndpoint:        baseURL + "/v1/oauth/device/code",
+		PushedAuthorizationRequestEndpoint: baseURL + "/v1/oauth/par",
+		JWKSURI:                            baseURL + "/v1/oauth/jwks",
+		ScopesSupported:                    supportedScopes,
+		ResponseTypesSupported:             []string{AuthorizationGrantCodeType},
+		GrantTypesSupported:                []string{"authorization_code", ClientCredentialsGrantCodeType, RefreshTokenGrantType, DeviceCodeGrantType, TokenExchangeGrantType, PasswordGrantType, JWTBearerGrantType},
+		SubjectTypesSupported:              []string{"public"},
+		IDTokenSigningAlgValuesSupported:   []string{"ES384"},
+		TokenEndpointAuthMethodsSupported:  []string{"client_secret_post", "client_secret_basic", "private_key_jwt", "none"},
+		ClaimsSupported: []string{"iss", "sub", "aud", "azp", "exp", "iat", "auth_time", "nonce", "acr",
+			"name", "given_name", "family_name", "email", "email_verified", "phone_number", "phone_number_verified", "address"},
+		CodeChallengeMethodsSupported: []string{CodeChallengeMethodS256, CodeChallengeMethodPlain},
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&configuration)
+}
+
+//JWKSHandler is the handler of the /v1/oauth/jwks endpoint, it publishes the public keys to verify the JWT's
+// Next to the active signing key, the upcoming and retiring keys of the key ring are published
+func (service *Service) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keySet := jsonWebKeySet{
+		Keys: []jsonWebKey{newJSONWebKey(&service.jwtSigningKey.PublicKey, service.jwtKeyID)},
+	}
+	kids := make([]string, 0, len(service.jwtVerificationKeys.Keys))
+	for kid := range service.jwtVerificationKeys.Keys {
+		if kid != service.jwtKeyID {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		keySet.Keys = append(keySet.Keys, newJSONWebKey(service.jwtVerificationKeys.Keys[kid], kid))
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	json.NewEncoder(w).Encode(&keySet)
+}
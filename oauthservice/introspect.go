@@ -0,0 +1,104 @@
+package oauthservice
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/db/organization"
+)
+
+//introspectionResponse is the response of the introspection endpoint
+// For inactive tokens, only the active field is returned
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	GlobalID  string `json:"globalid,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+}
+
+//introspectionStore gets the clients and access tokens the introspection endpoint needs
+type introspectionStore interface {
+	getClientByCredentials(clientID, secret string) (*Oauth2Client, error)
+	GetAccessToken(token string) (*AccessToken, error)
+}
+
+//IntrospectHandler is the handler of the /v1/oauth/introspect endpoint
+// It allows resource servers to validate an access token, the resource server authenticates using an organization api key
+// See https://tools.ietf.org/html/rfc7662
+func (service *Service) IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	// Report the scopes in the same way as the access token response does
+	tokenScope := func(at *AccessToken) (string, error) {
+		return verifyScopes(at.Scope, at.Username, at.ClientID, organization.NewManager(r))
+	}
+	introspect(w, r, NewManager(r), tokenScope)
+}
+
+//introspect writes the introspection response for the token in the request
+// Any authenticated client can introspect a token, also one that was issued to another client
+func introspect(w http.ResponseWriter, r *http.Request, store introspectionStore, tokenScope func(at *AccessToken) (string, error)) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("token")
+	clientID, clientSecret := getClientCredentials(r)
+	if clientID == "" || clientSecret == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if token == "" {
+		log.Debug("Required parameter missing in the request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	client, err := store.getClientByCredentials(clientID, clientSecret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if client == nil {
+		log.Info("(client_id - secret) combination not found")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	response := introspectionResponse{}
+	at, err := store.GetAccessToken(token)
+	if err != nil {
+		log.Error("Error getting the access token: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if at != nil && !at.IsExpired() {
+		scope, err := tokenScope(at)
+		if err != nil {
+			log.Error("Failed to verify token scopes: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		response = introspectionResponse{
+			Active:    true,
+			Scope:     scope,
+			ClientID:  at.ClientID,
+			Username:  at.Username,
+			GlobalID:  at.GlobalID,
+			TokenType: at.Type,
+			Exp:       at.ExpirationTime().Unix(),
+			Iat:       at.CreatedAt.Unix(),
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
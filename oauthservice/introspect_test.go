@@ -0,0 +1,94 @@
+package oauthservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testIntrospectionStore struct {
+	clients map[string]*Oauth2Client
+	tokens  map[string]*AccessToken
+}
+
+func (s *testIntrospectionStore) getClientByCredentials(clientID, secret string) (*Oauth2Client, error) {
+	client := s.clients[clientID]
+	if client == nil || client.Secret != secret {
+		return nil, nil
+	}
+	return client, nil
+}
+
+func (s *testIntrospectionStore) GetAccessToken(token string) (*AccessToken, error) {
+	return s.tokens[token], nil
+}
+
+func TestIntrospect(t *testing.T) {
+	now := time.Now()
+	store := &testIntrospectionStore{
+		clients: map[string]*Oauth2Client{
+			"resourceserver": &Oauth2Client{ClientID: "resourceserver", Secret: "secret"},
+		},
+		tokens: map[string]*AccessToken{
+			"active":      &AccessToken{AccessToken: "active", Type: "bearer", Username: "bob", Scope: "user:name", ClientID: "resourceserver", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			"otherclient": &AccessToken{AccessToken: "otherclient", Type: "bearer", Username: "bob", Scope: "user:name", ClientID: "otherorg", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			"expired":     &AccessToken{AccessToken: "expired", Type: "bearer", Username: "bob", Scope: "user:name", ClientID: "resourceserver", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+	tokenScope := func(at *AccessToken) (string, error) {
+		return at.Scope, nil
+	}
+
+	type testcase struct {
+		name         string
+		clientID     string
+		secret       string
+		token        string
+		status       int
+		active       bool
+		tokenClient  string
+		inactiveBody bool
+	}
+	testcases := []testcase{
+		{name: "active token", clientID: "resourceserver", secret: "secret", token: "active", status: http.StatusOK, active: true, tokenClient: "resourceserver"},
+		{name: "token of another client", clientID: "resourceserver", secret: "secret", token: "otherclient", status: http.StatusOK, active: true, tokenClient: "otherorg"},
+		{name: "expired token", clientID: "resourceserver", secret: "secret", token: "expired", status: http.StatusOK, inactiveBody: true},
+		{name: "unknown token", clientID: "resourceserver", secret: "secret", token: "unknown", status: http.StatusOK, inactiveBody: true},
+		{name: "missing client authentication", token: "active", status: http.StatusUnauthorized},
+		{name: "missing secret", clientID: "resourceserver", token: "active", status: http.StatusUnauthorized},
+		{name: "invalid secret", clientID: "resourceserver", secret: "wrong", token: "active", status: http.StatusUnauthorized},
+		{name: "unknown client", clientID: "otherorg", secret: "secret", token: "active", status: http.StatusUnauthorized},
+		{name: "missing token", clientID: "resourceserver", secret: "secret", status: http.StatusBadRequest},
+	}
+	for _, test := range testcases {
+		form := url.Values{"token": {test.token}}
+		r := httptest.NewRequest("POST", "/v1/oauth/introspect", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.clientID != "" {
+			r.SetBasicAuth(test.clientID, test.secret)
+		}
+		w := httptest.NewRecorder()
+		introspect(w, r, store, tokenScope)
+		assert.Equal(t, test.status, w.Code, test.name)
+		if test.status != http.StatusOK {
+			continue
+		}
+		if test.inactiveBody {
+			assert.JSONEq(t, `{"active":false}`, w.Body.String(), test.name)
+			continue
+		}
+		response := introspectionResponse{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&response), test.name)
+		assert.Equal(t, test.active, response.Active, test.name)
+		assert.Equal(t, test.tokenClient, response.ClientID, test.name)
+		assert.Equal(t, "bob", response.Username, test.name)
+		assert.Equal(t, "user:name", response.Scope, test.name)
+		assert.Equal(t, now.Add(time.Hour).Unix(), response.Exp, test.name)
+	}
+}
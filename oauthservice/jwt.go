@@ -35,7 +35,7 @@ func (service *Service) JWTHandler(w http.ResponseWriter, r *http.Request) {
 	audiences := strings.TrimSpace(r.FormValue("aud"))
 
 	//First check if the user uses an existing jwt to authenticate and authorize itself
-	idToken, err := oauth2.GetValidJWT(r, &service.jwtSigningKey.PublicKey)
+	idToken, err := oauth2.GetValidJWT(r, service.jwtVerificationKeys)
 	if err != nil {
 		log.Warning(err)
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
@@ -97,7 +97,7 @@ func (service *Service) RefreshJWTHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	originalToken, err := oauth2.GetValidJWT(r, &service.jwtSigningKey.PublicKey)
+	originalToken, err := oauth2.GetValidJWT(r, service.jwtVerificationKeys)
 	err = oauth2.IgnoreExpired(err)
 	if err != nil {
 		log.Warning(err)
@@ -152,7 +152,13 @@ func (service *Service) RefreshJWTHandler(w http.ResponseWriter, r *http.Request
 	// Set a new expiration time
 	validity := parseValidity(r)
 
-	expiration := time.Now().Add(AccessTokenExpiration).Unix()
+	tokenValidity, err := accessTokenValidity(clientID, orgMgr)
+	if err != nil {
+		log.Error("Error getting the access token validity: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	expiration := time.Now().Add(tokenValidity).Unix()
 
 	requestedExpiration := expiration
 	if validity > 0 {
@@ -163,6 +169,7 @@ func (service *Service) RefreshJWTHandler(w http.ResponseWriter, r *http.Request
 	}
 	originalToken.Claims["exp"] = expiration
 	// Sign it and return
+	originalToken.Header["kid"] = service.jwtKeyID
 	tokenString, err := originalToken.SignedString(service.jwtSigningKey)
 	if err != nil {
 		log.Error(err)
@@ -211,6 +218,7 @@ func (service *Service) convertAccessTokenToJWT(r *http.Request, at *AccessToken
 	}
 
 	token := jwt.New(jwt.SigningMethodES384)
+	token.Header["kid"] = service.jwtKeyID
 
 	//More extensive validation
 	var grantedScopes []string
@@ -247,6 +255,9 @@ func (service *Service) convertAccessTokenToJWT(r *http.Request, at *AccessToken
 	// It does not hurt to always set the azp claim while it is only needed when the ID Token has a single
 	// audience value and that audience is different than the authorized party
 	token.Claims["azp"] = at.ClientID
+	if err = applyJWTClaimsTemplate(r, token, at.Username, at.ClientID); err != nil {
+		return
+	}
 
 	expiration := at.ExpirationTime().Unix()
 	// If a custom validity period for the jwt is set, verify that it expires sooner
@@ -318,6 +329,7 @@ func (service *Service) createNewJWTFromParent(r *http.Request, parentToken *jwt
 	}
 
 	token := jwt.New(jwt.SigningMethodES384)
+	token.Header["kid"] = service.jwtKeyID
 	var grantedScopes []string
 	username := parentToken.Claims["username"].(string)
 	if username != "" {
@@ -350,9 +362,18 @@ func (service *Service) createNewJWTFromParent(r *http.Request, parentToken *jwt
 		token.Claims["aud"] = audiencesArr
 	}
 	token.Claims["azp"] = parentToken.Claims["azp"]
+	authorizedParty, _ := token.Claims["azp"].(string)
+	if err = applyJWTClaimsTemplate(r, token, username, authorizedParty); err != nil {
+		return
+	}
 	lastUsed := db.DateTime(time.Now())
 	if parentRefreshToken != nil {
-		token.Claims["exp"] = time.Now().Add(AccessTokenExpiration).Unix()
+		var validity time.Duration
+		validity, err = accessTokenValidity(parentRefreshToken.AuthorizedParty, organization.NewManager(r))
+		if err != nil {
+			return
+		}
+		token.Claims["exp"] = time.Now().Add(validity).Unix()
 		parentRefreshToken.LastUsed = lastUsed
 		if err = mgr.saveRefreshToken(parentRefreshToken); err != nil {
 			return
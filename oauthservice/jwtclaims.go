@@ -0,0 +1,77 @@
+package oauthservice
+
+import (
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/registry"
+	"gopkg.in/mgo.v2"
+)
+
+//registryLookup gets the value of a registry entry of a user or an organization, an empty string is returned if the entry does not exist
+type registryLookup func(username, globalid, key string) (value string, err error)
+
+//applyJWTClaimsTemplate adds the required audience and the custom claims the authorized party configured to a jwt
+// If the authorized party is not an organization or did not configure a claims template, the jwt is left untouched
+func applyJWTClaimsTemplate(r *http.Request, token *jwt.Token, username, clientID string) (err error) {
+	template, err := organization.NewManager(r).GetJWTClaimsTemplate(clientID)
+	if err == mgo.ErrNotFound {
+		err = nil
+		return
+	}
+	if err != nil || template == nil {
+		return
+	}
+	registryMgr := registry.NewManager(r)
+	err = evaluateJWTClaimsTemplate(token.Claims, template, username, clientID, func(username, globalid, key string) (value string, err error) {
+		entry, err := registryMgr.GetRegistryEntry(username, globalid, key)
+		if entry != nil {
+			value = entry.Value
+		}
+		return
+	})
+	return
+}
+
+//evaluateJWTClaimsTemplate sets the claims of a claims template
+// Claims from the user registry are only added if the jwt is issued for a user, claims of which the registry entry does not exist are left out
+func evaluateJWTClaimsTemplate(claims map[string]interface{}, template *organization.JWTClaimsTemplate, username, clientID string, lookup registryLookup) (err error) {
+	if template.RequiredAudience != "" {
+		audiences, _ := claims["aud"].([]string)
+		claims["aud"] = withRequiredAudience(audiences, template.RequiredAudience)
+	}
+	for _, claim := range template.Claims {
+		//Templates stored before a claim became reserved can not overwrite it either
+		if organization.IsReservedClaim(claim.Name) {
+			continue
+		}
+		var value string
+		switch claim.Source {
+		case organization.ClaimSourceUserRegistry:
+			if username == "" {
+				continue
+			}
+			value, err = lookup(username, "", claim.Key)
+		case organization.ClaimSourceOrganizationRegistry:
+			value, err = lookup("", clientID, claim.Key)
+		}
+		if err != nil {
+			return
+		}
+		if value != "" {
+			claims[claim.Name] = value
+		}
+	}
+	return
+}
+
+//withRequiredAudience adds the required audience to the audiences if it is not in there yet
+func withRequiredAudience(audiences []string, requiredAudience string) []string {
+	for _, audience := range audiences {
+		if audience == requiredAudience {
+			return audiences
+		}
+	}
+	return append(audiences, requiredAudience)
+}
@@ -0,0 +1,52 @@
+package oauthservice
+
+import (
+	"testing"
+
+	"github.com/itsyouonline/identityserver/db/organization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateJWTClaimsTemplate(t *testing.T) {
+	template := &organization.JWTClaimsTemplate{
+		RequiredAudience: "api.example.com",
+		Claims: []organization.TemplateClaim{
+			{Name: "employeeid", Source: organization.ClaimSourceUserRegistry, Key: "employee"},
+			{Name: "tenant", Source: organization.ClaimSourceOrganizationRegistry, Key: "tenant"},
+			{Name: "missing", Source: organization.ClaimSourceUserRegistry, Key: "missing"},
+		},
+	}
+	registries := map[string]string{
+		"user1//employee": "E123",
+		"/testorg/tenant": "acme",
+	}
+	lookup := func(username, globalid, key string) (string, error) {
+		return registries[username+"/"+globalid+"/"+key], nil
+	}
+
+	claims := map[string]interface{}{"aud": []string{"other"}}
+	assert.NoError(t, evaluateJWTClaimsTemplate(claims, template, "user1", "testorg", lookup))
+	assert.Equal(t, []string{"other", "api.example.com"}, claims["aud"])
+	assert.Equal(t, "E123", claims["employeeid"])
+	assert.Equal(t, "acme", claims["tenant"])
+	assert.NotContains(t, claims, "missing")
+
+	// A jwt of the organization itself does not get user registry claims
+	claims = map[string]interface{}{}
+	assert.NoError(t, evaluateJWTClaimsTemplate(claims, template, "", "testorg", lookup))
+	assert.Equal(t, []string{"api.example.com"}, claims["aud"])
+	assert.NotContains(t, claims, "employeeid")
+	assert.Equal(t, "acme", claims["tenant"])
+
+	// Reserved claims in a template are ignored
+	template.Claims = []organization.TemplateClaim{{Name: "act", Source: organization.ClaimSourceUserRegistry, Key: "employee"}}
+	claims = map[string]interface{}{"act": map[string]interface{}{"sub": "service"}}
+	assert.NoError(t, evaluateJWTClaimsTemplate(claims, template, "user1", "testorg", lookup))
+	assert.Equal(t, map[string]interface{}{"sub": "service"}, claims["act"])
+}
+
+func TestWithRequiredAudience(t *testing.T) {
+	assert.Equal(t, []string{"a"}, withRequiredAudience(nil, "a"))
+	assert.Equal(t, []string{"a", "b"}, withRequiredAudience([]string{"a", "b"}, "b"))
+	assert.Equal(t, []string{"a", "b"}, withRequiredAudience([]string{"a"}, "b"))
+}
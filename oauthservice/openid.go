@@ -0,0 +1,185 @@
+package oauthservice
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/itsyouonline/identityserver/db/validation"
+)
+
+const (
+	//openIDScope is the scope a client requests to start an OpenID Connect authentication
+	openIDScope = "openid"
+	//acrPassword is the acr claim when the user only authenticated with a password, 2FA was skipped because of a recent 2FA login
+	acrPassword = "password"
+	//acrTwoFactor is the acr claim when the user authenticated using a password and a second factor
+	acrTwoFactor = "2fa"
+)
+
+//isOpenIDRequest checks if the openid scope is part of a scopestring
+func isOpenIDRequest(scopestring string) bool {
+	for _, scope := range oauth2.SplitScopeString(scopestring) {
+		if scope == openIDScope {
+			return true
+		}
+	}
+	return false
+}
+
+//scopeLabel returns the requested label of a labelled scope like user:email:work, 'main' is returned if no label is given
+func scopeLabel(scope string, scopePrefix string) string {
+	label := strings.Split(strings.TrimPrefix(strings.TrimPrefix(scope, scopePrefix), ":"), ":")[0]
+	if label == "" {
+		label = "main"
+	}
+	return label
+}
+
+//realLabel maps the label requested by the client to the label the user selected in the authorization
+func realLabel(requestedLabel string, authorizationMaps []user.AuthorizationMap) string {
+	for _, m := range authorizationMaps {
+		if m.RequestedLabel == requestedLabel {
+			return m.RealLabel
+		}
+	}
+	return requestedLabel
+}
+
+//getOpenIDClaims maps the user information authorized by the scopes to the standard OpenID Connect claims
+// See http://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+func getOpenIDClaims(r *http.Request, username string, clientID string, scopes []string) (claims map[string]interface{}, err error) {
+	claims = make(map[string]interface{})
+	userMgr := user.NewManager(r)
+	userObj, err := userMgr.GetByName(username)
+	if err != nil {
+		return
+	}
+	authorization, err := userMgr.GetAuthorization(username, clientID)
+	if err != nil {
+		return
+	}
+	if authorization == nil {
+		return
+	}
+	// Only expose the information the user still authorizes, the scopes might have been granted before an authorization change
+	scopes = authorization.FilterAuthorizedScopes(scopes)
+	valMgr := validation.NewManager(r)
+	for _, scope := range scopes {
+		switch {
+		case strings.HasPrefix(scope, "user:address"):
+			if _, present := claims["address"]; present {
+				continue
+			}
+			address, e := userObj.GetAddressByLabel(realLabel(scopeLabel(scope, "user:address"), authorization.Addresses))
+			if e != nil {
+				continue
+			}
+			claims["address"] = newAddressClaim(address)
+		case scope == "user:name":
+			claims["name"] = strings.TrimSpace(userObj.Firstname + " " + userObj.Lastname)
+			claims["given_name"] = userObj.Firstname
+			claims["family_name"] = userObj.Lastname
+		case strings.HasPrefix(scope, "user:email") || strings.HasPrefix(scope, "user:validated:email"):
+			if _, present := claims["email"]; present {
+				continue
+			}
+			var label string
+			if strings.HasPrefix(scope, "user:validated:email") {
+				label = realLabel(scopeLabel(scope, "user:validated:email"), authorization.ValidatedEmailAddresses)
+			} else {
+				label = realLabel(scopeLabel(scope, "user:email"), authorization.EmailAddresses)
+			}
+			email, e := userObj.GetEmailAddressByLabel(label)
+			if e != nil {
+				continue
+			}
+			var validated bool
+			if validated, err = valMgr.IsEmailAddressValidated(username, email.EmailAddress); err != nil {
+				return
+			}
+			claims["email"] = email.EmailAddress
+			claims["email_verified"] = validated
+		case strings.HasPrefix(scope, "user:phone") || strings.HasPrefix(scope, "user:validated:phone"):
+			if _, present := claims["phone_number"]; present {
+				continue
+			}
+			var label string
+			if strings.HasPrefix(scope, "user:validated:phone") {
+				label = realLabel(scopeLabel(scope, "user:validated:phone"), authorization.ValidatedPhonenumbers)
+			} else {
+				label = realLabel(scopeLabel(scope, "user:phone"), authorization.Phonenumbers)
+			}
+			phonenumber, e := userObj.GetPhonenumberByLabel(label)
+			if e != nil {
+				continue
+			}
+			var validated bool
+			if validated, err = valMgr.IsPhonenumberValidated(username, phonenumber.Phonenumber); err != nil {
+				return
+			}
+			claims["phone_number"] = phonenumber.Phonenumber
+			claims["phone_number_verified"] = validated
+		}
+	}
+	return
+}
+
+//addressClaim is the OpenID Connect representation of a postal address
+// See http://openid.net/specs/openid-connect-core-1_0.html#AddressClaim
+type addressClaim struct {
+	Formatted     string `json:"formatted"`
+	StreetAddress string `json:"street_address"`
+	Locality      string `json:"locality"`
+	PostalCode    string `json:"postal_code"`
+	Country       string `json:"country"`
+}
+
+//newAddressClaim converts a user address to an address claim
+func newAddressClaim(address user.Address) (claim addressClaim) {
+	claim.StreetAddress = strings.TrimSpace(address.Street + " " + address.Nr)
+	if address.Other != "" {
+		claim.StreetAddress += "\n" + address.Other
+	}
+	claim.Locality = address.City
+	claim.PostalCode = address.Postalcode
+	claim.Country = address.Country
+	claim.Formatted = strings.Join([]string{claim.StreetAddress, strings.TrimSpace(address.Postalcode + " " + address.City), address.Country}, "\n")
+	return
+}
+
+//createIDToken creates an OpenID Connect id_token for an access token acquired through an authorization code flow
+func (service *Service) createIDToken(r *http.Request, at *AccessToken, ar *authorizationRequest) (tokenString string, err error) {
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Header["kid"] = service.jwtKeyID
+
+	claims, err := getOpenIDClaims(r, at.Username, at.ClientID, oauth2.SplitScopeString(at.Scope))
+	if err != nil {
+		return
+	}
+	for claim, value := range claims {
+		token.Claims[claim] = value
+	}
+
+	token.Claims["iss"] = issuer
+	token.Claims["sub"] = at.Username
+	token.Claims["aud"] = at.ClientID
+	token.Claims["azp"] = at.ClientID
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["exp"] = at.ExpirationTime().Unix()
+	if !ar.AuthTime.IsZero() {
+		token.Claims["auth_time"] = ar.AuthTime.Unix()
+	}
+	if ar.Nonce != "" {
+		token.Claims["nonce"] = ar.Nonce
+	}
+	if ar.ACR != "" {
+		token.Claims["acr"] = ar.ACR
+	}
+
+	tokenString, err = token.SignedString(service.jwtSigningKey)
+	return
+}
@@ -0,0 +1,41 @@
+package oauthservice
+
+import (
+	"testing"
+
+	"github.com/itsyouonline/identityserver/db/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsOpenIDRequest(t *testing.T) {
+	assert.True(t, isOpenIDRequest("openid"))
+	assert.True(t, isOpenIDRequest("user:name, openid"))
+	assert.False(t, isOpenIDRequest(""))
+	assert.False(t, isOpenIDRequest("user:name,user:email"))
+}
+
+func TestScopeLabel(t *testing.T) {
+	assert.Equal(t, "main", scopeLabel("user:email", "user:email"))
+	assert.Equal(t, "main", scopeLabel("user:email:", "user:email"))
+	assert.Equal(t, "work", scopeLabel("user:email:work", "user:email"))
+	assert.Equal(t, "home", scopeLabel("user:phone:home:write", "user:phone"))
+	assert.Equal(t, "home", scopeLabel("user:validated:phone:home", "user:validated:phone"))
+}
+
+func TestRealLabel(t *testing.T) {
+	maps := []user.AuthorizationMap{user.AuthorizationMap{RequestedLabel: "main", RealLabel: "home"}}
+	assert.Equal(t, "home", realLabel("main", maps))
+	assert.Equal(t, "work", realLabel("work", maps))
+}
+
+func TestNewAddressClaim(t *testing.T) {
+	claim := newAddressClaim(user.Address{Street: "Main street", Nr: "1", City: "Ghent", Postalcode: "9000", Country: "Belgium"})
+	assert.Equal(t, "Main street 1", claim.StreetAddress)
+	assert.Equal(t, "Ghent", claim.Locality)
+	assert.Equal(t, "9000", claim.PostalCode)
+	assert.Equal(t, "Belgium", claim.Country)
+	assert.Equal(t, "Main street 1\n9000 Ghent\nBelgium", claim.Formatted)
+
+	claim = newAddressClaim(user.Address{Street: "Main street", Nr: "1", Other: "Box 3"})
+	assert.Equal(t, "Main street 1\nBox 3", claim.StreetAddress)
+}
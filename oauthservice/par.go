@@ -0,0 +1,252 @@
+package oauthservice
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//Pushed authorization requests
+// See https://tools.ietf.org/html/rfc9126
+
+const (
+	//pushedAuthorizationRequestExpiration is how long a request_uri can be used, it needs to cover the time the user takes to log in and authorize the client
+	pushedAuthorizationRequestExpiration = time.Minute * 10
+	//requestURIPrefix is the prefix of the request_uri values handed out by the par endpoint
+	requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+	//maxPushedParameterLength is the maximum number of characters of a pushed parameter value
+	maxPushedParameterLength = 2048
+)
+
+//pushedAuthorizationRequest holds the parameters of an authorize request a client pushed to the par endpoint
+type pushedAuthorizationRequest struct {
+	RequestURI string
+	ClientID   string
+	Parameters url.Values
+	CreatedAt  time.Time
+}
+
+func newPushedAuthorizationRequest(clientID string, parameters url.Values) *pushedAuthorizationRequest {
+	var par pushedAuthorizationRequest
+	randombytes := make([]byte, 30) //Multiple of 3 to make sure no padding is added
+	rand.Read(randombytes)
+	par.RequestURI = requestURIPrefix + base64.URLEncoding.EncodeToString(randombytes)
+	par.ClientID = clientID
+	par.Parameters = parameters
+	par.CreatedAt = time.Now()
+	return &par
+}
+
+//IsExpiredAt checks if the request_uri of the pushed authorization request is expired at a specific time
+func (par *pushedAuthorizationRequest) IsExpiredAt(testtime time.Time) bool {
+	return testtime.After(par.CreatedAt.Add(pushedAuthorizationRequestExpiration))
+}
+
+//authorizeParameters returns the parameters of the authorize request, the client_id is always the one of the client that pushed the request
+func (par *pushedAuthorizationRequest) authorizeParameters() url.Values {
+	parameters := url.Values{}
+	for key, values := range par.Parameters {
+		parameters[key] = append([]string(nil), values...)
+	}
+	parameters.Set("client_id", par.ClientID)
+	parameters.Set("request_uri", par.RequestURI)
+	return parameters
+}
+
+//pushedParameterNames are the authorize parameters that are stored for a pushed authorization request, other parameters are ignored
+var pushedParameterNames = []string{"response_type", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method", "prompt", "max_age", "acr_values"}
+
+//pushedParameters copies the known authorize parameters of a par request
+// Only the first value of a parameter is kept, valid is false if a value is too long to be stored
+func pushedParameters(form url.Values) (parameters url.Values, valid bool) {
+	parameters = url.Values{}
+	for _, name := range pushedParameterNames {
+		value := form.Get(name)
+		if value == "" {
+			continue
+		}
+		if len(value) > maxPushedParameterLength {
+			return
+		}
+		parameters.Set(name, value)
+	}
+	valid = true
+	return
+}
+
+//PushedAuthorizationRequestHandler is the handler of the /v1/oauth/par endpoint
+// An authenticated client posts the authorize parameters and receives a request_uri to use in the authorize request instead
+func (service *Service) PushedAuthorizationRequestHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mgr := NewManager(r)
+	clientID, clientSecret := getClientCredentials(r)
+	authenticated := false
+	if r.PostForm.Get("client_assertion") != "" {
+		clientID, _, err = service.clientAssertionCredentials(r, "")
+		authenticated = err == nil
+		if err == errInvalidClientAssertion {
+			err = nil
+		}
+	} else if clientID != "" {
+		authenticated, err = mgr.authenticateClient(clientID, clientSecret)
+	}
+	if err != nil {
+		log.Error("Error authenticating the oauth client: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !authenticated {
+		log.Info("Client authentication failed")
+		writeOAuthError(w, errorInvalidClient)
+		return
+	}
+	if clientID == "itsyouonline" {
+		log.Warn("HACK attempt, someone tried to push an authorization request as the 'itsyouonline' client")
+		writeOAuthError(w, errorInvalidClient)
+		return
+	}
+
+	if r.PostForm.Get("request_uri") != "" {
+		log.Debug("A pushed authorization request can not contain a request_uri")
+		writeOAuthError(w, errorInvalidRequest)
+		return
+	}
+	parameters, valid := pushedParameters(r.PostForm)
+	if !valid {
+		log.Debug("Too long parameter in a pushed authorization request")
+		writeOAuthError(w, errorInvalidRequest)
+		return
+	}
+	if parameters.Get("response_type") != AuthorizationGrantCodeType || !isValidCodeChallenge(parameters.Get("code_challenge"), parameters.Get("code_challenge_method")) {
+		log.Debug("Invalid response_type, code_challenge or code_challenge_method in a pushed authorization request")
+		writeOAuthError(w, errorInvalidRequest)
+		return
+	}
+	valid, err = validateRedirectURI(mgr, parameters.Get("redirect_uri"), clientID)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		log.Debug("Invalid redirect_uri in a pushed authorization request")
+		writeOAuthError(w, errorInvalidRequest)
+		return
+	}
+
+	par := newPushedAuthorizationRequest(clientID, parameters)
+	if err = mgr.savePushedAuthorizationRequest(par); err != nil {
+		log.Error("Error saving the pushed authorization request: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		RequestURI string `json:"request_uri"`
+		ExpiresIn  int64  `json:"expires_in"`
+	}{
+		RequestURI: par.RequestURI,
+		ExpiresIn:  int64(pushedAuthorizationRequestExpiration.Seconds()),
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&response)
+}
+
+//resolvePushedAuthorizationRequest replaces the parameters of an authorize request with a request_uri by the pushed parameters
+// The pushed parameters are not added to the url, the redirects to the login and authorize pages only carry the client_id and request_uri
+// valid is false if the request_uri is unknown or expired, or if the client requires pushed authorization requests and the request does not have a request_uri
+func resolvePushedAuthorizationRequest(request *http.Request, mgr *Manager) (par *pushedAuthorizationRequest, valid bool, err error) {
+	clientID := request.Form.Get("client_id")
+	requestURI := request.Form.Get("request_uri")
+	if requestURI == "" {
+		var required bool
+		required, err = mgr.requiresPushedAuthorizationRequests(clientID)
+		if err == nil && required {
+			log.Debug(clientID, " requires pushed authorization requests")
+		}
+		valid = !required
+		return
+	}
+	if !strings.HasPrefix(requestURI, requestURIPrefix) {
+		log.Debug("Unknown request_uri")
+		return
+	}
+	par, err = mgr.getPushedAuthorizationRequest(requestURI)
+	if err != nil || par == nil {
+		return
+	}
+	if par.ClientID != clientID || par.IsExpiredAt(time.Now()) {
+		log.Debug("The request_uri is expired or was pushed by another client")
+		par = nil
+		return
+	}
+	request.Form = par.authorizeParameters()
+	valid = true
+	return
+}
+
+//PushedAuthorizationScopesHandler is the handler of GET /v1/oauth/par/scopes
+// The authorize page gets the scopes of a pushed authorization request here since they are not part of its url
+func (service *Service) PushedAuthorizationScopesHandler(w http.ResponseWriter, request *http.Request) {
+	err := request.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	username, err := service.GetWebuser(request, w)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	mgr := NewManager(request)
+	par, _, err := resolvePushedAuthorizationRequest(request, mgr)
+	if err != nil {
+		log.Error("Error resolving the request_uri: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if par == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	possibleScopes, authorizedScopes, consent, err := service.getScopeAuthorizations(request, username, par.ClientID)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	//The same values the authorize page gets in the scope and newscope parameters for a regular authorize request
+	response := struct {
+		Scope    string  `json:"scope"`
+		NewScope *string `json:"newscope,omitempty"`
+	}{
+		Scope: strings.Join(possibleScopes, ","),
+	}
+	if newScopes := scopesToAsk(possibleScopes, authorizedScopes, consent, time.Now()); newScopes != nil {
+		newScopeString := strings.Join(newScopes, ",")
+		response.NewScope = &newScopeString
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
@@ -0,0 +1,50 @@
+package oauthservice
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	pushed := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"otherclient"},
+		"scope":         {"user:name,user:memberof:org1"},
+	}
+	par := newPushedAuthorizationRequest("client", pushed)
+	assert.True(t, strings.HasPrefix(par.RequestURI, requestURIPrefix))
+	assert.NotEqual(t, par.RequestURI, newPushedAuthorizationRequest("client", pushed).RequestURI)
+
+	now := time.Now()
+	assert.False(t, par.IsExpiredAt(now))
+	assert.True(t, par.IsExpiredAt(now.Add(pushedAuthorizationRequestExpiration+time.Second)))
+
+	parameters := par.authorizeParameters()
+	assert.Equal(t, "client", parameters.Get("client_id"))
+	assert.Equal(t, par.RequestURI, parameters.Get("request_uri"))
+	assert.Equal(t, "user:name,user:memberof:org1", parameters.Get("scope"))
+	assert.Equal(t, "otherclient", par.Parameters.Get("client_id"))
+}
+
+func TestPushedParameters(t *testing.T) {
+	form := url.Values{
+		"response_type":         {"code"},
+		"scope":                 {"user:name", "user:email"},
+		"state":                 {"abc"},
+		"client_secret":         {"secret"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"$where":                {"1"},
+		"a.b":                   {"1"},
+	}
+	parameters, valid := pushedParameters(form)
+	assert.True(t, valid)
+	assert.Equal(t, url.Values{"response_type": {"code"}, "scope": {"user:name"}, "state": {"abc"}}, parameters)
+
+	form.Set("state", strings.Repeat("a", maxPushedParameterLength+1))
+	_, valid = pushedParameters(form)
+	assert.False(t, valid)
+}
@@ -0,0 +1,46 @@
+package oauthservice
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+//Proof Key for Code Exchange (PKCE) support
+// See https://tools.ietf.org/html/rfc7636
+
+const (
+	//CodeChallengeMethodPlain is the code_challenge_method where the code_challenge equals the code_verifier
+	CodeChallengeMethodPlain = "plain"
+	//CodeChallengeMethodS256 is the code_challenge_method where the code_challenge is the base64url encoded SHA256 hash of the code_verifier
+	CodeChallengeMethodS256 = "S256"
+)
+
+//codeVerifierRegex matches the allowed characters and length of a code_verifier and a code_challenge
+var codeVerifierRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+//isValidCodeChallenge checks the code_challenge and code_challenge_method parameters of an authorization request
+// Not passing a code_challenge is valid, it means the client does not use PKCE
+func isValidCodeChallenge(codeChallenge, codeChallengeMethod string) bool {
+	if codeChallenge == "" {
+		return codeChallengeMethod == ""
+	}
+	if codeChallengeMethod != "" && codeChallengeMethod != CodeChallengeMethodPlain && codeChallengeMethod != CodeChallengeMethodS256 {
+		return false
+	}
+	return codeVerifierRegex.MatchString(codeChallenge)
+}
+
+//verifyCodeVerifier checks if the code_verifier passed when redeeming an authorization code matches the stored code_challenge
+func verifyCodeVerifier(codeVerifier, codeChallenge, codeChallengeMethod string) bool {
+	if !codeVerifierRegex.MatchString(codeVerifier) {
+		return false
+	}
+	expectedChallenge := codeVerifier
+	if codeChallengeMethod == CodeChallengeMethodS256 {
+		hash := sha256.Sum256([]byte(codeVerifier))
+		expectedChallenge = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expectedChallenge), []byte(codeChallenge)) == 1
+}
@@ -0,0 +1,32 @@
+package oauthservice
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidCodeChallenge(t *testing.T) {
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.True(t, isValidCodeChallenge("", ""))
+	assert.False(t, isValidCodeChallenge("", CodeChallengeMethodS256))
+	assert.True(t, isValidCodeChallenge(challenge, ""))
+	assert.True(t, isValidCodeChallenge(challenge, CodeChallengeMethodPlain))
+	assert.True(t, isValidCodeChallenge(challenge, CodeChallengeMethodS256))
+	assert.False(t, isValidCodeChallenge(challenge, "s256"))
+	assert.False(t, isValidCodeChallenge("tooshort", CodeChallengeMethodS256))
+	assert.False(t, isValidCodeChallenge(strings.Repeat("a", 129), CodeChallengeMethodPlain))
+	assert.False(t, isValidCodeChallenge(challenge+"+/=", CodeChallengeMethodS256))
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	//Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.True(t, verifyCodeVerifier(verifier, challenge, CodeChallengeMethodS256))
+	assert.False(t, verifyCodeVerifier(verifier, challenge, CodeChallengeMethodPlain))
+	assert.True(t, verifyCodeVerifier(verifier, verifier, CodeChallengeMethodPlain))
+	assert.False(t, verifyCodeVerifier("", challenge, CodeChallengeMethodS256))
+	assert.False(t, verifyCodeVerifier(challenge, challenge, CodeChallengeMethodS256))
+}
@@ -1,10 +1,12 @@
 package oauthservice
 
 import (
+	"crypto/rand"
 	"encoding/base64"
-	"github.com/itsyouonline/identityserver/db"
-	"math/rand"
 	"time"
+
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/db"
 )
 
 type refreshToken struct {
@@ -16,6 +18,11 @@ type refreshToken struct {
 	LastUsed        db.DateTime
 	Subject         string
 	AuthorizedParty string
+	//Family is shared by all refresh tokens that are the result of rotating the same original refresh token
+	// It is only set for refresh tokens handed out by the access_token endpoint
+	Family string `bson:"family,omitempty"`
+	//ReplacedBy is the refresh token that was handed out when this one was used, a used refresh token can not be used again
+	ReplacedBy string `bson:"replacedby,omitempty"`
 }
 
 func newRefreshToken() (auth refreshToken) {
@@ -24,3 +31,39 @@ func newRefreshToken() (auth refreshToken) {
 	auth.RefreshToken = base64.URLEncoding.EncodeToString(randombytes)
 	return
 }
+
+//newRefreshTokenFamily creates the first refresh token of a new rotation family for an access token
+func newRefreshTokenFamily(at *AccessToken) (rt refreshToken) {
+	rt = newRefreshToken()
+	rt.Family = rt.RefreshToken
+	rt.Subject = at.Username
+	rt.AuthorizedParty = at.ClientID
+	rt.Scopes = oauth2.SplitScopeString(at.Scope)
+	rt.LastUsed = db.DateTime(time.Now())
+	return
+}
+
+//rotate marks the refresh token as used and creates its successor in the same family
+func (rt *refreshToken) rotate() (successor refreshToken) {
+	successor = newRefreshToken()
+	successor.Family = rt.Family
+	successor.Subject = rt.Subject
+	successor.AuthorizedParty = rt.AuthorizedParty
+	successor.Scopes = rt.Scopes
+	successor.Expires = rt.Expires
+	successor.LastUsed = db.DateTime(time.Now())
+
+	rt.ReplacedBy = successor.RefreshToken
+	rt.LastUsed = successor.LastUsed
+	return
+}
+
+//IsUsed checks if this refresh token was already exchanged for a new one
+func (rt *refreshToken) IsUsed() bool {
+	return rt.ReplacedBy != ""
+}
+
+//IsExpiredAt checks if the refresh token has an explicit expiration before a specific time
+func (rt *refreshToken) IsExpiredAt(testtime time.Time) bool {
+	return rt.Expires != nil && testtime.After(*rt.Expires)
+}
@@ -3,6 +3,7 @@ package oauthservice
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -12,3 +13,33 @@ func TestNewRefreshToken(t *testing.T) {
 	assert.NotEmpty(t, a.RefreshToken)
 	assert.False(t, strings.HasSuffix(a.RefreshToken, "="))
 }
+
+func TestRefreshTokenRotation(t *testing.T) {
+	at := newAccessToken("user1", "", "client1", "user:name,user:email", AccessTokenExpiration)
+	rt := newRefreshTokenFamily(at)
+	assert.Equal(t, rt.RefreshToken, rt.Family)
+	assert.Equal(t, "user1", rt.Subject)
+	assert.Equal(t, "client1", rt.AuthorizedParty)
+	assert.Equal(t, []string{"user:name", "user:email"}, rt.Scopes)
+	assert.False(t, rt.IsUsed())
+
+	successor := rt.rotate()
+	assert.True(t, rt.IsUsed())
+	assert.Equal(t, successor.RefreshToken, rt.ReplacedBy)
+	assert.NotEqual(t, rt.RefreshToken, successor.RefreshToken)
+	assert.Equal(t, rt.Family, successor.Family)
+	assert.Equal(t, rt.Subject, successor.Subject)
+	assert.Equal(t, rt.AuthorizedParty, successor.AuthorizedParty)
+	assert.Equal(t, rt.Scopes, successor.Scopes)
+	assert.False(t, successor.IsUsed())
+}
+
+func TestRefreshTokenExpiration(t *testing.T) {
+	rt := newRefreshToken()
+	assert.False(t, rt.IsExpiredAt(time.Now()))
+
+	expires := time.Now()
+	rt.Expires = &expires
+	assert.False(t, rt.IsExpiredAt(expires))
+	assert.True(t, rt.IsExpiredAt(expires.Add(time.Second)))
+}
@@ -0,0 +1,105 @@
+package oauthservice
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//tokenRevoker revokes a token of a specific type if it exists, found is false if no such token exists
+type tokenRevoker func(token string, clientID string, mgr *Manager) (found bool, err error)
+
+//RevokeHandler is the handler of the /v1/oauth/revoke endpoint
+// It allows a client to invalidate an access token or refresh token it no longer needs
+// See https://tools.ietf.org/html/rfc7009
+func (service *Service) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Debug("ERROR parsing form: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("token")
+	clientID, clientSecret := getClientCredentials(r)
+	if token == "" || clientID == "" {
+		log.Debug("Required parameter missing in the request")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	mgr := NewManager(r)
+	authenticated, err := mgr.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !authenticated {
+		log.Info("Client authentication failed")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	//The token_type_hint only determines which kind of token is looked up first
+	revokers := []tokenRevoker{revokeAccessToken, revokeRefreshToken}
+	if r.FormValue("token_type_hint") == "refresh_token" {
+		revokers = []tokenRevoker{revokeRefreshToken, revokeAccessToken}
+	}
+	for _, revoke := range revokers {
+		found, err := revoke(token, clientID, mgr)
+		if err == errUnauthorized {
+			log.Info("Client ", clientID, " tried to revoke a token issued to another client")
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error("Error while revoking a token: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if found {
+			break
+		}
+	}
+
+	//Unknown or already invalid tokens are not reported, the client can not do anything about it anyway
+	w.WriteHeader(http.StatusOK)
+}
+
+func revokeAccessToken(token string, clientID string, mgr *Manager) (found bool, err error) {
+	at, err := mgr.GetAccessToken(token)
+	if err != nil || at == nil {
+		return
+	}
+	found = true
+	if at.ClientID != clientID {
+		err = errUnauthorized
+		return
+	}
+	err = mgr.removeAccessToken(token)
+	return
+}
+
+//revokeRefreshToken removes a refresh token, this cascades to the tokens that depend on it:
+// the rotated refresh tokens of the same family together with their access tokens,
+// or the refresh tokens of jwt's created from a jwt with this refresh token
+func revokeRefreshToken(token string, clientID string, mgr *Manager) (found bool, err error) {
+	rt, err := mgr.getRefreshToken(token)
+	if err != nil || rt == nil {
+		return
+	}
+	found = true
+	if rt.AuthorizedParty != clientID {
+		err = errUnauthorized
+		return
+	}
+	if rt.Family != "" {
+		err = mgr.removeRefreshTokenFamily(rt.Family)
+		return
+	}
+	err = mgr.removeRefreshTokenTree(token)
+	return
+}
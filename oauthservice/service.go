@@ -3,9 +3,12 @@ package oauthservice
 import (
 	"crypto/ecdsa"
 	"net/http"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/db/user"
 )
 
 //SessionService declares a context where you can have a logged in user
@@ -16,12 +19,16 @@ type SessionService interface {
 	GetOauthUser(request *http.Request, w http.ResponseWriter) (username string, err error)
 	//SetAPIAccessToken sets the api access token for this session
 	SetAPIAccessToken(w http.ResponseWriter, token string) (err error)
+	//GetAuthTime returns the time the user in the current session authenticated, or the zero time if unknown
+	GetAuthTime(request *http.Request, w http.ResponseWriter) (authTime time.Time, err error)
 }
 
 //IdentityService provides some basic knowledge about authorizations required for the oauthservice
 type IdentityService interface {
 	//FilterAuthorizedScopes filters the requested scopes to the ones that are authorizated, if no authorization exists, authorizedScops is nil
 	FilterAuthorizedScopes(r *http.Request, username string, grantedTo string, requestedscopes []string) (authorizedScopes []string, err error)
+	//GetLatestConsent returns the most recent consent the user gave to the client, nil if there is none
+	GetLatestConsent(r *http.Request, username string, clientID string) (consent *user.Consent, err error)
 	//FilterPossibleScopes filters the requestedScopes to the relevant ones that are possible
 	// For example, a `user:memberof:orgid1` is not possible if the user is not a member the `orgid1` organization and there is no outstanding invite for this organization
 	// If allowInvitations is true, invitations to organizations allows the "user:memberof:organization" as possible scopes
@@ -34,11 +41,15 @@ type Service struct {
 	identityService IdentityService
 	router          *mux.Router
 	jwtSigningKey   *ecdsa.PrivateKey
+	jwtKeyID        string
+	//jwtVerificationKeys contains the signing key and the other keys of the key ring that are still valid
+	jwtVerificationKeys *oauth2.JWTVerificationKeys
 }
 
 //NewService creates and initializes a Service
-func NewService(sessionService SessionService, identityService IdentityService, ecdsaKey *ecdsa.PrivateKey) (service *Service, err error) {
-	service = &Service{sessionService: sessionService, identityService: identityService, jwtSigningKey: ecdsaKey}
+func NewService(sessionService SessionService, identityService IdentityService, ecdsaKey *ecdsa.PrivateKey, verificationKeys *oauth2.JWTVerificationKeys) (service *Service, err error) {
+	service = &Service{sessionService: sessionService, identityService: identityService, jwtSigningKey: ecdsaKey, jwtVerificationKeys: verificationKeys}
+	service.jwtKeyID = oauth2.JWTKeyID(&ecdsaKey.PublicKey)
 	return
 }
 
@@ -47,6 +58,16 @@ const (
 	AuthorizationGrantCodeType = "code"
 	//ClientCredentialsGrantCodeType is the requested grant_type for a 'client credentials' oauth2 flow
 	ClientCredentialsGrantCodeType = "client_credentials"
+	//RefreshTokenGrantType is the requested grant_type to exchange a refresh token for a new access token
+	RefreshTokenGrantType = "refresh_token"
+	//DeviceCodeGrantType is the requested grant_type for a device polling for an access token in a 'device authorization' oauth2 flow
+	DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	//TokenExchangeGrantType is the requested grant_type for exchanging a token for a jwt to act on behalf of its subject
+	TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	//PasswordGrantType is the requested grant_type for a trusted client exchanging the credentials of a user for an access token
+	PasswordGrantType = "password"
+	//JWTBearerGrantType is the requested grant_type for a trusted client exchanging a signed assertion about a user for an access token
+	JWTBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
 )
 
 //GetWebuser returns the authenticated user if any or an empty string if not
@@ -77,6 +98,13 @@ func (service *Service) AddRoutes(router *mux.Router) {
 			w.Header().Add("Allow", "GET")
 		}).Methods("OPTIONS")
 
+	router.HandleFunc("/v1/oauth/par", service.PushedAuthorizationRequestHandler).Methods("POST")
+	router.HandleFunc("/v1/oauth/par",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Allow", "POST")
+		}).Methods("OPTIONS")
+	router.HandleFunc("/v1/oauth/par/scopes", service.PushedAuthorizationScopesHandler).Methods("GET")
+
 	router.HandleFunc("/v1/oauth/access_token", service.AccessTokenHandler).Methods("POST")
 	router.HandleFunc("/v1/oauth/access_token",
 		func(w http.ResponseWriter, r *http.Request) {
@@ -88,6 +116,34 @@ func (service *Service) AddRoutes(router *mux.Router) {
 			w.Header().Add("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
 		}).Methods("OPTIONS")
 
+	router.HandleFunc("/v1/oauth/device/code", service.DeviceCodeHandler).Methods("POST")
+	router.HandleFunc("/v1/oauth/device/code",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Allow", "POST")
+		}).Methods("OPTIONS")
+	router.HandleFunc("/v1/oauth/device/authorize", service.DeviceAuthorizeHandler).Methods("GET")
+	router.HandleFunc("/v1/oauth/device/authorize", service.DeviceConfirmHandler).Methods("POST")
+	router.HandleFunc("/v1/oauth/device/authorize",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Allow", "GET, POST")
+		}).Methods("OPTIONS")
+
+	router.HandleFunc("/v1/oauth/revoke", service.RevokeHandler).Methods("POST")
+	router.HandleFunc("/v1/oauth/revoke",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Allow", "POST")
+			// Allow cors
+			w.Header().Add("Access-Control-Allow-Origin", "*")
+			w.Header().Add("Access-Control-Allow-Methods", "POST")
+			w.Header().Add("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		}).Methods("OPTIONS")
+
+	router.HandleFunc("/v1/oauth/introspect", service.IntrospectHandler).Methods("POST")
+	router.HandleFunc("/v1/oauth/introspect",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Allow", "POST")
+		}).Methods("OPTIONS")
+
 	router.HandleFunc("/v1/oauth/jwt", service.JWTHandler).Methods("POST", "GET")
 	router.HandleFunc("/v1/oauth/jwt",
 		func(w http.ResponseWriter, r *http.Request) {
@@ -99,5 +155,17 @@ func (service *Service) AddRoutes(router *mux.Router) {
 			w.Header().Add("Allow", "GET,POST")
 		}).Methods("OPTIONS")
 
+	router.HandleFunc("/.well-known/openid-configuration", service.OpenIDConfigurationHandler).Methods("GET")
+	router.HandleFunc("/v1/oauth/jwks", service.JWKSHandler).Methods("GET")
+	router.HandleFunc("/v1/oauth/userinfo", service.UserInfoHandler).Methods("GET", "POST")
+	router.HandleFunc("/v1/oauth/userinfo",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Allow", "GET,POST")
+			// Allow cors
+			w.Header().Add("Access-Control-Allow-Origin", "*")
+			w.Header().Add("Access-Control-Allow-Methods", "GET,POST")
+			w.Header().Add("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		}).Methods("OPTIONS")
+
 	InitModels()
 }
@@ -0,0 +1,285 @@
+package oauthservice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/db/organization"
+)
+
+//Token exchange support
+// See https://tools.ietf.org/html/rfc8693
+
+//Token types that can be exchanged, the result of a token exchange is always a jwt
+const (
+	AccessTokenTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	JWTTokenType         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+//Error codes returned by the access_token endpoint for a token exchange
+const (
+	errorInvalidRequest = "invalid_request"
+	errorInvalidScope   = "invalid_scope"
+)
+
+var errUnsupportedTokenType = errors.New("Unsupported token type")
+
+//exchangeToken is a validated token presented in a token exchange, either as subject token or as actor token
+type exchangeToken struct {
+	Username  string
+	GlobalID  string
+	ClientID  string
+	Audiences []string
+	Scopes    []string
+	Expires   int64
+	//Act is the act claim of a jwt that is the result of an earlier token exchange
+	Act interface{}
+}
+
+//subject returns the identity the token is issued for, the user or the organization in case of a client credentials token
+func (et *exchangeToken) subject() string {
+	if et.Username != "" {
+		return et.Username
+	}
+	return et.GlobalID
+}
+
+//isIssuedTo checks if a client may exchange this token
+// This is the client the token is issued to or, for a jwt, one of its audiences
+func (et *exchangeToken) isIssuedTo(clientID string) bool {
+	if et.ClientID == clientID {
+		return true
+	}
+	for _, audience := range et.Audiences {
+		if audience == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+//actClaim creates the act claim identifying the actor, if the subject token was the result of
+// an earlier exchange, the previous actor is nested so the complete delegation chain is visible
+func (et *exchangeToken) actClaim(actor string) map[string]interface{} {
+	act := map[string]interface{}{"sub": actor}
+	if et.Act != nil {
+		act["act"] = et.Act
+	}
+	return act
+}
+
+//getExchangeToken validates a subject or actor token, nil is returned if the token is not valid
+func (service *Service) getExchangeToken(token, tokenType string, mgr *Manager) (et *exchangeToken, err error) {
+	switch tokenType {
+	case AccessTokenTokenType:
+		var at *AccessToken
+		at, err = mgr.GetAccessToken(token)
+		if err != nil || at == nil {
+			return
+		}
+		et = &exchangeToken{
+			Username: at.Username,
+			GlobalID: at.GlobalID,
+			ClientID: at.ClientID,
+			Scopes:   oauth2.SplitScopeString(at.Scope),
+			Expires:  at.ExpirationTime().Unix(),
+		}
+	case JWTTokenType:
+		parsedToken, parseErr := oauth2.ParseJWT(token, service.jwtVerificationKeys)
+		if parseErr != nil {
+			log.Debug("Invalid jwt presented in a token exchange: ", parseErr)
+			return
+		}
+		et = &exchangeToken{Scopes: oauth2.GetScopesFromJWT(parsedToken)}
+		et.Username, _ = parsedToken.Claims["username"].(string)
+		et.GlobalID, _ = parsedToken.Claims["globalid"].(string)
+		et.ClientID, _ = parsedToken.Claims["azp"].(string)
+		et.Audiences = getAudiencesFromClaim(parsedToken.Claims["aud"])
+		if exp, ok := parsedToken.Claims["exp"].(float64); ok {
+			et.Expires = int64(exp)
+		}
+		et.Act = parsedToken.Claims["act"]
+	default:
+		err = errUnsupportedTokenType
+	}
+	return
+}
+
+//getAudiencesFromClaim reads the aud claim of a jwt, a single audience or a list of audiences
+func getAudiencesFromClaim(claim interface{}) (audiences []string) {
+	switch aud := claim.(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, rawAudience := range aud {
+			if audience, ok := rawAudience.(string); ok {
+				audiences = append(audiences, audience)
+			}
+		}
+	}
+	return
+}
+
+//parseAudiences gets the audiences from the audience parameters, the parameter can be repeated
+// and every value can contain multiple comma separated audiences
+func parseAudiences(values []string) (audiences []string) {
+	for _, value := range values {
+		for _, audience := range strings.Split(value, ",") {
+			if audience = strings.TrimSpace(audience); audience != "" {
+				audiences = append(audiences, audience)
+			}
+		}
+	}
+	return
+}
+
+//tokenExchangeHandler handles a token exchange on the access_token endpoint
+// The authenticated client exchanges a subject token for a jwt with an act claim,
+// allowing a service to call another service on behalf of a user
+func (service *Service) tokenExchangeHandler(w http.ResponseWriter, r *http.Request, clientID, secret string, validity time.Duration) {
+	mgr := NewManager(r)
+	client, err := mgr.getClientByCredentials(clientID, secret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if client == nil {
+		log.Info("(client_id - secret) combination not found")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	requestedTokenType := r.FormValue("requested_token_type")
+	subjectTokenString := r.FormValue("subject_token")
+	actorTokenString := r.FormValue("actor_token")
+	if subjectTokenString == "" || (requestedTokenType != "" && requestedTokenType != JWTTokenType) ||
+		(actorTokenString != "" && r.FormValue("actor_token_type") == "") {
+		writeOAuthError(w, errorInvalidRequest)
+		return
+	}
+
+	subjectToken, err := service.getExchangeToken(subjectTokenString, r.FormValue("subject_token_type"), mgr)
+	if err == errUnsupportedTokenType {
+		writeOAuthError(w, errorInvalidRequest)
+		return
+	}
+	if err != nil {
+		log.Error("Error getting the subject token: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if subjectToken == nil || !subjectToken.isIssuedTo(clientID) {
+		log.Debug("Invalid subject token or the subject token is not issued to ", clientID)
+		writeOAuthError(w, errorInvalidGrant)
+		return
+	}
+
+	// Without an actor token, the client itself is the actor
+	actor := clientID
+	if actorTokenString != "" {
+		var actorToken *exchangeToken
+		actorToken, err = service.getExchangeToken(actorTokenString, r.FormValue("actor_token_type"), mgr)
+		if err == errUnsupportedTokenType {
+			writeOAuthError(w, errorInvalidRequest)
+			return
+		}
+		if err != nil {
+			log.Error("Error getting the actor token: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if actorToken == nil || actorToken.ClientID != clientID {
+			log.Debug("Invalid actor token or the actor token is not issued to ", clientID)
+			writeOAuthError(w, errorInvalidGrant)
+			return
+		}
+		actor = actorToken.subject()
+	}
+
+	// The exchanged token can not be refreshed and can only have the scopes of the subject token or less
+	requestedScopes, offlineAccessRequested := stripOfflineAccess(oauth2.SplitScopeString(r.FormValue("scope")))
+	if len(requestedScopes) == 0 {
+		requestedScopes = subjectToken.Scopes
+	}
+	if offlineAccessRequested || !jwtScopesAreAllowed(subjectToken.Scopes, requestedScopes) {
+		writeOAuthError(w, errorInvalidScope)
+		return
+	}
+
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Header["kid"] = service.jwtKeyID
+
+	grantedScopes := requestedScopes
+	if subjectToken.Username != "" {
+		token.Claims["username"] = subjectToken.Username
+		grantedScopes, err = service.filterPossibleScopes(r, subjectToken.Username, requestedScopes, false)
+		if err != nil {
+			log.Error("Error while filtering the possible scopes: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	if subjectToken.GlobalID != "" {
+		token.Claims["globalid"] = subjectToken.GlobalID
+	}
+	scope, err := verifyScopes(strings.Join(grantedScopes, ","), subjectToken.Username, subjectToken.ClientID, organization.NewManager(r))
+	if err != nil {
+		log.Error("Failed to verify token scopes: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	token.Claims["scope"] = strings.Split(scope, ",")
+
+	if audiences := parseAudiences(r.Form["audience"]); len(audiences) > 0 {
+		token.Claims["aud"] = audiences
+	}
+	// The authorization the scopes originate from stays the authorized party, the act claim tells who is acting
+	token.Claims["azp"] = subjectToken.ClientID
+	token.Claims["act"] = subjectToken.actClaim(actor)
+	// Like the other jwts issued for the authorization, the claims template of the organization is applied
+	if err = applyJWTClaimsTemplate(r, token, subjectToken.Username, subjectToken.ClientID); err != nil {
+		log.Error("Failed to apply the jwt claims template: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// The exchanged token never outlives the subject token
+	now := time.Now()
+	expiration := now.Add(validity).Unix()
+	if subjectToken.Expires > 0 && subjectToken.Expires < expiration {
+		expiration = subjectToken.Expires
+	}
+	token.Claims["exp"] = expiration
+	token.Claims["iss"] = issuer
+
+	tokenString, err := token.SignedString(service.jwtSigningKey)
+	if err != nil {
+		log.Error("Failed to sign the exchanged token: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		AccessToken     string `json:"access_token"`
+		IssuedTokenType string `json:"issued_token_type"`
+		TokenType       string `json:"token_type"`
+		ExpiresIn       int64  `json:"expires_in"`
+		Scope           string `json:"scope"`
+	}{
+		AccessToken:     tokenString,
+		IssuedTokenType: JWTTokenType,
+		TokenType:       "bearer",
+		ExpiresIn:       expiration - now.Unix(),
+		Scope:           scope,
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(&response)
+}
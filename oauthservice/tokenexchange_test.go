@@ -0,0 +1,55 @@
+package oauthservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExchangeTokenFromJWT(t *testing.T) {
+	ecdsaKey, _ := jwt.ParseECPrivateKeyFromPEM([]byte(testJWTKey))
+	service := &Service{jwtSigningKey: ecdsaKey, jwtVerificationKeys: oauth2.NewJWTVerificationKeys(&ecdsaKey.PublicKey)}
+
+	token := jwt.New(jwt.SigningMethodES384)
+	token.Claims["username"] = "user1"
+	token.Claims["azp"] = "client1"
+	token.Claims["aud"] = []string{"service1"}
+	token.Claims["scope"] = []string{"user:name"}
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["act"] = map[string]interface{}{"sub": "client1"}
+	tokenString, _ := token.SignedString(ecdsaKey)
+
+	et, err := service.getExchangeToken(tokenString, JWTTokenType, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, et) {
+		assert.Equal(t, "user1", et.subject())
+		assert.Equal(t, []string{"user:name"}, et.Scopes)
+		assert.True(t, et.isIssuedTo("client1"))
+		assert.True(t, et.isIssuedTo("service1"))
+		assert.False(t, et.isIssuedTo("service2"))
+		assert.Equal(t, map[string]interface{}{"sub": "service1", "act": map[string]interface{}{"sub": "client1"}}, et.actClaim("service1"))
+	}
+
+	et, err = service.getExchangeToken(tokenString+"x", JWTTokenType, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, et)
+
+	_, err = service.getExchangeToken(tokenString, "urn:ietf:params:oauth:token-type:saml2", nil)
+	assert.Equal(t, errUnsupportedTokenType, err)
+}
+
+func TestActClaim(t *testing.T) {
+	et := &exchangeToken{GlobalID: "org1", ClientID: "org1"}
+	assert.Equal(t, "org1", et.subject())
+	assert.Equal(t, map[string]interface{}{"sub": "service1"}, et.actClaim("service1"))
+}
+
+func TestParseAudiences(t *testing.T) {
+	assert.Equal(t, []string{"service1", "service2", "service3"}, parseAudiences([]string{"service1, service2", "service3"}))
+	assert.Empty(t, parseAudiences([]string{"", " , "}))
+	assert.Equal(t, []string{"service1"}, getAudiencesFromClaim("service1"))
+	assert.Equal(t, []string{"service1", "service2"}, getAudiencesFromClaim([]interface{}{"service1", "service2"}))
+}
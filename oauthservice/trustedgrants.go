@@ -0,0 +1,257 @@
+package oauthservice
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/recoverycodes"
+	"github.com/itsyouonline/identityserver/credentials/throttle"
+	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/credentials/webauthn"
+	"github.com/itsyouonline/identityserver/db/organization"
+	"github.com/itsyouonline/identityserver/db/user"
+	validationdb "github.com/itsyouonline/identityserver/db/validation"
+	"gopkg.in/mgo.v2"
+)
+
+//Grants for trusted first-party clients that get an access token for a user without sending the user to the authorize page
+// Both grants are disabled by default and need to be enabled on the api key
+// See https://tools.ietf.org/html/rfc6749#section-4.3 and https://tools.ietf.org/html/rfc7523#section-2.1
+
+const errorUnauthorizedClient = "unauthorized_client"
+
+//authenticateTrustedClient checks the client credentials and if the grant type is enabled for the client
+func authenticateTrustedClient(mgr *Manager, clientID, secret, grantType string) (errorCode string, httpStatusCode int) {
+	httpStatusCode = http.StatusOK
+	client, err := mgr.getClientByCredentials(clientID, secret)
+	if err != nil {
+		log.Error("Error getting the oauth client: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if client == nil {
+		log.Info("(client_id - secret) combination not found")
+		errorCode = errorInvalidClient
+		return
+	}
+	if !client.AllowsGrantType(grantType) {
+		log.Info("The ", grantType, " grant is not enabled for ", clientID)
+		errorCode = errorUnauthorizedClient
+	}
+	return
+}
+
+//passwordGrantHandler exchanges the username and password of a user for an access token
+// If the user has an authenticator application configured, the totp_code parameter is required as well.
+// Users that only have second factors this endpoint can not verify (sms, security keys or recovery codes) can not use this grant.
+func (service *Service) passwordGrantHandler(r *http.Request, clientID, secret string, validity time.Duration, mgr *Manager) (at *AccessToken, errorCode string, httpStatusCode int) {
+	errorCode, httpStatusCode = authenticateTrustedClient(mgr, clientID, secret, PasswordGrantType)
+	if errorCode != "" || httpStatusCode != http.StatusOK {
+		return
+	}
+
+	username := strings.ToLower(r.FormValue("username"))
+	userPassword := r.FormValue("password")
+	if username == "" || userPassword == "" {
+		errorCode = errorInvalidRequest
+		return
+	}
+	//The same attempt limits apply as for logging in on the website
+	throttleMgr := throttle.NewManager(r)
+	wait, err := throttleMgr.RetryAfter(username, throttle.ClientIP(r))
+	if err != nil {
+		log.Error("Error checking the failed attempts: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if wait > 0 {
+		httpStatusCode = http.StatusTooManyRequests
+		return
+	}
+	validPassword, err := password.NewManager(r).Validate(username, userPassword)
+	if err != nil {
+		log.Error("Error validating the password: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if !validPassword {
+		log.Debug("Invalid username or password in a password grant")
+		registerFailedPasswordGrant(r, username)
+		errorCode = errorInvalidGrant
+		return
+	}
+
+	totpMgr := totp.NewManager(r)
+	hasTOTP, err := totpMgr.HasTOTP(username)
+	if err != nil {
+		log.Error("Error checking if the user has totp: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if !hasTOTP {
+		var otherSecondFactor bool
+		otherSecondFactor, err = hasOtherSecondFactor(r, username)
+		if err != nil {
+			log.Error("Error checking the second factors of the user: ", err)
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		if otherSecondFactor {
+			log.Debug("The password grant can not verify the second factor of ", username)
+			errorCode = errorInvalidGrant
+			return
+		}
+	} else {
+		var validCode bool
+		validCode, err = totpMgr.Validate(username, r.FormValue("totp_code"))
+		if err != nil {
+			log.Error("Error validating the totp code: ", err)
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		if !validCode {
+			log.Debug("Invalid totp code in a password grant")
+			registerFailedPasswordGrant(r, username)
+			errorCode = errorInvalidGrant
+			return
+		}
+	}
+	if err = throttleMgr.Succeeded(username); err != nil {
+		log.Error("Error clearing the failed attempts: ", err)
+	}
+
+	at, errorCode, httpStatusCode = service.newTrustedUserAccessToken(r, username, clientID, validity)
+	return
+}
+
+//hasOtherSecondFactor checks if the user has a second factor that can not be verified in a password grant
+// Like on the login page, a user with an authenticator application can use a totp code instead of the other methods.
+func hasOtherSecondFactor(r *http.Request, username string) (bool, error) {
+	hasSecurityKeys, err := webauthn.NewManager(r).HasCredentials(username)
+	if err != nil || hasSecurityKeys {
+		return hasSecurityKeys, err
+	}
+	remainingRecoveryCodes, err := recoverycodes.NewManager(r).Remaining(username)
+	if err != nil || remainingRecoveryCodes > 0 {
+		return remainingRecoveryCodes > 0, err
+	}
+	verifiedPhones, err := validationdb.NewManager(r).GetByUsernameValidatedPhonenumbers(username)
+	return len(verifiedPhones) > 0, err
+}
+
+//registerFailedPasswordGrant counts a wrong password or totp code in a password grant
+func registerFailedPasswordGrant(r *http.Request, username string) {
+	exists, err := user.NewManager(r).Exists(username)
+	if err != nil {
+		log.Error("Error checking if the user exists: ", err)
+		return
+	}
+	if _, err = throttle.NewManager(r).Failed(username, throttle.ClientIP(r), exists); err != nil {
+		log.Error("Error registering a failed attempt: ", err)
+	}
+}
+
+//jwtBearerGrantHandler exchanges a jwt the organization signed about one of its users for an access token
+// The jwt is issued by the organization (iss), the subject (sub) is the username
+func (service *Service) jwtBearerGrantHandler(r *http.Request, clientID, secret string, validity time.Duration, mgr *Manager) (at *AccessToken, errorCode string, httpStatusCode int) {
+	errorCode, httpStatusCode = authenticateTrustedClient(mgr, clientID, secret, JWTBearerGrantType)
+	if errorCode != "" || httpStatusCode != http.StatusOK {
+		return
+	}
+	if r.FormValue("assertion") == "" {
+		errorCode = errorInvalidRequest
+		return
+	}
+
+	username, err := service.authenticateUserAssertion(r, clientID, mgr)
+	if err == errInvalidClientAssertion {
+		log.Debug("Invalid assertion in a jwt bearer grant")
+		errorCode = errorInvalidGrant
+		return
+	}
+	if err != nil {
+		log.Error("Error authenticating the assertion: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	at, errorCode, httpStatusCode = service.newTrustedUserAccessToken(r, username, clientID, validity)
+	return
+}
+
+//authenticateUserAssertion verifies the assertion of a jwt bearer grant and returns the user it is issued for
+// Like a client assertion, it needs to be signed by one of the organization's public keys and can only be used once
+func (service *Service) authenticateUserAssertion(r *http.Request, clientID string, mgr *Manager) (username string, err error) {
+	publicKeys, err := organization.NewManager(r).GetPublicKeys(clientID)
+	if err == mgo.ErrNotFound {
+		err = errInvalidClientAssertion
+	}
+	if err != nil {
+		return
+	}
+	token, err := parseClientAssertion(r.FormValue("assertion"), publicKeys)
+	if err != nil {
+		return
+	}
+	jti, expires, err := validateAssertionClaims(token.Claims, clientID, tokenEndpointAudiences(r), time.Now())
+	if err != nil {
+		return
+	}
+
+	//The organization can only get tokens for users that authorized it before
+	subject, _ := token.Claims["sub"].(string)
+	var authorization *user.Authorization
+	if subject != "" {
+		authorization, err = user.NewManager(r).GetAuthorization(subject, clientID)
+		if err != nil {
+			return
+		}
+	}
+	if authorization == nil {
+		log.Debug("The subject of the assertion is not a user that authorized the organization")
+		err = errInvalidClientAssertion
+		return
+	}
+
+	replayed, err := mgr.saveClientAssertion(&usedClientAssertion{ClientID: clientID, JTI: jti, ExpiresAt: expires})
+	if err == nil && replayed {
+		log.Info("Replayed assertion for ", clientID)
+		err = errInvalidClientAssertion
+	}
+	if err == nil {
+		username = subject
+	}
+	return
+}
+
+//newTrustedUserAccessToken creates the access token of a password or jwt bearer grant
+// The user is not asked for authorization, the token only has the requested scopes the user already authorized for the organization.
+// If the user never authorized the organization, the grant is invalid.
+func (service *Service) newTrustedUserAccessToken(r *http.Request, username, clientID string, validity time.Duration) (at *AccessToken, errorCode string, httpStatusCode int) {
+	httpStatusCode = http.StatusOK
+	authorization, err := user.NewManager(r).GetAuthorization(username, clientID)
+	if err != nil {
+		log.Error("Error getting the authorization: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if authorization == nil {
+		log.Debug(username, " did not authorize ", clientID)
+		errorCode = errorInvalidGrant
+		return
+	}
+	requestedScopes, _ := stripOfflineAccess(oauth2.SplitScopeString(r.FormValue("scope")))
+	possibleScopes, err := service.filterPossibleScopes(r, username, requestedScopes, false)
+	if err != nil {
+		log.Error("Error while filtering the possible scopes: ", err)
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	authorizedScopes := authorization.FilterAuthorizedScopes(possibleScopes)
+	at = newAccessToken(username, "", clientID, strings.Join(authorizedScopes, ","), validity)
+	return
+}
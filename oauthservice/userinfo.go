@@ -0,0 +1,84 @@
+package oauthservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/oauth2"
+)
+
+//UserInfoHandler is the handler of the /v1/oauth/userinfo endpoint
+// It returns the standard OpenID Connect claims of the user the access token or JWT is issued for
+// See http://openid.net/specs/openid-connect-core-1_0.html#UserInfo
+func (service *Service) UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var username, clientID, scopestring string
+
+	credential := getUserInfoCredential(r)
+	if credential == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if isJWT(credential) {
+		token, err := oauth2.ParseJWT(credential, service.jwtVerificationKeys)
+		if err != nil {
+			log.Debug(err)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		username, _ = token.Claims["username"].(string)
+		clientID, _ = token.Claims["azp"].(string)
+		scopestring = oauth2.GetScopestringFromJWT(token)
+	} else {
+		at, err := NewManager(r).GetAccessToken(credential)
+		if err != nil {
+			log.Error(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if at == nil || at.IsExpired() {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		username = at.Username
+		clientID = at.ClientID
+		scopestring = at.Scope
+	}
+	//Tokens acquired through the client credentials flow are not issued for a user
+	if username == "" || clientID == "" {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	claims, err := getOpenIDClaims(r, username, clientID, oauth2.SplitScopeString(scopestring))
+	if err != nil {
+		log.Error("Error while getting the userinfo claims: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	claims["sub"] = username
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claims)
+}
+
+//getUserInfoCredential returns the access token or jwt from the authorization header or the access_token query parameter
+// Both the 'bearer' scheme of RFC 6750 and the 'token' scheme are accepted, the scheme is case insensitive
+func getUserInfoCredential(r *http.Request) string {
+	parts := strings.SplitN(strings.TrimSpace(r.Header.Get("Authorization")), " ", 2)
+	if len(parts) == 2 {
+		scheme := strings.ToLower(parts[0])
+		if scheme == "bearer" || scheme == "token" {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+//isJWT checks if a credential is a jwt instead of an opaque access token, a jwt consists of 3 parts separated by dots
+func isJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
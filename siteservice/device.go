@@ -0,0 +1,25 @@
+package siteservice
+
+import (
+	"net/http"
+)
+
+//ShowDeviceForm shows the page where a user enters the code displayed on a device to authorize it
+func (service *Service) ShowDeviceForm(w http.ResponseWriter, r *http.Request) {
+	loggedinuser, err := service.GetLoggedInUser(r, w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	queryvalues := r.URL.Query()
+	if loggedinuser == "" {
+		queryvalues.Set("endpoint", r.URL.EscapedPath())
+		http.Redirect(w, r, "/login?"+queryvalues.Encode(), http.StatusFound)
+		return
+	}
+	redirectURI := "/#/device"
+	if len(queryvalues) > 0 {
+		redirectURI += "?" + queryvalues.Encode()
+	}
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
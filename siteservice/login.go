@@ -22,7 +22,9 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/itsyouonline/identityserver/credentials/oauth2"
 	"github.com/itsyouonline/identityserver/credentials/password"
+	"github.com/itsyouonline/identityserver/credentials/recoverycodes"
 	"github.com/itsyouonline/identityserver/credentials/totp"
+	"github.com/itsyouonline/identityserver/credentials/webauthn"
 	organizationdb "github.com/itsyouonline/identityserver/db/organization"
 	"github.com/itsyouonline/identityserver/db/user"
 	validationdb "github.com/itsyouonline/identityserver/db/validation"
@@ -102,7 +104,6 @@ func (service *Service) ShowLoginForm(w http.ResponseWriter, request *http.Reque
 //ProcessLoginForm logs a user in if the credentials are valid
 func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Request) {
 	//TODO: validate csrf token
-	//TODO: limit the number of failed/concurrent requests
 
 	err := request.ParseForm()
 	if err != nil {
@@ -124,15 +125,26 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 	login := strings.ToLower(values.Login)
 
 	u, err := organization.SearchUser(request, login)
-	if err == mgo.ErrNotFound {
-		w.WriteHeader(422)
-		return
-	} else if err != nil {
+	userexists := err != mgo.ErrNotFound
+	if err != nil && userexists {
 		log.Error("Failed to search for user: ", err)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	userexists := err != mgo.ErrNotFound
+	//Unknown logins are throttled as well so the responses do not reveal which users exist
+	username := login
+	if userexists {
+		username = u.Username
+	}
+	if throttled(w, request, username) {
+		return
+	}
+	if !userexists {
+		password.SimulateValidation(values.Password)
+		registerFailedAttempt(request, username, false)
+		w.WriteHeader(422)
+		return
+	}
 
 	var validpassword bool
 	passwdMgr := password.NewManager(request)
@@ -146,6 +158,7 @@ func (service *Service) ProcessLoginForm(w http.ResponseWriter, request *http.Re
 	// Remove last 2FA entry if an invalid password is entered
 	validcredentials := userexists && validpassword
 	if !validcredentials {
+		registerFailedAttempt(request, u.Username, true)
 		if client != "" {
 			l2faMgr := organizationdb.NewLast2FAManager(request)
 			if l2faMgr.Exists(client, u.Username) {
@@ -218,12 +231,17 @@ func (service *Service) verifyExistingAuthorization(request *http.Request, usern
 		log.Error(err)
 		return false, err
 	}
+	consent, err := service.identityService.GetLatestConsent(request, username, clientID)
+	if err != nil {
+		log.Error(err)
+		return false, err
+	}
 
 	var validAuthorization bool
 
 	if authorizedScopes != nil {
-
-		validAuthorization = oauthservice.IsAuthorizationValid(possibleScopes, authorizedScopes)
+		// An expired consent forces the consent screen, declined scopes do not
+		validAuthorization = oauthservice.IsConsentValid(possibleScopes, authorizedScopes, consent, time.Now())
 		//Check if we are redirected from the authorize page, it might be that not all authorizations were given,
 		// authorize the login but only with the authorized scopes
 		referrer := request.Header.Get("Referer")
@@ -260,8 +278,10 @@ func (service *Service) GetTwoFactorAuthenticationMethods(w http.ResponseWriter,
 	}
 
 	response := struct {
-		Totp bool              `json:"totp"`
-		Sms  map[string]string `json:"sms"`
+		Totp          bool              `json:"totp"`
+		Sms           map[string]string `json:"sms"`
+		Webauthn      bool              `json:"webauthn"`
+		RecoveryCodes bool              `json:"recoverycodes"`
 	}{Sms: make(map[string]string)}
 	totpMgr := totp.NewManager(request)
 	response.Totp, err = totpMgr.HasTOTP(username)
@@ -270,6 +290,19 @@ func (service *Service) GetTwoFactorAuthenticationMethods(w http.ResponseWriter,
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	response.Webauthn, err = webauthn.NewManager(request).HasCredentials(username)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	remainingRecoveryCodes, err := recoverycodes.NewManager(request).Remaining(username)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	response.RecoveryCodes = remainingRecoveryCodes > 0
 	valMgr := validationdb.NewManager(request)
 	verifiedPhones, err := valMgr.GetByUsernameValidatedPhonenumbers(username)
 	if err != nil {
@@ -419,13 +452,17 @@ func (service *Service) ProcessTOTPConfirmation(w http.ResponseWriter, request *
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	if throttled(w, request, username) {
+		return
+	}
 	var validtotpcode bool
 	totpMgr := totp.NewManager(request)
 	if validtotpcode, err = totpMgr.Validate(username, values.Totpcode); err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	if !validtotpcode { //TODO: limit to 3 failed attempts
+	if !validtotpcode {
+		registerFailedAttempt(request, username, true)
 		w.WriteHeader(422)
 		return
 	}
@@ -436,6 +473,50 @@ func (service *Service) ProcessTOTPConfirmation(w http.ResponseWriter, request *
 	service.loginUser(w, request, username)
 }
 
+//ProcessRecoveryCodeConfirmation accepts a one-time recovery code instead of a totp or sms code
+// A user that lost access to their second factor can log in this way and set up a new one
+func (service *Service) ProcessRecoveryCodeConfirmation(w http.ResponseWriter, request *http.Request) {
+	username, err := service.getUserLoggingIn(request)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		sessions.Save(request, w)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	values := struct {
+		Recoverycode string `json:"recoverycode"`
+	}{}
+
+	if err := json.NewDecoder(request.Body).Decode(&values); err != nil {
+		log.Debug("Error decoding the recovery code confirmation request:", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if throttled(w, request, username) {
+		return
+	}
+	validrecoverycode, err := recoverycodes.NewManager(request).Use(username, values.Recoverycode)
+	if err != nil {
+		log.Error("Error checking the recovery code: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !validrecoverycode {
+		registerFailedAttempt(request, username, true)
+		w.WriteHeader(422)
+		return
+	}
+	log.Debug("User ", username, " logged in with a recovery code")
+
+	//add last 2fa date if logging in with oauth2
+	service.storeLast2FALogin(request, username)
+
+	service.loginUser(w, request, username)
+}
+
 func (service *Service) getLoginSessionInformation(request *http.Request, sessionKey string) (sessionInfo *loginSessionInformation, err error) {
 
 	if sessionKey == "" {
@@ -631,6 +712,9 @@ func (service *Service) Process2FASMSConfirmation(w http.ResponseWriter, request
 		return
 	}
 
+	if throttled(w, request, username) {
+		return
+	}
 	sessionInfo, err := service.getLoginSessionInformation(request, "")
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -641,7 +725,7 @@ func (service *Service) Process2FASMSConfirmation(w http.ResponseWriter, request
 		validsmscode := (values.Smscode == sessionInfo.SMSCode)
 
 		if !validsmscode {
-			// TODO: limit to 3 failed attempts
+			registerFailedAttempt(request, username, true)
 			w.WriteHeader(422)
 			log.Debugf("Expected code %s, got %s", sessionInfo.SMSCode, values.Smscode)
 			return
@@ -657,7 +741,7 @@ func (service *Service) Process2FASMSConfirmation(w http.ResponseWriter, request
 	err = service.phonenumberValidationService.ConfirmValidation(request, validationkey, values.Smscode)
 	if err == validation.ErrInvalidCode {
 		log.Debug("Invalid code")
-		// TODO: limit to 3 failed attempts
+		registerFailedAttempt(request, username, true)
 		w.WriteHeader(422)
 		log.Debug("invalid code")
 		return
@@ -705,6 +789,7 @@ func (service *Service) loginOauthUser(w http.ResponseWriter, request *http.Requ
 }
 
 func (service *Service) login(w http.ResponseWriter, request *http.Request, username string) {
+	registerSuccessfulLogin(request, username)
 
 	redirectURL := "/"
 	queryValues := request.URL.Query()
@@ -903,6 +988,9 @@ func (service *Service) ForgotPassword(w http.ResponseWriter, request *http.Requ
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	if throttled(w, request, "") {
+		return
+	}
 	userMgr := user.NewManager(request)
 	valMgr := validationdb.NewManager(request)
 	validatedemail, err := valMgr.GetByEmailAddressValidatedEmailAddress(values.Login)
@@ -915,16 +1003,19 @@ func (service *Service) ForgotPassword(w http.ResponseWriter, request *http.Requ
 		username = validatedemail.Username
 		emails = []string{validatedemail.EmailAddress}
 	} else {
+		//The response is the same if the user does not exist or has no validated email address,
+		// so it can not be used to find out which users exist
 		usr, err := userMgr.GetByName(values.Login)
 		if err != nil && err != mgo.ErrNotFound || usr.Username == "" {
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			registerFailedAttempt(request, "", false)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
 		username = usr.Username
 		validatedemails, err := valMgr.GetByUsernameValidatedEmailAddress(username)
 		if validatedemails == nil || len(validatedemails) == 0 {
-			http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		if err != nil {
@@ -958,14 +1049,33 @@ func (service *Service) ResetPassword(w http.ResponseWriter, request *http.Reque
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	if throttled(w, request, "") {
+		return
+	}
 	pwdMngr := password.NewManager(request)
 	token, err := pwdMngr.FindResetToken(values.Token)
 	if err != nil {
 		log.Debug("Failed to find password reset token - ", err)
+		registerFailedAttempt(request, "", false)
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
-	err = pwdMngr.Save(token.Username, values.Password)
+	userobj, err := user.NewManager(request).GetByName(token.Username)
+	if err != nil {
+		log.Error("Failed to load the user of the password reset token - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	emails := []string{}
+	for _, email := range userobj.EmailAddresses {
+		emails = append(emails, email.EmailAddress)
+	}
+	err = pwdMngr.Save(token.Username, values.Password, emails)
+	if password.IsPolicyError(err) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		writePasswordErrorResponse(w, err)
+		return
+	}
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -975,6 +1085,8 @@ func (service *Service) ResetPassword(w http.ResponseWriter, request *http.Reque
 		return
 
 	}
+	//The owner proved access to their email address, a lockout should not keep them out with the new password
+	registerSuccessfulLogin(request, token.Username)
 	w.WriteHeader(http.StatusNoContent)
 	return
 }
@@ -586,12 +586,12 @@ func (service *Service) ValidateInfo(w http.ResponseWriter, r *http.Request) {
 	if validatingPassword != data.Password || validatingUsername != username {
 		log.Debug("Saving user password")
 		passwdMgr := password.NewManager(r)
-		err = passwdMgr.Save(username, data.Password)
+		err = passwdMgr.Save(username, data.Password, []string{data.Email})
 		if err != nil {
 			log.Error("Error while saving the users password: ", err)
 			if err.Error() != "internal_error" {
 				w.WriteHeader(http.StatusUnprocessableEntity)
-				writeErrorResponse(w, "invalid_password")
+				writePasswordErrorResponse(w, err)
 			} else {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
@@ -773,3 +773,17 @@ func writeErrorResponse(w http.ResponseWriter, err string) {
 	}
 	json.NewEncoder(w).Encode(&response)
 }
+
+//writePasswordErrorResponse writes the invalid_password error, with the violations if the password policy is not met
+func writePasswordErrorResponse(w http.ResponseWriter, err error) {
+	response := struct {
+		Error      string                     `json:"error"`
+		Violations []password.PolicyViolation `json:"violations,omitempty"`
+	}{
+		Error: "invalid_password",
+	}
+	if policyErr, ok := err.(*password.PolicyError); ok {
+		response.Violations = policyErr.Violations
+	}
+	json.NewEncoder(w).Encode(&response)
+}
@@ -34,6 +34,8 @@ type Service struct {
 	version                       string
 	testEnv                       bool
 	identityService               *identityservice.Service
+	//decoySecret derives the credential ids returned for logins without passwordless credentials
+	decoySecret []byte
 }
 
 //NewService creates and initializes a Service
@@ -53,6 +55,7 @@ func NewService(cookieSecret string, smsService communication.SMSService, emailS
 	service.testEnv = testEnv
 
 	service.initializeSessions(cookieSecret)
+	service.decoySecret = []byte(cookieSecret)
 	return
 }
 
@@ -86,8 +89,13 @@ func (service *Service) AddRoutes(router *mux.Router) {
 	router.Methods("POST").Path("/login").HandlerFunc(service.ProcessLoginForm)
 	router.Methods("GET").Path("/login/twofamethods").HandlerFunc(service.GetTwoFactorAuthenticationMethods)
 	router.Methods("POST").Path("/login/totpconfirmation").HandlerFunc(service.ProcessTOTPConfirmation)
+	router.Methods("POST").Path("/login/recoverycodeconfirmation").HandlerFunc(service.ProcessRecoveryCodeConfirmation)
 	router.Methods("POST").Path("/login/smscode/{phoneLabel}").HandlerFunc(service.GetSmsCode)
 	router.Methods("POST").Path("/login/smsconfirmation").HandlerFunc(service.Process2FASMSConfirmation)
+	router.Methods("POST").Path("/login/webauthn/options").HandlerFunc(service.GetWebAuthnLoginOptions)
+	router.Methods("POST").Path("/login/webauthnconfirmation").HandlerFunc(service.ProcessWebAuthnConfirmation)
+	router.Methods("POST").Path("/login/passwordless/options").HandlerFunc(service.GetPasswordlessLoginOptions)
+	router.Methods("POST").Path("/login/passwordless").HandlerFunc(service.ProcessPasswordlessLogin)
 	router.Methods("POST").Path("/login/resendsms").HandlerFunc(service.LoginResendPhonenumberConfirmation)
 	router.Methods("GET").Path("/sc").HandlerFunc(service.MobileSMSConfirmation)
 	router.Methods("GET").Path("/login/smsconfirmed").HandlerFunc(service.Check2FASMSConfirmation)
@@ -97,6 +105,7 @@ func (service *Service) AddRoutes(router *mux.Router) {
 	router.Methods("GET").Path("/login/organizationinvitation/{code}").HandlerFunc(service.GetOrganizationInvitation)
 	//Authorize form
 	router.Methods("GET").Path("/authorize").HandlerFunc(service.ShowAuthorizeForm)
+	router.Methods("GET").Path("/device").HandlerFunc(service.ShowDeviceForm)
 	//Facebook callback
 	router.Methods("GET").Path("/facebook_callback").HandlerFunc(service.FacebookCallback)
 	//Github callback
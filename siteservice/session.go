@@ -60,6 +60,7 @@ func (service *Service) SetLoggedInUser(w http.ResponseWriter, request *http.Req
 		return
 	}
 	authenticatedSession.Values["username"] = username
+	authenticatedSession.Values["authtime"] = time.Now().Unix()
 
 	//TODO: rework this, is not really secure I think
 	// Set user cookie after successful login
@@ -93,6 +94,7 @@ func (service *Service) SetLoggedInOauthUser(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	oauthSession.Values["username"] = username
+	oauthSession.Values["authtime"] = time.Now().Unix()
 
 	// No need to set a user cookie since we don't pass through the UI
 
@@ -160,6 +162,26 @@ func (service *Service) GetOauthUser(r *http.Request, w http.ResponseWriter) (us
 	return
 }
 
+//GetAuthTime returns the time the user in the interactive or oauth session authenticated, or the zero time if unknown
+func (service *Service) GetAuthTime(request *http.Request, w http.ResponseWriter) (authTime time.Time, err error) {
+	session, err := service.GetSession(request, SessionInteractive, "authenticatedsession")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if username, _ := session.Values["username"].(string); username == "" {
+		session, err = service.GetSession(request, SessionOauth, "oauthsession")
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	if timestamp, ok := session.Values["authtime"].(int64); ok {
+		authTime = time.Unix(timestamp, 0)
+	}
+	return
+}
+
 //SetWebUserMiddleWare puthe the authenticated user on the context
 func (service *Service) SetWebUserMiddleWare(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
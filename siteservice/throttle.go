@@ -0,0 +1,47 @@
+package siteservice
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/itsyouonline/identityserver/credentials/throttle"
+)
+
+//throttled refuses the request with a 429 status if the user or the client made too many failed attempts
+// The response is the same for existing and unknown users
+func throttled(w http.ResponseWriter, request *http.Request, username string) bool {
+	wait, err := throttle.NewManager(request).RetryAfter(username, throttle.ClientIP(request))
+	if err != nil {
+		log.Error("Error checking the failed attempts: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return true
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return true
+	}
+	return false
+}
+
+//registerFailedAttempt counts a wrong password or code
+// If the attempt locks an existing account, the lockout is stored so the owner can see it
+func registerFailedAttempt(request *http.Request, username string, existingUser bool) {
+	ip := throttle.ClientIP(request)
+	lockout, err := throttle.NewManager(request).Failed(username, ip, existingUser)
+	if err != nil {
+		log.Error("Error registering a failed attempt: ", err)
+		return
+	}
+	if lockout && existingUser {
+		log.Warnf("Account '%s' is locked after too many failed attempts, the last one from %s", username, ip)
+	}
+}
+
+//registerSuccessfulLogin forgets the failed attempts for a user once the login is complete
+func registerSuccessfulLogin(request *http.Request, username string) {
+	if err := throttle.NewManager(request).Succeeded(username); err != nil {
+		log.Error("Error clearing the failed attempts: ", err)
+	}
+}
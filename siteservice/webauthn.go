@@ -0,0 +1,262 @@
+package siteservice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/sessions"
+	"github.com/itsyouonline/identityserver/credentials/webauthn"
+	"github.com/itsyouonline/identityserver/identityservice/organization"
+	"gopkg.in/mgo.v2"
+)
+
+//webAuthnAssertion is the response of navigator.credentials.get, the binary values are base64url encoded
+type webAuthnAssertion struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"clientdatajson"`
+	AuthenticatorData string `json:"authenticatordata"`
+	Signature         string `json:"signature"`
+}
+
+//GetWebAuthnLoginOptions returns the options to use a security key as second factor for the user logging in
+func (service *Service) GetWebAuthnLoginOptions(w http.ResponseWriter, request *http.Request) {
+	username, err := service.getUserLoggingIn(request)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		sessions.Save(request, w)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	credentials, err := webauthn.NewManager(request).GetCredentials(username)
+	if err != nil {
+		log.Error("Error getting the webauthn credentials: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	service.writeWebAuthnRequestOptions(w, request, username, webauthn.CeremonyLogin, credentials, webauthn.UserVerificationDiscouraged)
+}
+
+//ProcessWebAuthnConfirmation checks the security key assertion of the user logging in
+func (service *Service) ProcessWebAuthnConfirmation(w http.ResponseWriter, request *http.Request) {
+	username, err := service.getUserLoggingIn(request)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		sessions.Save(request, w)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	var values webAuthnAssertion
+	if err = json.NewDecoder(request.Body).Decode(&values); err != nil {
+		log.Debug("Error decoding the webauthn confirmation request: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	valid, err := verifyWebAuthnAssertion(request, username, webauthn.CeremonyLogin, &values)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		w.WriteHeader(422)
+		return
+	}
+
+	//add last 2fa date if logging in with oauth2
+	service.storeLast2FALogin(request, username)
+
+	service.loginUser(w, request, username)
+}
+
+//GetPasswordlessLoginOptions returns the options to log in with a platform authenticator instead of a password and second factor
+// Unknown logins and users without passwordless credentials get options with a decoy credential,
+// so the response does not reveal which users exist or have a passwordless credential
+func (service *Service) GetPasswordlessLoginOptions(w http.ResponseWriter, request *http.Request) {
+	values := struct {
+		Login string `json:"login"`
+	}{}
+	if err := json.NewDecoder(request.Body).Decode(&values); err != nil {
+		log.Debug("Error decoding the passwordless login request: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	login := strings.ToLower(values.Login)
+	u, err := organization.SearchUser(request, login)
+	userexists := err != mgo.ErrNotFound
+	if err != nil && userexists {
+		log.Error("Failed to search for user: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	username := login
+	if userexists {
+		username = u.Username
+	}
+	if throttled(w, request, username) {
+		return
+	}
+	var credentials []webauthn.Credential
+	if userexists {
+		credentials, err = webauthn.NewManager(request).GetPasswordlessCredentials(u.Username)
+		if err != nil {
+			log.Error("Error getting the webauthn credentials: ", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(credentials) == 0 {
+		credentials = service.decoyCredentials(login)
+	}
+	service.writeWebAuthnRequestOptions(w, request, username, webauthn.CeremonyPasswordlessLogin, credentials, webauthn.UserVerificationRequired)
+}
+
+//decoyCredentials returns a credential that does not exist, the id is derived from the login
+// so repeated requests for the same login return the same id, like they do for a real credential
+func (service *Service) decoyCredentials(login string) []webauthn.Credential {
+	mac := hmac.New(sha256.New, service.decoySecret)
+	mac.Write([]byte("passwordless:" + login))
+	return []webauthn.Credential{{ID: base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}}
+}
+
+//ProcessPasswordlessLogin logs a user in with a platform authenticator that verified the user
+// This replaces both the password and the second factor
+func (service *Service) ProcessPasswordlessLogin(w http.ResponseWriter, request *http.Request) {
+	values := struct {
+		Login string `json:"login"`
+		webAuthnAssertion
+	}{}
+	if err := json.NewDecoder(request.Body).Decode(&values); err != nil {
+		log.Debug("Error decoding the passwordless login request: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	login := strings.ToLower(values.Login)
+	u, err := organization.SearchUser(request, login)
+	userexists := err != mgo.ErrNotFound
+	if err != nil && userexists {
+		log.Error("Failed to search for user: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	username := login
+	if userexists {
+		username = u.Username
+	}
+	if throttled(w, request, username) {
+		return
+	}
+	if !userexists {
+		registerFailedAttempt(request, username, false)
+		w.WriteHeader(422)
+		return
+	}
+	valid, err := verifyWebAuthnAssertion(request, u.Username, webauthn.CeremonyPasswordlessLogin, &values.webAuthnAssertion)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		registerFailedAttempt(request, u.Username, true)
+		w.WriteHeader(422)
+		return
+	}
+	loginSession, err := service.GetSession(request, SessionLogin, "loginsession")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	loginSession.Values["username"] = u.Username
+
+	//add last 2fa date if logging in with oauth2
+	service.storeLast2FALogin(request, u.Username)
+
+	service.loginUser(w, request, u.Username)
+}
+
+//writeWebAuthnRequestOptions stores a new challenge for the user and writes the options for navigator.credentials.get
+func (service *Service) writeWebAuthnRequestOptions(w http.ResponseWriter, request *http.Request, username, ceremony string, credentials []webauthn.Credential, userVerification string) {
+	if len(credentials) == 0 {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		log.Error("Error generating a webauthn challenge: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	err = webauthn.NewManager(request).SaveChallenge(&webauthn.Challenge{
+		Username:  username,
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Error("Error saving a webauthn challenge: ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	options := webauthn.NewRequestOptions(webauthn.GetRelyingParty(), challenge, credentials, userVerification)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+//verifyWebAuthnAssertion checks an assertion against an outstanding challenge and a credential of the user
+// The user needs to be verified by the authenticator for a passwordless login
+func verifyWebAuthnAssertion(request *http.Request, username, ceremony string, assertion *webAuthnAssertion) (valid bool, err error) {
+	clientDataJSON, e1 := webauthn.DecodeBase64URL(assertion.ClientDataJSON)
+	authenticatorData, e2 := webauthn.DecodeBase64URL(assertion.AuthenticatorData)
+	signature, e3 := webauthn.DecodeBase64URL(assertion.Signature)
+	if e1 != nil || e2 != nil || e3 != nil {
+		log.Debug("Invalid base64url encoding in a webauthn assertion")
+		return
+	}
+	challenge, e := webauthn.ChallengeFromClientData(clientDataJSON)
+	if e != nil {
+		log.Debug("Invalid client data in a webauthn assertion")
+		return
+	}
+	mgr := webauthn.NewManager(request)
+	outstanding, err := mgr.ConsumeChallenge(username, challenge, ceremony)
+	if err != nil {
+		log.Error("Error getting the webauthn challenge: ", err)
+		return
+	}
+	if outstanding == nil {
+		log.Debug("Unknown or expired webauthn challenge")
+		return
+	}
+	credential, err := mgr.GetCredential(username, assertion.ID)
+	if err != nil {
+		log.Error("Error getting the webauthn credential: ", err)
+		return
+	}
+	passwordless := ceremony == webauthn.CeremonyPasswordlessLogin
+	if credential == nil || (passwordless && !credential.Passwordless) {
+		log.Debug("Unknown webauthn credential")
+		return
+	}
+	signCount, e := webauthn.VerifyAssertion(webauthn.GetRelyingParty(), challenge, credential, clientDataJSON, authenticatorData, signature, passwordless)
+	if e != nil {
+		log.Debug("Invalid webauthn assertion: ", e)
+		return
+	}
+	if err = mgr.UpdateSignCount(username, credential.ID, signCount); err != nil {
+		log.Error("Error updating the webauthn signature counter: ", err)
+		return
+	}
+	valid = true
+	return
+}
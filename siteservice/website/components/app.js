@@ -29,6 +29,16 @@
                 showFooter: false
             }
         })
+        .state('device', {
+            url: '/device',
+            templateUrl: 'components/user/views/device.html',
+            controller: 'DeviceController',
+            controllerAs: 'vm',
+            params: {
+                pageTitle: 'Connect a device',
+                showFooter: false
+            }
+        })
         .state('/company/new', {
             url: '/company/new',
             templateUrl: 'components/company/views/new.html',
@@ -18,20 +18,15 @@
                     vm.emailSend = true;
                 },
                 function (response) {
-                    switch (response.status) {
-                        case 404:
-                            $scope.form.login.$setValidity("invalid", false);
-                            break;
-                        case 412:
-                            $scope.form.login.$setValidity("no_validated_email", false);
-                            break;
+                    if (response.status === 429) {
+                        $scope.form.login.$setValidity("too_many_attempts", false);
                     }
                 }
             );
         }
 
         function clearValidation() {
-            $scope.form.login.$setValidity("invalid", true);
+            $scope.form.login.$setValidity("too_many_attempts", true);
         }
     }
 })();
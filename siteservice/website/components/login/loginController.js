@@ -2,12 +2,14 @@
     'use strict';
     angular.module('loginApp')
         .controller('loginController', ['$http', '$window', '$scope', '$rootScope', '$interval', '$mdMedia',
-            'LoginService', loginController]);
+            'LoginService', 'WebAuthnService', loginController]);
 
-    function loginController($http, $window, $scope, $rootScope, $interval, $mdMedia, LoginService) {
+    function loginController($http, $window, $scope, $rootScope, $interval, $mdMedia, LoginService, WebAuthnService) {
         var vm = this;
         var urlParams = URI($window.location.href).search(true);
         vm.submit = submit;
+        vm.submitPasswordless = submitPasswordless;
+        vm.passwordlessSupported = WebAuthnService.isSupported();
         vm.clearValidation = clearValidation;
         vm.validateUsername = validateUsername;
         vm.resetValidation = resetValidation;
@@ -99,13 +101,41 @@
                     vm.loading = false;
                     if (response.status === 422) {
                         $scope.loginform.password.$setValidity("invalidcredentials", false);
+                    } else if (response.status === 429) {
+                        $scope.loginform.password.$setValidity("toomanyattempts", false);
                     }
                 }
             );
         }
 
+        // Log in with a security key that verifies the user, like a fingerprint reader, instead of a password and second factor
+        function submitPasswordless() {
+            if (!vm.login) {
+                $scope.loginform.username.$setTouched();
+                return;
+            }
+            vm.loading = true;
+            var login = vm.login.toLowerCase();
+            LoginService.getPasswordlessOptions(login)
+                .then(WebAuthnService.getAssertion)
+                .then(function (assertion) {
+                    return LoginService.submitPasswordlessLogin(login, assertion, $window.location.search);
+                })
+                .then(
+                    function (data) {
+                        $window.location.href = data.redirecturl;
+                    },
+                    function () {
+                        vm.loading = false;
+                        $scope.loginform.username.$setValidity("passwordlessfailed", false);
+                    }
+                );
+        }
+
         function clearValidation() {
             $scope.loginform.password.$setValidity("invalidcredentials", true);
+            $scope.loginform.password.$setValidity("toomanyattempts", true);
+            $scope.loginform.username.$setValidity("passwordlessfailed", true);
         }
 
         function validateUsername(username) {
@@ -16,6 +16,11 @@
             sendSmsCode: sendSmsCode,
             submitTotpCode: submitTotpCode,
             submitSmsCode: submitSmsCode,
+            submitRecoveryCode: submitRecoveryCode,
+            getWebAuthnOptions: getWebAuthnOptions,
+            submitWebAuthnAssertion: submitWebAuthnAssertion,
+            getPasswordlessOptions: getPasswordlessOptions,
+            submitPasswordlessLogin: submitPasswordlessLogin,
             checkSmsConfirmation: checkSmsConfirmation,
             getLogo: getLogo,
             getDescription: getDescription
@@ -75,6 +80,38 @@
             return genericHttpCall($http.post, url, data);
         }
 
+        function submitRecoveryCode(code, queryString) {
+            var url = apiURL + '/recoverycodeconfirmation' + queryString;
+            var data = {
+                recoverycode: code
+            };
+            return genericHttpCall($http.post, url, data);
+        }
+
+        function getWebAuthnOptions() {
+            var url = apiURL + '/webauthn/options';
+            return genericHttpCall($http.post, url, {});
+        }
+
+        function submitWebAuthnAssertion(assertion, queryString) {
+            var url = apiURL + '/webauthnconfirmation' + queryString;
+            return genericHttpCall($http.post, url, assertion);
+        }
+
+        function getPasswordlessOptions(login) {
+            var url = apiURL + '/passwordless/options';
+            var data = {
+                login: login
+            };
+            return genericHttpCall($http.post, url, data);
+        }
+
+        function submitPasswordlessLogin(login, assertion, queryString) {
+            var url = apiURL + '/passwordless' + queryString;
+            var data = angular.extend({login: login}, assertion);
+            return genericHttpCall($http.post, url, data);
+        }
+
         function checkSmsConfirmation() {
             var url = apiURL + '/smsconfirmed';
             return genericHttpCall($http.get, url);
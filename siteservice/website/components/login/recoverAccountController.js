@@ -1,11 +1,13 @@
 (function () {
     'use strict';
     angular.module('loginApp')
-        .controller('resetPasswordController', ['$http', '$window', '$routeParams', '$mdDialog', resetPasswordController]);
+        .controller('resetPasswordController', ['$scope', '$http', '$window', '$routeParams', '$mdDialog', 'PasswordPolicyService',
+            resetPasswordController]);
 
-    function resetPasswordController($http, $window, $routeParams, $mdDialog) {
+    function resetPasswordController($scope, $http, $window, $routeParams, $mdDialog, PasswordPolicyService) {
         var vm = this;
         vm.submit = submit;
+        vm.resetValidation = resetValidation;
         var code = $routeParams.code;
 
         function submit() {
@@ -25,11 +27,21 @@
                                 var msg = 'The password reset token was already used or was not found.';
                                 showErrorMessage(msg);
                                 break;
+                            case 422:
+                                vm.passwordPolicy = PasswordPolicyService.showViolations($scope.form.password, response.data.violations);
+                                break;
+                            case 429:
+                                showErrorMessage('Too many failed attempts, please try again later.');
+                                break;
                         }
                     }
                 );
         }
 
+        function resetValidation() {
+            PasswordPolicyService.resetValidation($scope.form.password);
+        }
+
         function showErrorMessage(msg) {
             $mdDialog.show($mdDialog.alert()
                 .clickOutsideToClose(true)
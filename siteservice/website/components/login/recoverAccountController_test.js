@@ -2,9 +2,12 @@ describe('Reset Password Controller test', function () {
 
     beforeEach(module('loginApp'));
 
-    beforeEach(inject(function ($injector, $controller) {
-        resetPasswordController = $controller('resetPasswordController', {
+    var scope;
 
+    beforeEach(inject(function ($injector, $rootScope, $controller) {
+        scope = $rootScope.$new();
+        resetPasswordController = $controller('resetPasswordController', {
+            $scope: scope
         });
     }));
 
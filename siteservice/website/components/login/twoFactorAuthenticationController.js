@@ -2,22 +2,28 @@
     'use strict';
     angular.module('loginApp')
         .controller('twoFactorAuthenticationController', ['$scope', '$window', '$interval', '$translate', 'LoginService',
-            twoFactorAuthenticationController]);
+            'WebAuthnService', twoFactorAuthenticationController]);
 
-    function twoFactorAuthenticationController($scope, $window, $interval, $translate, LoginService) {
+    function twoFactorAuthenticationController($scope, $window, $interval, $translate, LoginService, WebAuthnService) {
         var STEP_CHOICE = 'choice',
-            STEP_CODE = 'code';
+            STEP_CODE = 'code',
+            STEP_WEBAUTHN = 'webauthn';
         var vm = this;
         vm.resetValidation = resetValidation;
         vm.shouldShowSendButton = shouldShowSendButton;
         vm.sendSmsCode = sendSmsCode;
         vm.login = login;
+        vm.loginWithSecurityKey = loginWithSecurityKey;
         vm.getHelpText = getHelpText;
         vm.nextStep = nextStep;
         vm.selectedTwoFaMethod = null;
         vm.hasMoreThanOneTwoFaMethod = false;
         vm.smshelp = '';
         vm.totphelp = '';
+        vm.webauthnhelp = '';
+        vm.recoverycodehelp = '';
+        vm.codeLength = 6;
+        vm.webauthnFailed = false;
         var steps = [STEP_CHOICE, STEP_CODE];
         vm.step = steps[0];
         var interval;
@@ -33,11 +39,18 @@
                     if (data['totp']) {
                         vm.possibleTwoFaMethods['totp'] = 'Authenticator application';
                     }
+                    if (data['webauthn'] && WebAuthnService.isSupported()) {
+                        vm.possibleTwoFaMethods['webauthn'] = 'Security key';
+                    }
                     if (data['sms'] && Object.keys(data['sms']).length) {
                         angular.forEach(data['sms'], function (sms, label) {
                             vm.possibleTwoFaMethods['sms-' + label] = 'SMS - ' + sms + ' (' + label + ')';
                         });
                     }
+                    // Recovery codes come last so they are never preselected
+                    if (data['recoverycodes']) {
+                        vm.possibleTwoFaMethods['recoverycode'] = 'Recovery code';
+                    }
                     var methods = Object.keys(vm.possibleTwoFaMethods);
                     if (!methods.length) {
                         // Redirect to resend sms page
@@ -58,14 +71,23 @@
                     }
                 });
             // translations have to be preloaded, because loading them in the getHelpText method currently causes a digest loop issue and angular will go haywire
-            $translate(['login.2facontroller.sms', 'login.2facontroller.totp']).then(function(translations){
+            $translate(['login.2facontroller.sms', 'login.2facontroller.totp', 'login.2facontroller.webauthn', 'login.2facontroller.recoverycode']).then(function(translations){
                 vm.smshelp = translations['login.2facontroller.sms'];
                 vm.totphelp = translations['login.2facontroller.totp'];
+                vm.webauthnhelp = translations['login.2facontroller.webauthn'];
+                vm.recoverycodehelp = translations['login.2facontroller.recoverycode'];
             })
         }
 
         function nextStep() {
+            if (vm.selectedTwoFaMethod === 'webauthn') {
+                vm.step = STEP_WEBAUTHN;
+                loginWithSecurityKey();
+                return;
+            }
             vm.step = steps[steps.indexOf(vm.step) + 1];
+            // Recovery codes are formatted as xxxxx-xxxxx
+            vm.codeLength = vm.selectedTwoFaMethod === 'recoverycode' ? 11 : 6;
             if (vm.step === STEP_CODE && vm.selectedTwoFaMethod.indexOf('sms-') === 0) {
                 sendSmsCode();
             }
@@ -80,6 +102,12 @@
                 if (vm.selectedTwoFaMethod === 'totp') {
                     text = vm.totphelp
                 }
+                if (vm.selectedTwoFaMethod === 'recoverycode') {
+                    text = vm.recoverycodehelp;
+                }
+            }
+            if (vm.step === STEP_WEBAUTHN) {
+                text = vm.webauthnhelp;
             }
             return text;
         }
@@ -90,6 +118,7 @@
 
         function resetValidation() {
             $scope.twoFaForm.code.$setValidity("invalid_code", true);
+            $scope.twoFaForm.code.$setValidity("too_many_attempts", true);
         }
 
         function sendSmsCode() {
@@ -111,12 +140,16 @@
                 method = LoginService.submitTotpCode;
             } else if (vm.selectedTwoFaMethod.indexOf('sms-') === 0) {
                 method = LoginService.submitSmsCode;
+            } else if (vm.selectedTwoFaMethod === 'recoverycode') {
+                method = LoginService.submitRecoveryCode;
             }
             method(vm.code, queryString)
                 .then(
                     function (data) {
                         vm.loading = false;
-                        localStorage.setItem('itsyouonline.last2falabel', vm.selectedTwoFaMethod);
+                        if (vm.selectedTwoFaMethod !== 'recoverycode') {
+                            localStorage.setItem('itsyouonline.last2falabel', vm.selectedTwoFaMethod);
+                        }
                         if (interval) {
                             $interval.cancel(interval);
                         }
@@ -127,11 +160,34 @@
                             case 422:
                                 $scope.twoFaForm.code.$setValidity("invalid_code", false);
                                 break;
+                            case 429:
+                                $scope.twoFaForm.code.$setValidity("too_many_attempts", false);
+                                break;
                         }
                         vm.loading = false;
                     });
         }
           
+        function loginWithSecurityKey() {
+            vm.loading = true;
+            vm.webauthnFailed = false;
+            LoginService.getWebAuthnOptions()
+                .then(WebAuthnService.getAssertion)
+                .then(function (assertion) {
+                    return LoginService.submitWebAuthnAssertion(assertion, queryString);
+                })
+                .then(
+                    function (data) {
+                        localStorage.setItem('itsyouonline.last2falabel', vm.selectedTwoFaMethod);
+                        goToPage(data.redirecturl);
+                    },
+                    function () {
+                        // The user cancelled, the key timed out or the assertion was rejected
+                        vm.webauthnFailed = true;
+                        vm.loading = false;
+                    });
+        }
+
         function checkSmsConfirmation() {
             LoginService.checkSmsConfirmation()
                 .then(function (data) {
@@ -672,13 +672,14 @@
     function APIKeyDialogController($scope, $mdDialog, $translate, organization, OrganizationService, label) {
         //If there is a key, it is already saved, if not, this means that a new secret is being created.
 
-        $scope.apikey = {secret: ''};
+        $scope.apikey = {secret: '', additionalCallbackURLs: []};
 
         if (label) {
             $translate(['organization.controller.loadingkey']).then(function(translations){
                 $scope.secret = translations['organization.controller.loadingkey'];
                 OrganizationService.getAPIKey(organization, label).then(
                     function(data){
+                        data.additionalCallbackURLs = data.additionalCallbackURLs || [];
                         $scope.apikey = data;
                     }
                 );
@@ -695,6 +696,8 @@
         $scope.create = create;
         $scope.update = update;
         $scope.deleteAPIKey = deleteAPIKey;
+        $scope.startSecretRotation = startSecretRotation;
+        $scope.finishSecretRotation = finishSecretRotation;
 
         $scope.modified = false;
 
@@ -714,6 +717,7 @@
             OrganizationService.createAPIKey(organization, apiKey).then(
                 function(data){
                     $scope.modified = true;
+                    data.additionalCallbackURLs = data.additionalCallbackURLs || [];
                     $scope.apikey = data;
                     $scope.savedLabel = data.label;
                 },
@@ -749,6 +753,25 @@
             );
         }
 
+        function startSecretRotation(label){
+            OrganizationService.startAPIKeySecretRotation(organization, label).then(
+                function (data) {
+                    $scope.apikey.secret = data.secret;
+                    $scope.apikey.previousSecretExpires = data.previousSecretExpires;
+                    $scope.apikey.previousSecretLastUsed = data.previousSecretLastUsed;
+                }
+            );
+        }
+
+        function finishSecretRotation(label){
+            OrganizationService.finishAPIKeySecretRotation(organization, label).then(
+                function () {
+                    delete $scope.apikey.previousSecretExpires;
+                    delete $scope.apikey.previousSecretLastUsed;
+                }
+            );
+        }
+
     }
 
     function DNSDialogController($scope, $mdDialog, organization, OrganizationService, dnsName) {
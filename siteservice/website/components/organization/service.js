@@ -27,6 +27,8 @@
             updateAPIKey: updateAPIKey,
             getAPIKeyLabels: getAPIKeyLabels,
             getAPIKey: getAPIKey,
+            startAPIKeySecretRotation: startAPIKeySecretRotation,
+            finishAPIKeySecretRotation: finishAPIKeySecretRotation,
             getOrganizationTree: getOrganizationTree,
             getUsers: getUsers,
             createDNS: createDNS,
@@ -42,6 +44,8 @@
             deleteLogo: deleteLogo,
             getValidityDuration: getValidityDuration,
             SetValidityDuration: SetValidityDuration,
+            getAccessTokenValidity: getAccessTokenValidity,
+            setAccessTokenValidity: setAccessTokenValidity,
             createRequiredScope: createRequiredScope,
             updateRequiredScope: updateRequiredScope,
             deleteRequiredScope: deleteRequiredScope,
@@ -144,6 +148,16 @@
             return genericHttpCall(GET, url);
         }
 
+        function startAPIKeySecretRotation(globalid, label) {
+            var url = apiURL + '/' + encodeURIComponent(globalid) + '/apikeys/' + encodeURIComponent(label) + '/secretrotation';
+            return genericHttpCall(POST, url, {});
+        }
+
+        function finishAPIKeySecretRotation(globalid, label) {
+            var url = apiURL + '/' + encodeURIComponent(globalid) + '/apikeys/' + encodeURIComponent(label) + '/secretrotation';
+            return genericHttpCall(DELETE, url);
+        }
+
         function getOrganizationTree(globalid) {
             var url = apiURL + '/' + encodeURIComponent(globalid) + '/tree';
             return genericHttpCall(GET, url);
@@ -240,6 +254,19 @@
             return genericHttpCall(PUT, url, data);
         }
 
+        function getAccessTokenValidity(globalid) {
+            var url = apiURL + '/' + encodeURIComponent(globalid) + '/accesstoken/validity';
+            return genericHttpCall(GET, url);
+        }
+
+        function setAccessTokenValidity(globalid, secondsduration) {
+            var url = apiURL + '/' + encodeURIComponent(globalid) + '/accesstoken/validity';
+            var data = {
+                secondsvalidity: secondsduration
+            };
+            return genericHttpCall(PUT, url, data);
+        }
+
         function createRequiredScope(globalId, requiredScope) {
             var url = apiURL + '/' + encodeURIComponent(globalId) + '/requiredscopes';
             return genericHttpCall(POST, url, requiredScope);
@@ -4,9 +4,10 @@
         .module('itsyouonline.registration')
         .controller('registrationController', [
             '$scope', '$window', '$cookies', '$mdMedia','$mdUtil', '$rootScope', '$timeout', '$http', 'configService', 'registrationService',
-            registrationController]);
+            'PasswordPolicyService', registrationController]);
 
-    function registrationController($scope, $window, $cookies, $mdMedia, $mdUtil, $rootScope, $timeout, $http, configService, registrationService) {
+    function registrationController($scope, $window, $cookies, $mdMedia, $mdUtil, $rootScope, $timeout, $http, configService, registrationService,
+                                    PasswordPolicyService) {
         var vm = this,
             queryParams = URI($window.location.href).search(true);
         vm.resendValidation = resendValidation;
@@ -128,7 +129,7 @@
                                     $scope.signupform.totpcode.$setValidity(err, false);
                                     break;
                                 case 'invalid_password':
-                                    $scope.signupform.password.$setValidity(err, false);
+                                    vm.passwordPolicy = PasswordPolicyService.showViolations($scope.signupform.password, response.data.violations);
                                     break;
                                 case 'invalid_email_code':
                                     $scope.signupform.emailcode.$setValidity(err, false);
@@ -169,6 +170,9 @@
                 case 'smscode':
                     $scope.signupform[prop].$setValidity("invalid_sms_code", true);
                     break;
+                case 'password':
+                    PasswordPolicyService.resetValidation($scope.signupform[prop]);
+                    break;
                 case 'email':
                     $scope.signupform[prop].$setValidity("email", true);
                     $scope.signupform[prop].$setValidity("email_already_used", true);
@@ -255,7 +259,7 @@
                                 $scope.signupform.totpcode.$setValidity(err, false);
                                 break;
                             case 'invalid_password':
-                                $scope.signupform.password.$setValidity(err, false);
+                                vm.passwordPolicy = PasswordPolicyService.showViolations($scope.signupform.password, failure.data.violations);
                                 break;
                             case 'invalid_sms_code':
                                 $scope.signupform.smscode.$setValidity(err, false);
@@ -0,0 +1,36 @@
+(function () {
+    'use strict';
+    angular.module('itsyouonline.shared')
+        .service('PasswordPolicyService', [PasswordPolicyService]);
+
+    // A password that does not meet the password policy is rejected with the invalid_password error and a list of
+    // violations, every violation is shown as a validation error of the password field
+    function PasswordPolicyService() {
+        var codes = ['invalid_password', 'password_too_short', 'password_character_classes',
+            'password_contains_user_info', 'password_reused', 'password_breached'];
+        return {
+            showViolations: showViolations,
+            resetValidation: resetValidation
+        };
+
+        // Returns the values of the violations by code, to be used in the translations of the messages
+        function showViolations(field, violations) {
+            var values = {};
+            if (!violations || !violations.length) {
+                field.$setValidity('invalid_password', false);
+                return values;
+            }
+            angular.forEach(violations, function (violation) {
+                field.$setValidity(violation.code, false);
+                values[violation.code] = violation.value;
+            });
+            return values;
+        }
+
+        function resetValidation(field) {
+            angular.forEach(codes, function (code) {
+                field.$setValidity(code, true);
+            });
+        }
+    }
+})();
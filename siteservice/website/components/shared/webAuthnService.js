@@ -0,0 +1,75 @@
+(function () {
+    'use strict';
+    angular.module('itsyouonline.shared')
+        .service('WebAuthnService', ['$q', WebAuthnService]);
+
+    // The server sends and receives the binary values of the webauthn options and responses base64url encoded
+    function WebAuthnService($q) {
+        return {
+            isSupported: isSupported,
+            createCredential: createCredential,
+            getAssertion: getAssertion
+        };
+
+        function isSupported() {
+            return !!(window.PublicKeyCredential && navigator.credentials);
+        }
+
+        function createCredential(options) {
+            var publicKey = angular.copy(options);
+            publicKey.challenge = decode(options.challenge);
+            publicKey.user.id = decode(options.user.id);
+            publicKey.excludeCredentials = toDescriptors(options.excludeCredentials);
+            return $q.when(navigator.credentials.create({publicKey: publicKey}))
+                .then(function (credential) {
+                    return {
+                        clientdatajson: encode(credential.response.clientDataJSON),
+                        attestationobject: encode(credential.response.attestationObject)
+                    };
+                });
+        }
+
+        function getAssertion(options) {
+            var publicKey = angular.copy(options);
+            publicKey.challenge = decode(options.challenge);
+            publicKey.allowCredentials = toDescriptors(options.allowCredentials);
+            return $q.when(navigator.credentials.get({publicKey: publicKey}))
+                .then(function (credential) {
+                    return {
+                        id: encode(credential.rawId),
+                        clientdatajson: encode(credential.response.clientDataJSON),
+                        authenticatordata: encode(credential.response.authenticatorData),
+                        signature: encode(credential.response.signature)
+                    };
+                });
+        }
+
+        function toDescriptors(descriptors) {
+            return (descriptors || []).map(function (descriptor) {
+                return {type: descriptor.type, id: decode(descriptor.id)};
+            });
+        }
+
+        function decode(value) {
+            var base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+            while (base64.length % 4) {
+                base64 += '=';
+            }
+            var binary = atob(base64);
+            var bytes = new Uint8Array(binary.length);
+            for (var i = 0; i < binary.length; i++) {
+                bytes[i] = binary.charCodeAt(i);
+            }
+            return bytes.buffer;
+        }
+
+        function encode(buffer) {
+            var bytes = new Uint8Array(buffer);
+            var binary = '';
+            for (var i = 0; i < bytes.length; i++) {
+                binary += String.fromCharCode(bytes[i]);
+            }
+            return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+        }
+    }
+})();
@@ -7,17 +7,17 @@
         .controller("AuthorizeController", AuthorizeController);
 
 
-    AuthorizeController.$inject = ['$scope', '$location', '$window', '$q', '$translate',
+    AuthorizeController.$inject = ['$scope', '$location', '$window', '$q', '$translate', '$http',
         'UserService', 'UserDialogService', 'NotificationService'];
 
-    function AuthorizeController($scope, $location, $window, $q, $translate,
+    function AuthorizeController($scope, $location, $window, $q, $translate, $http,
                                  UserService, UserDialogService, NotificationService) {
         var vm = this;
         vm.isAuthorizeController = true;
 
         var queryParams = $location.search();
         vm.requestingorganization = queryParams['client_id'];
-        vm.requestedScopes = queryParams['scope'];
+        setRequestedScopes(queryParams);
         vm.requestedorganizations = [];
         vm.username = UserService.getUsername();
 
@@ -25,6 +25,9 @@
         vm.loaded = {};
         vm.pendingNotifications = [];
         vm.pendingOrganizationInvites = {};
+        vm.consentValidity = 0;
+        // Every requested scope with a function telling if the user approved it, used to record the consent
+        var consentScopes = [];
 
         UserDialogService.init(vm);
         vm.showAvatarDialog = addAvatar;
@@ -62,13 +65,38 @@
             fetch();
         }
 
+        function setRequestedScopes(scopes) {
+            vm.requestedScopes = scopes['scope'];
+            // When the user already authorized some of the scopes, only the new ones are asked
+            vm.isIncremental = scopes['newscope'] !== undefined;
+            if (vm.isIncremental) {
+                vm.requestedScopes = scopes['newscope'];
+            }
+        }
+
+        // The scopes of a pushed authorization request are not in the url, they are fetched from the server
+        function getRequestedScopes() {
+            if (!queryParams['request_uri']) {
+                return $q.resolve();
+            }
+            return $http
+                .get('/v1/oauth/par/scopes', {
+                    params: {
+                        client_id: queryParams['client_id'],
+                        request_uri: queryParams['request_uri']
+                    }
+                })
+                .then(function (response) {
+                    setRequestedScopes(response.data);
+                });
+        }
+
         function fetch() {
 
-            UserService
-                .get(vm.username)
+            $q.all([UserService.get(vm.username), getRequestedScopes()])
                 .then(
-                    function(data) {
-                        vm.user = data;
+                    function(responses) {
+                        vm.user = responses[0];
                         parseScopes();
                         loadVerifiedPhones();
                         loadVerifiedEmails();
@@ -105,6 +133,14 @@
                     return self.indexOf(item) === pos;
                 });
                 angular.forEach(scopes, function (scope) {
+                    // Scopes the user can not decline on this page are always approved
+                    var consentScope = {
+                        scope: scope,
+                        isApproved: function () {
+                            return true;
+                        }
+                    };
+                    consentScopes.push(consentScope);
                     var splitPermission = scope.split(':');
                     if (!splitPermission.length > 1) {
                         return;
@@ -126,29 +162,39 @@
                     if (listScope) {
                         auth.reallabel = vm.user[listScope].length ? vm.user[listScope][0].label : null;
                         $scope.authorizations[listScope].push(auth);
+                        consentScope.isApproved = isLabelSelected(auth);
                     }
                     else if (scope === 'user:name') {
                         $scope.authorizations.name = true;
+                        consentScope.isApproved = isChecked('name');
                     }
                     else if (scope.startsWith('user:memberof:')) {
                         $scope.requested.organizations[permissionLabel] = true;
+                        consentScope.isApproved = function () {
+                            return !!$scope.requested.organizations[permissionLabel];
+                        };
                     }
                     else if (scope.startsWith('user:digitalwalletaddress:')) {
                         auth.reallabel = vm.user.digitalwallet.length ? vm.user.digitalwallet[0].label : null;
                         auth.currency = splitPermission.length === 4 ? splitPermission[3] : null;
                         $scope.authorizations.digitalwallet.push(auth);
+                        consentScope.isApproved = isLabelSelected(auth);
                     }
                     else if (scope === 'user:github') {
                         $scope.authorizations.github = true;
+                        consentScope.isApproved = isChecked('github');
                     }
                     else if (scope === 'user:facebook') {
                         $scope.authorizations.facebook = true;
+                        consentScope.isApproved = isChecked('facebook');
                     }
                     else if (scope === 'user:keystore') {
                         $scope.authorizations.keystore = true;
+                        consentScope.isApproved = isChecked('keystore');
                     }
                     else if (scope === 'user:see') {
                         $scope.authorizations.see = true;
+                        consentScope.isApproved = isChecked('see');
                     }
                     else if (scope.startsWith('user:validated:')){
                         permissionLabel = splitPermission.length > 3 && splitPermission[3] ? splitPermission[3] : 'main';
@@ -178,6 +224,30 @@
             }
         }
 
+        function isLabelSelected(auth) {
+            return function () {
+                return !!auth.reallabel;
+            };
+        }
+
+        function isChecked(property) {
+            return function () {
+                return !!$scope.authorizations[property];
+            };
+        }
+
+        function getConsent() {
+            return {
+                scopes: consentScopes.map(function (consentScope) {
+                    return {
+                        scope: consentScope.scope,
+                        approved: consentScope.isApproved()
+                    };
+                }),
+                validity: vm.consentValidity
+            };
+        }
+
         function loadVerifiedPhones() {
             return $q(function (resolve, reject) {
                 if (vm.isLoadingVerifiedPhones) {
@@ -268,11 +338,15 @@
                 $scope.authorizations.grantedTo = vm.requestingorganization;
                 UserService
                     .saveAuthorization($scope.authorizations)
+                    .then(function () {
+                        return UserService.saveConsent(vm.username, vm.requestingorganization, getConsent());
+                    })
                     .then(
                         function () {
                             var u = URI($location.absUrl());
                             var endpoint = queryParams["endpoint"];
                             delete queryParams.endpoint;
+                            delete queryParams.newscope;
                             u.pathname(endpoint);
                             u.search(queryParams);
                             $window.location.href = u.toString();
@@ -9,10 +9,10 @@
 
     UserHomeController.$inject = [
         '$q', '$rootScope', '$state', '$window', '$filter', '$mdMedia', '$mdDialog', '$translate',
-        'NotificationService', 'OrganizationService', 'UserService', 'UserDialogService'];
+        'NotificationService', 'OrganizationService', 'UserService', 'UserDialogService', 'WebAuthnService'];
 
     function UserHomeController($q, $rootScope, $state, $window, $filter, $mdMedia, $mdDialog, $translate,
-                                NotificationService, OrganizationService, UserService, UserDialogService) {
+                                NotificationService, OrganizationService, UserService, UserDialogService, WebAuthnService) {
         var vm = this;
         vm.username = UserService.getUsername();
         vm.notifications = {
@@ -37,6 +37,9 @@
         vm.member = [];
         vm.memberTree = {};
         vm.twoFAMethods = {};
+        vm.webAuthnCredentials = [];
+        vm.lockouts = [];
+        vm.webAuthnSupported = WebAuthnService.isSupported();
         vm.user = {};
 
         vm.loaded = {};
@@ -81,6 +84,9 @@
         vm.showSetupAuthenticatorApplication = showSetupAuthenticatorApplication;
         vm.showExistingAuthenticatorApplication = showExistingAuthenticatorApplication;
         vm.removeAuthenticatorApplication = removeAuthenticatorApplication;
+        vm.showAddSecurityKeyDialog = showAddSecurityKeyDialog;
+        vm.removeSecurityKey = removeSecurityKey;
+        vm.generateRecoveryCodes = generateRecoveryCodes;
         vm.resolveMissingScopeClicked = resolveMissingScopeClicked;
         init();
 
@@ -280,6 +286,16 @@
                 .then(function (data) {
                     vm.twoFAMethods = data;
                 });
+            UserService
+                .getWebAuthnCredentials(vm.username)
+                .then(function (data) {
+                    vm.webAuthnCredentials = data;
+                });
+            UserService
+                .getLockouts(vm.username)
+                .then(function (data) {
+                    vm.lockouts = data;
+                });
         }
 
         function getPendingCount(obj) {
@@ -435,7 +451,7 @@
         function showChangePasswordDialog(event) {
             var useFullScreen = ($mdMedia('sm') || $mdMedia('xs'));
 
-            function showPasswordDialogController($scope, $mdDialog, username, updatePassword) {
+            function showPasswordDialogController($scope, $mdDialog, PasswordPolicyService, username, updatePassword) {
                 var ctrl = this;
                 ctrl.resetValidation = resetValidation;
                 ctrl.updatePassword = updatepwd;
@@ -445,7 +461,7 @@
 
                 function resetValidation() {
                     $scope.changepasswordform.currentPassword.$setValidity('incorrect_password', true);
-                    $scope.changepasswordform.currentPassword.$setValidity('invalid_password', true);
+                    PasswordPolicyService.resetValidation($scope.changepasswordform.newPassword);
                 }
 
                 function updatepwd() {
@@ -464,14 +480,18 @@
                         })
                     }, function (response) {
                         if (response.status === 422) {
-                            $scope.changepasswordform.currentPassword.$setValidity(response.data.error, false);
+                            if (response.data.error === 'invalid_password') {
+                                ctrl.passwordPolicy = PasswordPolicyService.showViolations($scope.changepasswordform.newPassword, response.data.violations);
+                            } else {
+                                $scope.changepasswordform.currentPassword.$setValidity(response.data.error, false);
+                            }
                         }
                     });
                 }
             }
 
             $mdDialog.show({
-                controller: ['$scope', '$mdDialog', 'username', 'updatePassword', showPasswordDialogController],
+                controller: ['$scope', '$mdDialog', 'PasswordPolicyService', 'username', 'updatePassword', showPasswordDialogController],
                 controllerAs: 'ctrl',
                 templateUrl: 'components/user/views/resetPasswordDialog.html',
                 targetEvent: event,
@@ -727,7 +747,7 @@
             var hasConfirmedPhones = vm.user.phonenumbers.filter(function (phone) {
                     return phone.verified;
                 }).length !== 0;
-            if (!hasConfirmedPhones) {
+            if (!hasConfirmedPhones && !vm.webAuthnCredentials.length) {
                 $translate(['user.controller.cantremoveauthapp', 'user.controller.cantremoveauthappmsg', 'ok']).then(function(translations){
                     $mdDialog.show(
                         $mdDialog.alert()
@@ -758,6 +778,141 @@
             });
         }
 
+        function showAddSecurityKeyDialog(event) {
+            $mdDialog.show({
+                controller: ['$scope', '$mdDialog', 'UserService', 'WebAuthnService', 'username', AddSecurityKeyController],
+                controllerAs: 'ctrl',
+                templateUrl: 'components/user/views/addSecurityKeyDialog.html',
+                targetEvent: event,
+                fullscreen: $mdMedia('sm') || $mdMedia('xs'),
+                parent: angular.element(document.body),
+                clickOutsideToClose: true,
+                locals: {
+                    username: vm.username
+                }
+            }).then(function (credential) {
+                vm.webAuthnCredentials.push(credential);
+                vm.twoFAMethods.webauthn = true;
+            });
+
+            function AddSecurityKeyController($scope, $mdDialog, UserService, WebAuthnService, username) {
+                var ctrl = this;
+                ctrl.close = close;
+                ctrl.submit = submit;
+                ctrl.resetValidation = resetValidation;
+                ctrl.label = '';
+                ctrl.passwordless = false;
+                ctrl.waiting = false;
+
+                function close() {
+                    $mdDialog.cancel();
+                }
+
+                // The browser asks the user to touch the key or verify themselves when the credential is created
+                function submit() {
+                    ctrl.waiting = true;
+                    UserService.startWebAuthnRegistration(username, ctrl.passwordless)
+                        .then(WebAuthnService.createCredential)
+                        .then(function (attestation) {
+                            return UserService.registerWebAuthnCredential(username, ctrl.label, attestation);
+                        })
+                        .then(function (credential) {
+                            $mdDialog.hide(credential);
+                        }, function (response) {
+                            ctrl.waiting = false;
+                            if (response && response.status === 409) {
+                                $scope.form.label.$setValidity('duplicate', false);
+                            } else {
+                                $scope.form.label.$setValidity('registrationfailed', false);
+                            }
+                        });
+                }
+
+                function resetValidation() {
+                    $scope.form.label.$setValidity('duplicate', true);
+                    $scope.form.label.$setValidity('registrationfailed', true);
+                }
+            }
+        }
+
+        function removeSecurityKey(event, credential) {
+            $translate(['user.controller.removesecuritykey', 'user.controller.confirmremovesecuritykey', 'user.controller.yes', 'user.controller.no'], {label: credential.label}).then(function(translations){
+                var confirm = $mdDialog.confirm()
+                    .title(translations['user.controller.removesecuritykey'])
+                    .textContent(translations['user.controller.confirmremovesecuritykey'])
+                    .ariaLabel(translations['user.controller.removesecuritykey'])
+                    .targetEvent(event)
+                    .ok(translations['user.controller.yes'])
+                    .cancel(translations['user.controller.no']);
+                $mdDialog.show(confirm).then(function () {
+                    UserService.deleteWebAuthnCredential(vm.username, credential.id)
+                        .then(function () {
+                            vm.webAuthnCredentials.splice(vm.webAuthnCredentials.indexOf(credential), 1);
+                            vm.twoFAMethods.webauthn = vm.webAuthnCredentials.length !== 0;
+                        }, function (response) {
+                            if (response.status === 409) {
+                                $translate(['user.controller.cantremovesecuritykey', 'user.controller.cantremovesecuritykeymsg', 'ok']).then(function(translations){
+                                    $mdDialog.show(
+                                        $mdDialog.alert()
+                                            .clickOutsideToClose(true)
+                                            .title(translations['user.controller.cantremovesecuritykey'])
+                                            .htmlContent(translations['user.controller.cantremovesecuritykeymsg'])
+                                            .ariaLabel(translations['user.controller.cantremovesecuritykey'])
+                                            .ok(translations['ok'])
+                                            .targetEvent(event)
+                                    );
+                                });
+                            }
+                        });
+                });
+            });
+        }
+
+        function generateRecoveryCodes(event) {
+            if (!vm.twoFAMethods.recoverycodes) {
+                generate();
+                return;
+            }
+            $translate(['user.controller.regeneraterecoverycodes', 'user.controller.confirmregeneraterecoverycodes', 'user.controller.yes', 'user.controller.no']).then(function(translations){
+                var confirm = $mdDialog.confirm()
+                    .title(translations['user.controller.regeneraterecoverycodes'])
+                    .textContent(translations['user.controller.confirmregeneraterecoverycodes'])
+                    .ariaLabel(translations['user.controller.regeneraterecoverycodes'])
+                    .targetEvent(event)
+                    .ok(translations['user.controller.yes'])
+                    .cancel(translations['user.controller.no']);
+                $mdDialog.show(confirm).then(generate);
+            });
+
+            function generate() {
+                UserService.generateRecoveryCodes(vm.username)
+                    .then(function (data) {
+                        vm.twoFAMethods.recoverycodes = data.codes.length;
+                        $mdDialog.show({
+                            controller: ['$mdDialog', 'codes', RecoveryCodesController],
+                            controllerAs: 'ctrl',
+                            templateUrl: 'components/user/views/recoveryCodesDialog.html',
+                            targetEvent: event,
+                            fullscreen: $mdMedia('sm') || $mdMedia('xs'),
+                            parent: angular.element(document.body),
+                            locals: {
+                                codes: data.codes
+                            }
+                        });
+                    });
+            }
+
+            function RecoveryCodesController($mdDialog, codes) {
+                var ctrl = this;
+                ctrl.codes = codes;
+                ctrl.close = close;
+
+                function close() {
+                    $mdDialog.hide();
+                }
+            }
+        }
+
         function resolveMissingScopeClicked(event, missingScope) {
             resolveMissingScope(event, missingScope).then(updated);
             function updated() {
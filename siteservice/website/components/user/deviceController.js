@@ -0,0 +1,28 @@
+(function() {
+    'use strict';
+
+
+    angular
+        .module("itsyouonlineApp")
+        .controller("DeviceController", DeviceController);
+
+
+    DeviceController.$inject = ['$location', '$window'];
+
+    function DeviceController($location, $window) {
+        var vm = this;
+
+        var queryParams = $location.search();
+        vm.userCode = queryParams['user_code'] || '';
+        vm.status = queryParams['status'];
+        vm.clientId = queryParams['client_id'];
+        vm.scopes = queryParams['scope'] ? queryParams['scope'].split(',') : [];
+        vm.confirmationToken = queryParams['confirmation_token'];
+        vm.submit = submit;
+
+        function submit() {
+            //The device is approved or denied on the confirmation page that is shown next
+            $window.location.href = '/v1/oauth/device/authorize?user_code=' + encodeURIComponent(vm.userCode);
+        }
+    }
+})();
@@ -7,7 +7,6 @@
               templateUrl: 'components/user/directives/authorizationDetails.html',
               link: function (scope, element, attr) {
                   scope.save = save;
-                  scope.isRequired = isRequired;
 
                   scope.fullscreenAuthorization = attr.full !== undefined && attr.full !== 'false';
 
@@ -30,10 +29,6 @@
                       });
                       scope.update(event);
                   }
-
-                  function isRequired(prop) {
-                    return scope.isNew;
-                  }
               }
           };
     }]);
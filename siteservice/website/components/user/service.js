@@ -119,6 +119,7 @@
             getAuthorizations: getAuthorizations,
             saveAuthorization: saveAuthorization,
             deleteAuthorization: deleteAuthorization,
+            saveConsent: saveConsent,
             getSeeObjects: getSeeObjects,
             getSeeObject: getSeeObject,
             registerNewBankAccount: registerNewBankAccount,
@@ -144,6 +145,12 @@
             getAuthenticatorSecret: getAuthenticatorSecret,
             setAuthenticator: setAuthenticator,
             removeAuthenticator: removeAuthenticator,
+            getWebAuthnCredentials: getWebAuthnCredentials,
+            startWebAuthnRegistration: startWebAuthnRegistration,
+            registerWebAuthnCredential: registerWebAuthnCredential,
+            deleteWebAuthnCredential: deleteWebAuthnCredential,
+            generateRecoveryCodes: generateRecoveryCodes,
+            getLockouts: getLockouts,
             createDigitalWalletAddress: createDigitalWalletAddress,
             updateDigitalWalletAddress: updateDigitalWalletAddress,
             deleteDigitalWalletAddress: deleteDigitalWalletAddress,
@@ -337,6 +344,11 @@
             return genericHttpCall($http.delete, url);
         }
 
+        function saveConsent(username, grantedTo, consent) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/authorizations/' + encodeURIComponent(grantedTo) + '/consents';
+            return genericHttpCall($http.post, url, consent);
+        }
+
         function getSeeObjects(organization) {
             var queryString = organization ? '?globalid=' + encodeURIComponent(organization) : '';
             var url = apiURL + '/' + encodeURIComponent(username) + '/see' + queryString;
@@ -490,6 +502,40 @@
             return genericHttpCall($http.delete, url);
         }
 
+        function getWebAuthnCredentials(username) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/webauthn';
+            return genericHttpCall($http.get, url);
+        }
+
+        function startWebAuthnRegistration(username, passwordless) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/webauthn/registration';
+            var data = {
+                passwordless: passwordless
+            };
+            return genericHttpCall($http.post, url, data);
+        }
+
+        function registerWebAuthnCredential(username, label, attestation) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/webauthn';
+            var data = angular.extend({label: label}, attestation);
+            return genericHttpCall($http.post, url, data);
+        }
+
+        function deleteWebAuthnCredential(username, id) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/webauthn/' + encodeURIComponent(id);
+            return genericHttpCall($http.delete, url);
+        }
+
+        function generateRecoveryCodes(username) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/recoverycodes';
+            return genericHttpCall($http.post, url, {});
+        }
+
+        function getLockouts(username) {
+            var url = apiURL + '/' + encodeURIComponent(username) + '/lockouts';
+            return genericHttpCall($http.get, url);
+        }
+
         function createDigitalWalletAddress(username, walletAddress) {
             var url = apiURL + '/' + encodeURIComponent(username) + '/digitalwallet';
             return genericHttpCall(POST, url, walletAddress);